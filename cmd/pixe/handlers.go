@@ -3,17 +3,27 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"compress/gzip"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/ArqonAi/Pixelog/internal/converter"
+	"github.com/ArqonAi/Pixelog/internal/crypto"
+	"github.com/ArqonAi/Pixelog/internal/embedding"
 	"github.com/ArqonAi/Pixelog/internal/index"
 	"github.com/ArqonAi/Pixelog/internal/llm"
+	"github.com/ArqonAi/Pixelog/internal/qr"
 	"github.com/ArqonAi/Pixelog/internal/video"
+	"github.com/ArqonAi/Pixelog/pkg/config"
 )
 
 // ============================================================================
@@ -28,8 +38,13 @@ func handleIndex() {
 	}
 
 	inputPath := os.Args[2]
-	provider := "mock"
+	provider := ""
 	apiKey := ""
+	vectorFormat := index.VectorFloat32
+	pqSubspaces := 0
+	keepExact := true
+	var batch embedding.BatchOptions
+	allowPartial := false
 
 	// Parse flags
 	for i := 3; i < len(os.Args); i++ {
@@ -39,68 +54,107 @@ func handleIndex() {
 				provider = os.Args[i+1]
 				i++
 			}
-		case "--api-key":
+		case "--vectors":
 			if i+1 < len(os.Args) {
-				apiKey = os.Args[i+1]
+				format, err := index.ParseVectorFormat(os.Args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				vectorFormat = format
 				i++
 			}
-		}
-	}
-
-	// Check for API key from multiple providers
-	if apiKey == "" {
-		apiKey = os.Getenv("OPENAI_API_KEY")
-		if apiKey == "" {
-			apiKey = os.Getenv("OPENROUTER_API_KEY")
-		}
-		if apiKey == "" {
-			apiKey = os.Getenv("GOOGLE_API_KEY")
-			if apiKey != "" {
-				provider = "gemini"
+		case "--pq-subspaces":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n <= 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --pq-subspaces value\n")
+					os.Exit(1)
+				}
+				pqSubspaces = n
+				i++
 			}
-		}
-		if apiKey == "" {
-			apiKey = os.Getenv("ANTHROPIC_API_KEY")
-			if apiKey != "" {
-				provider = "anthropic"
+		case "--no-rerank":
+			keepExact = false
+		case "--batch-size", "--concurrency":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n <= 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid %s value\n", os.Args[i])
+					os.Exit(1)
+				}
+				if os.Args[i] == "--batch-size" {
+					batch.BatchSize = n
+				} else {
+					batch.Concurrency = n
+				}
+				i++
 			}
-		}
-		if apiKey == "" {
-			apiKey = os.Getenv("XAI_API_KEY")
-			if apiKey != "" {
-				provider = "xai"
+		case "--rate":
+			if i+1 < len(os.Args) {
+				rate, err := strconv.ParseFloat(os.Args[i+1], 64)
+				if err != nil || rate <= 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --rate value\n")
+					os.Exit(1)
+				}
+				batch.Rate = rate
+				i++
+			}
+		case "--allow-partial":
+			allowPartial = true
+		case "--api-key":
+			if i+1 < len(os.Args) {
+				apiKey = os.Args[i+1]
+				i++
 			}
 		}
 	}
 
-	if apiKey == "" {
-		fmt.Fprintln(os.Stderr, "Error: API key required for indexing")
-		fmt.Fprintln(os.Stderr, "Provide via --api-key flag or set one of these env vars:")
-		fmt.Fprintln(os.Stderr, "  OPENAI_API_KEY, OPENROUTER_API_KEY, GOOGLE_API_KEY, ANTHROPIC_API_KEY, XAI_API_KEY")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Example:")
-		fmt.Fprintln(os.Stderr, "  export OPENAI_API_KEY=sk-xxx")
-		fmt.Fprintln(os.Stderr, "  pixe index file.pixe")
+	// Use the provider asked for, otherwise the first with an API key,
+	// otherwise the offline embedder
+	opts := embedding.OptionsFromEnv()
+	if provider != "" {
+		opts.Provider = provider
+	}
+	if apiKey != "" {
+		opts.SetAPIKey(apiKey)
+	}
+	embedder, err := embedding.New(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	fmt.Printf("Building index for %s...\n", inputPath)
-	
-	// Create embedder with auto model selection
-	embedder := index.NewSimpleEmbedder(provider, apiKey, "auto")
-	model, _ := index.GetDefaultModel(provider)
-	fmt.Printf("Using %s with model %s (semantic search)\n", provider, model)
+	if opts.Provider == "" && strings.HasPrefix(embedder.Model(), "local:") {
+		fmt.Println("No API key set, embedding offline (word-level similarity)")
+		fmt.Println("  (set OPENAI_API_KEY or pass --api-key for semantic embeddings)")
+	}
+	fmt.Printf("Using %s\n", embedder.Model())
 
 	// Create indexer
-	indexer, err := index.NewIndexer("./indexes", embedder)
+	indexer, err := index.NewIndexer(index.DefaultDir, embedder)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating indexer: %v\n", err)
 		os.Exit(1)
 	}
+	indexer.SetVectorFormat(vectorFormat)
+	indexer.SetQuantization(pqSubspaces, keepExact)
+	indexer.SetBatching(batch)
+	indexer.SetAllowPartial(allowPartial)
+	indexer.SetProgress(func(done, total int) {
+		fmt.Printf("\rEmbedded %d/%d passages", done, total)
+		if done == total {
+			fmt.Println()
+		}
+	})
+	indexer.SetWarnings(func(warning string) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	})
 
 	// Build index
-	memoryID := inputPath
-	idx, err := indexer.BuildIndex(memoryID, inputPath)
+	memoryID := index.MemoryID(inputPath)
+	idx, err := indexer.BuildIndex(context.Background(), memoryID, inputPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error building index: %v\n", err)
 		os.Exit(1)
@@ -108,21 +162,101 @@ func handleIndex() {
 
 	fmt.Printf("✓ Index built successfully!\n")
 	fmt.Printf("  Total frames: %d\n", idx.TotalFrames)
-	fmt.Printf("  Vector dimensions: %d\n", idx.VectorDim)
-	fmt.Printf("  Index saved to: ./indexes/%s.index\n", memoryID)
+	fmt.Printf("  Vector dimensions: %d (%s)\n", idx.VectorDim, idx.VectorFormat)
+	if idx.VectorFormat != index.VectorFloat32 {
+		fmt.Printf("  Note: %s shrinks the index file only; searches decode it to float32 in memory\n", idx.VectorFormat)
+	}
+	if len(idx.MissingFrames) > 0 {
+		fmt.Printf("  ⚠️  Frames not embedded: %d (run pixe index again to fill them)\n", len(idx.MissingFrames))
+	}
+	if cached, ok := embedder.(*embedding.Cached); ok {
+		hits, misses := cached.Counts()
+		fmt.Printf("  Embeddings: %d from cache, %d from %s\n", hits, misses, embedder.Model())
+	}
+	fmt.Printf("  Index saved to: %s\n", filepath.Join(index.DefaultDir, memoryID+".index"))
+}
+
+func handleCache() {
+	if len(os.Args) < 3 || (os.Args[2] != "stats" && os.Args[2] != "prune") {
+		fmt.Println("Usage: pixe cache stats|prune [--max-size MB] [--all]")
+		os.Exit(1)
+	}
+
+	cache := embedding.OptionsFromEnv().Cache
+	if cache == nil {
+		fmt.Println("Embedding cache is off (EMBEDDING_CACHE_DIR=off)")
+		return
+	}
+
+	if os.Args[2] == "stats" {
+		stats, err := cache.Stats()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("📦 Embedding cache: %s\n", cache.Dir())
+		fmt.Printf("  Entries: %d\n", stats.Entries)
+		fmt.Printf("  Size: %s of %s\n", formatSize(stats.Bytes), formatSize(cache.MaxBytes()))
+		models := make([]string, 0, len(stats.Models))
+		for model := range stats.Models {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		for _, model := range models {
+			m := stats.Models[model]
+			fmt.Printf("  %s: %d entries, %s\n", model, m.Entries, formatSize(m.Bytes))
+		}
+		return
+	}
+
+	maxBytes := cache.MaxBytes()
+	all := false
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--max-size":
+			if i+1 < len(os.Args) {
+				mb, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || mb <= 0 {
+					fmt.Fprintf(os.Stderr, "Error: --max-size must be a positive number of MB, use --all to clear the cache\n")
+					os.Exit(1)
+				}
+				maxBytes = int64(mb) << 20
+				i++
+			}
+		case "--all":
+			all = true
+		}
+	}
+
+	if all {
+		if err := cache.Clear(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Cleared %s\n", cache.Dir())
+		return
+	}
+	removed, freed, err := cache.Prune(maxBytes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Removed %d least recently used embeddings (%s)\n", removed, formatSize(freed))
 }
 
 func handleSearch() {
 	if len(os.Args) < 4 {
 		fmt.Fprintln(os.Stderr, "Error: input .pixe file and query required")
-		fmt.Println("Usage: pixe search <input.pixe> <query> [--api-key KEY]")
+		fmt.Println("Usage: pixe search <input.pixe> <query> [--mode hybrid|semantic|lexical] [--api-key KEY]")
 		os.Exit(1)
 	}
 
 	inputPath := os.Args[2]
 	query := os.Args[3]
 	topK := 5
-	provider := "openai"
+	rerank := 0
+	mode := index.SearchHybrid
+	provider := ""
 	apiKey := ""
 
 	// Parse flags
@@ -138,6 +272,26 @@ func handleSearch() {
 				}
 				i++
 			}
+		case "--mode":
+			if i+1 < len(os.Args) {
+				var err error
+				mode, err = index.ParseSearchMode(os.Args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				i++
+			}
+		case "--rerank":
+			if i+1 < len(os.Args) {
+				var err error
+				rerank, err = strconv.Atoi(os.Args[i+1])
+				if err != nil || rerank < 0 {
+					fmt.Fprintf(os.Stderr, "Error: invalid --rerank value\n")
+					os.Exit(1)
+				}
+				i++
+			}
 		case "--api-key":
 			if i+1 < len(os.Args) {
 				apiKey = os.Args[i+1]
@@ -151,62 +305,44 @@ func handleSearch() {
 		}
 	}
 
-	// Check for API key from multiple providers
-	if apiKey == "" {
-		apiKey = os.Getenv("OPENAI_API_KEY")
-		if apiKey == "" {
-			apiKey = os.Getenv("OPENROUTER_API_KEY")
-		}
-		if apiKey == "" {
-			apiKey = os.Getenv("GOOGLE_API_KEY")
-			if apiKey != "" {
-				provider = "gemini"
-			}
-		}
-		if apiKey == "" {
-			apiKey = os.Getenv("ANTHROPIC_API_KEY")
-			if apiKey != "" {
-				provider = "anthropic"
-			}
-		}
-		if apiKey == "" {
-			apiKey = os.Getenv("XAI_API_KEY")
-			if apiKey != "" {
-				provider = "xai"
-			}
-		}
+	// Queries are embedded with the model the index was built with, using
+	// these credentials
+	opts := embedding.OptionsFromEnv()
+	if provider != "" {
+		opts.Provider = provider
 	}
-
-	if apiKey == "" {
-		fmt.Fprintln(os.Stderr, "Error: API key required for search (need to embed query)")
-		fmt.Fprintln(os.Stderr, "Provide via --api-key flag or set one of these env vars:")
-		fmt.Fprintln(os.Stderr, "  OPENAI_API_KEY, OPENROUTER_API_KEY, GOOGLE_API_KEY, ANTHROPIC_API_KEY, XAI_API_KEY")
-		os.Exit(1)
+	if apiKey != "" {
+		opts.SetAPIKey(apiKey)
 	}
-
-	fmt.Printf("Searching in %s for: \"%s\"\n\n", inputPath, query)
-
-	// Create embedder for query with auto model selection
-	embedder := index.NewSimpleEmbedder(provider, apiKey, "auto")
-	indexer, err := index.NewIndexer("./indexes", embedder)
+	indexer, err := index.NewIndexer(index.DefaultDir, nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating indexer: %v\n", err)
 		os.Exit(1)
 	}
+	indexer.SetProviders(opts)
+	if rerank > 0 {
+		indexer.SetRerank(rerank)
+	}
 
 	// Load index
-	memoryID := inputPath
+	memoryID := index.MemoryID(inputPath)
 	idx, err := indexer.LoadIndex(memoryID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading index: %v\n", err)
 		fmt.Fprintln(os.Stderr, "Hint: Run 'pixe index <file>' first to build the index")
 		os.Exit(1)
 	}
+	defer idx.Close()
+
+	fmt.Printf("Searching in %s for: \"%s\" (%s)\n\n", inputPath, query, mode)
 
 	// Search
-	results, err := indexer.Search(idx, query, topK)
+	results, err := indexer.SearchWith(context.Background(), idx, query, topK, mode)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error searching: %v\n", err)
+		if mode == index.SearchSemantic {
+			fmt.Fprintln(os.Stderr, "Hint: set the API key of the index's provider, or use --mode lexical")
+		}
 		os.Exit(1)
 	}
 
@@ -228,7 +364,7 @@ func handleSearch() {
 func handleChat() {
 	if len(os.Args) < 3 {
 		fmt.Fprintln(os.Stderr, "Error: input .pixe file required")
-		fmt.Println("Usage: pixe chat <input.pixe> [--model MODEL] [--api-key KEY] [--list]")
+		fmt.Println("Usage: pixe chat <input.pixe> [--model MODEL] [--api-key KEY] [--password-file FILE] [--list]")
 		fmt.Println("")
 		fmt.Println("Top 10 Models:")
 		for i, m := range llm.GetTop10Models() {
@@ -240,6 +376,7 @@ func handleChat() {
 	inputPath := os.Args[2]
 	model := ""
 	apiKey := ""
+	passwordFlag := newPasswordFlags("--password")
 	showList := false
 
 	// Parse flags
@@ -257,12 +394,16 @@ func handleChat() {
 			}
 		case "--list":
 			showList = true
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
+			}
 		}
 	}
 
 	// Show top 10 models
 	if showList {
-		fmt.Println("\n🚀 Top 10 Latest LLM Models (via OpenRouter):\n")
+		fmt.Print("\n🚀 Top 10 Latest LLM Models (via OpenRouter):\n\n")
 		for i, m := range llm.GetTop10Models() {
 			fmt.Printf("%d. %-20s %s\n", i+1, m.Name, m.Description)
 			fmt.Printf("   Model: %s\n", m.Model)
@@ -270,6 +411,7 @@ func handleChat() {
 		}
 		os.Exit(0)
 	}
+	password := passwordFlag.read(false, false)
 
 	// Get OpenRouter API key
 	if apiKey == "" {
@@ -304,28 +446,46 @@ func handleChat() {
 	}
 	fmt.Printf("📁 Memory: %s\n\n", inputPath)
 	fmt.Println("Type your questions (or 'quit' to exit)")
-	fmt.Println("──────────────────────────────────────────\n")
+	fmt.Print("──────────────────────────────────────────\n\n")
 
-	// Load index (nil embedder since we're loading existing index)
-	indexer, err := index.NewIndexer("./indexes", nil)
+	// Load index; queries are embedded with its model if the environment
+	// has credentials for it
+	indexer, err := index.NewIndexer(index.DefaultDir, nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	indexer.SetProviders(embedding.OptionsFromEnv())
 
 	// Check if index exists
-	memoryID := inputPath
+	memoryID := index.MemoryID(inputPath)
 	idx, err := indexer.LoadIndex(memoryID)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error: Index not found")
 		fmt.Fprintf(os.Stderr, "Run 'pixe index %s --api-key YOUR_KEY' first to build the index\n", inputPath)
 		os.Exit(1)
 	}
+	defer idx.Close()
 
 	// Interactive chat loop
 	scanner := bufio.NewScanner(os.Stdin)
 	maker, _ := video.New()
 
+	// Retrieved frames are checked against the manifest before use
+	manifest, err := maker.ReadManifest(inputPath)
+	if err != nil {
+		fmt.Printf("⚠️  Retrieved frames cannot be verified: %v\n\n", err)
+		manifest = nil
+	}
+
+	// The manifest also holds the wrapped key of encrypted archives
+	decrypter, err := converter.NewDecrypter(manifest, password, "", kdfLimits())
+	if err != nil {
+		fmt.Printf("⚠️  Encrypted frames cannot be read: %v\n\n", err)
+		decrypter = crypto.NewDecrypter(password)
+		decrypter.SetKDFLimits(kdfLimits())
+	}
+
 	for {
 		fmt.Print("You: ")
 		if !scanner.Scan() {
@@ -341,8 +501,9 @@ func handleChat() {
 			break
 		}
 
-		// Search for relevant context
-		results, err := indexer.Search(idx, query, 3)
+		// Search for relevant context. Without credentials for the index's
+		// embedding model this matches words through the term index.
+		results, err := indexer.SearchWith(context.Background(), idx, query, 3, index.SearchHybrid)
 		if err != nil {
 			fmt.Printf("Search error: %v\n", err)
 			continue
@@ -351,11 +512,29 @@ func handleChat() {
 		// Extract relevant frames
 		var contexts []string
 		for _, res := range results {
-			chunk, err := maker.ExtractSingleFrame(inputPath, res.FrameNumber)
-			if err == nil && chunk != nil {
-				data := decompressIfNeeded(chunk.Data)
-				contexts = append(contexts, data)
+			var chunk *qr.Chunk
+			if manifest != nil {
+				chunk, err = maker.ExtractVerifiedFrame(inputPath, res.FrameNumber, manifest)
+				if errors.Is(err, video.ErrFrameUnverified) {
+					fmt.Printf("⚠️  Skipping %v\n", err)
+				}
+			} else {
+				chunk, err = maker.ExtractSingleFrame(inputPath, res.FrameNumber)
+			}
+			if err != nil || chunk == nil {
+				continue
+			}
+			text := chunk.Data
+			if chunk.Encrypted {
+				// Encrypted chunks decrypt on their own, no need for the whole file
+				plaintext, err := converter.DecryptChunk(*chunk, decrypter)
+				if err != nil {
+					fmt.Printf("⚠️  Skipping frame %d: %v\n", res.FrameNumber, err)
+					continue
+				}
+				text = string(plaintext)
 			}
+			contexts = append(contexts, decompressIfNeeded(text))
 		}
 
 		if len(contexts) == 0 {
@@ -604,13 +783,23 @@ func handleInfo() {
 
 	memoryID := inputPath
 	// No embedder needed for version operations
-	indexer, _ := index.NewIndexer("./indexes", nil)
-	idx, err := indexer.LoadIndex(memoryID)
+	indexer, _ := index.NewIndexer(index.DefaultDir, nil)
+	idx, err := indexer.LoadIndex(index.MemoryID(inputPath))
 	if err == nil {
 		fmt.Printf("\n📚 Index Information:\n")
 		fmt.Printf("  Indexed frames: %d\n", idx.TotalFrames)
-		fmt.Printf("  Vector dimensions: %d\n", idx.VectorDim)
+		fmt.Printf("  Vector dimensions: %d (%s)\n", idx.VectorDim, idx.VectorFormat)
+	if idx.VectorFormat != index.VectorFloat32 {
+		fmt.Printf("  Note: %s shrinks the index file only; searches decode it to float32 in memory\n", idx.VectorFormat)
+	}
+		if idx.EmbeddingModel != "" {
+			fmt.Printf("  Embedding model: %s\n", idx.EmbeddingModel)
+		}
+		if len(idx.MissingFrames) > 0 {
+			fmt.Printf("  Frames not embedded: %v\n", idx.MissingFrames)
+		}
 		fmt.Printf("  Created: %s\n", idx.CreatedAt.Format("2006-01-02 15:04:05"))
+		idx.Close()
 	} else {
 		fmt.Printf("\n📚 Index: Not built (run 'pixe index %s')\n", inputPath)
 	}
@@ -632,53 +821,472 @@ func handleInfo() {
 func handleVerify() {
 	if len(os.Args) < 3 {
 		fmt.Fprintln(os.Stderr, "Error: input .pixe file required")
-		fmt.Println("Usage: pixe verify <input.pixe>")
+		fmt.Println("Usage: pixe verify <input.pixe> [--json] [--pubkey key.pub] [--password-file file]")
 		os.Exit(1)
 	}
 
 	inputPath := os.Args[2]
+	jsonOutput := false
+	passwordFlag := newPasswordFlags("--password")
+	var opts video.VerifyOptions
 
-	fmt.Printf("🔍 Verifying %s...\n\n", inputPath)
+	// Parse flags
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--json":
+			jsonOutput = true
+		case "--pubkey":
+			if i+1 < len(os.Args) {
+				pub, err := crypto.LoadVerifyKey(os.Args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				opts.PublicKey = pub
+				i++
+			}
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
+			}
+		}
+	}
+	if password := passwordFlag.read(false, false); password != "" {
+		envelope, err := crypto.NewEnvelope(password, crypto.DefaultKDF)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		envelope.SetKDFLimits(kdfLimits())
+		opts.Sealer = envelope
+	}
 
-	maker, _ := video.New()
-	frameCount, err := maker.GetFrameCount(inputPath)
+	maker, err := video.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !jsonOutput {
+		fmt.Printf("🔍 Verifying %s...\n\n", inputPath)
+	}
+
+	report, err := maker.Verify(inputPath, opts)
 	if err != nil {
-		fmt.Printf("❌ Error reading video: %v\n", err)
+		fmt.Fprintf(os.Stderr, "❌ Error reading video: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Total frames: %d\n", frameCount)
-	fmt.Println("Decoding all QR codes...")
+	if jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		printVerifyReport(report)
+	}
+
+	// Non-zero exit codes let audit jobs fail without parsing output
+	switch report.Status {
+	case video.VerifyCorrupt:
+		os.Exit(2)
+	case video.VerifyIncomplete:
+		os.Exit(3)
+	}
+}
+
+func printVerifyReport(report *video.VerifyReport) {
+	fmt.Printf("Frames: %d decoded, %d failed (of %d)\n",
+		report.DecodedFrames, len(report.FailedFrames), report.TotalFrames)
+	if len(report.FailedFrames) > 0 {
+		fmt.Printf("Failed frames: %v\n", report.FailedFrames)
+	}
 
-	successCount := 0
-	failCount := 0
+	switch {
+	case report.ManifestError != "":
+		fmt.Printf("Manifest: ❌ %s\n", report.ManifestError)
+	case report.HasManifest:
+		fmt.Printf("Manifest: ✓ archive %s\n", report.ArchiveID)
+	default:
+		fmt.Println("Manifest: none (archive predates manifests)")
+	}
 
-	for i := 0; i < frameCount; i++ {
-		_, err := maker.ExtractSingleFrame(inputPath, i)
-		if err == nil {
-			successCount++
+	if sig := report.Signature; sig != nil {
+		switch {
+		case sig.Trusted:
+			fmt.Printf("Signature: ✓ signed by trusted key %s\n", sig.KeyID)
+		case sig.Valid:
+			fmt.Printf("Signature: ⚠️  valid, signed by key %s (pass --pubkey to check who signed it)\n", sig.KeyID)
+		default:
+			fmt.Printf("Signature: ❌ %s\n", sig.Error)
+		}
+	}
+
+	fmt.Println("\nFiles:")
+	for _, file := range report.Files {
+		switch file.Status {
+		case video.VerifyOK:
+			fmt.Printf("  ✅ OK          %s (%d chunks, sha256 %s)\n", file.Name, file.TotalChunks, file.ComputedHash[:16])
+		case video.VerifyIncomplete:
+			fmt.Printf("  ⚠️  INCOMPLETE  %s: %d/%d chunks, missing %v\n",
+				file.Name, file.PresentChunks, file.TotalChunks, file.MissingIndices)
+		default:
+			fmt.Printf("  ❌ CORRUPT     %s\n", file.Name)
+		}
+		if len(file.RepairedIndices) > 0 {
+			fmt.Printf("      repaired from parity: %v\n", file.RepairedIndices)
+		}
+		for _, problem := range file.Problems {
+			fmt.Printf("      %s\n", problem)
+		}
+	}
+
+	fmt.Printf("\nArchive integrity: %s\n", report.Status)
+}
+
+// ============================================================================
+// KEYS
+// ============================================================================
+
+func handleKeygen() {
+	base := ""
+	encryption := false
+
+	// Parse flags
+	for i := 2; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 < len(os.Args) {
+				base = os.Args[i+1]
+				i++
+			}
+		case "--encryption":
+			encryption = true
+		}
+	}
+
+	if encryption {
+		if base == "" {
+			base = "pixelog-identity"
+		}
+		generateIdentity(base)
+		return
+	}
+	if base == "" {
+		base = "pixelog-signing"
+	}
+
+	pub, priv, err := crypto.GenerateSigningKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	privPath, pubPath, err := crypto.WriteSigningKeys(base, pub, priv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Generated Ed25519 signing key %s\n", crypto.KeyFingerprint(pub))
+	fmt.Printf("  Private key: %s (keep secret, use with pixe convert --sign)\n", privPath)
+	fmt.Printf("  Public key:  %s (share, use with pixe verify --pubkey)\n", pubPath)
+}
+
+// generateIdentity writes an X25519 key pair that archives can be encrypted to
+func generateIdentity(base string) {
+	priv, err := crypto.GenerateIdentity()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	privPath, pubPath, err := crypto.WriteIdentity(base, priv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	pub := priv.PublicKey()
+	fmt.Printf("✓ Generated X25519 encryption key %s\n", crypto.RecipientFingerprint(pub))
+	fmt.Printf("  Private key: %s (keep secret, use with pixe extract --identity)\n", privPath)
+	fmt.Printf("  Public key:  %s (share, use with pixe convert --recipient)\n", pubPath)
+	fmt.Printf("  Recipient:   %s\n", crypto.EncodeRecipient(pub))
+}
+
+func handleRekey() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: input .pixe file required")
+		fmt.Println("Usage: pixe rekey <input.pixe> [--password-file file | --identity key] [--new-password-prompt] [--recipient key] [--remove-recipient key]")
+		os.Exit(1)
+	}
+
+	inputPath := os.Args[2]
+	outputPath := inputPath
+	identity := ""
+	keyFile := ""
+	signingKey := ""
+	passwordFlag := newPasswordFlags("--password")
+	newPasswordFlag := newPasswordFlags("--new-password")
+	var opts converter.RekeyOptions
+
+	// Parse flags
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 < len(os.Args) {
+				outputPath = os.Args[i+1]
+				i++
+			}
+		case "--identity":
+			if i+1 < len(os.Args) {
+				identity = os.Args[i+1]
+				i++
+			}
+		case "--key-file":
+			if i+1 < len(os.Args) {
+				keyFile = os.Args[i+1]
+				i++
+			}
+		case "--remove-password":
+			opts.RemovePassword = true
+		case "--recipient":
+			if i+1 < len(os.Args) {
+				opts.AddRecipients = append(opts.AddRecipients, os.Args[i+1])
+				i++
+			}
+		case "--remove-recipient":
+			if i+1 < len(os.Args) {
+				opts.RemoveRecipients = append(opts.RemoveRecipients, os.Args[i+1])
+				i++
+			}
+		case "--sign":
+			if i+1 < len(os.Args) {
+				signingKey = os.Args[i+1]
+				i++
+			}
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
+			} else if next, ok := newPasswordFlag.parse(i); ok {
+				i = next
+			}
+		}
+	}
+
+	if opts.RemovePassword && newPasswordFlag.given() {
+		fmt.Fprintln(os.Stderr, "Error: --remove-password cannot be combined with --new-password")
+		os.Exit(1)
+	}
+	// Without an identity or key file the current password unlocks the archive
+	opts.Password = passwordFlag.read(identity == "" && keyFile == "", false)
+	opts.NewPassword = newPasswordFlag.read(false, true)
+
+	// Rekey encodes the frames it rewrites at the archive's own frame rate,
+	// and at its quality when the encoder recorded it; these are defaults
+	cfg := &config.Config{
+		ChunkSize: 2900,
+		FrameRate: 2.0,
+		Quality:   23,
+		TempDir:   "./temp",
+		OutputDir: "./output",
+
+		SigningKeyPath:    signingKey,
+		EncryptionEnabled: true,
+		AllowCostlyKDF:    allowCostlyKDF(),
+		IdentityPath:      identity,
+		DataKeyPath:       keyFile,
+	}
+
+	conv, err := converter.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing converter: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔑 Rekeying %s...\n", inputPath)
+
+	result, err := conv.Rekey(inputPath, outputPath, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rekeying archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Wrote %s, which can now be opened with:\n", outputPath)
+	for _, r := range result.Recipients {
+		if r.Type == crypto.WrapPassword {
+			fmt.Println("  password")
 		} else {
-			failCount++
-			if failCount <= 5 {
-				fmt.Printf("  ❌ Frame %d failed: %v\n", i, err)
+			fmt.Printf("  %s key %s\n", r.Type, r.KeyID)
+		}
+	}
+	if result.SignatureRemoved {
+		fmt.Println("⚠️  The manifest signature was removed; pass --sign to re-sign the archive")
+	}
+	if result.FramesShifted != 0 {
+		fmt.Printf("⚠️  The manifest grew by %d frames, moving the payload; rebuild search indexes with pixe index\n", result.FramesShifted)
+	}
+	fmt.Println("Note: anyone who already extracted the archive can still read its content")
+}
+
+func handleKeySplit() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: input .pixe file required")
+		fmt.Println("Usage: pixe keysplit <input.pixe> [--password-file file | --identity key] [--shares N] [--threshold K] [-o dir]")
+		os.Exit(1)
+	}
+
+	inputPath := os.Args[2]
+	outputDir := "./shares"
+	passwordFlag := newPasswordFlags("--password")
+	identity := ""
+	total, threshold := 5, 3
+
+	// Parse flags
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 < len(os.Args) {
+				outputDir = os.Args[i+1]
+				i++
+			}
+		case "--identity":
+			if i+1 < len(os.Args) {
+				identity = os.Args[i+1]
+				i++
+			}
+		case "--shares", "--threshold":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s requires a number\n", os.Args[i])
+					os.Exit(1)
+				}
+				if os.Args[i] == "--shares" {
+					total = n
+				} else {
+					threshold = n
+				}
+				i++
+			}
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
 			}
 		}
+	}
+	password := passwordFlag.read(identity == "", false)
+
+	cfg := &config.Config{
+		ChunkSize: 2900,
+		FrameRate: 2.0,
+		Quality:   23,
+		TempDir:   "./temp",
+		OutputDir: outputDir,
+
+		EncryptionEnabled: true,
+		AllowCostlyKDF:    allowCostlyKDF(),
+		IdentityPath:      identity,
+	}
+
+	conv, err := converter.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing converter: %v\n", err)
+		os.Exit(1)
+	}
+
+	shares, err := conv.SplitDataKey(inputPath, password, threshold, total)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error splitting key: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Each share is saved as its own QR code plus a text copy
+	generator, err := qr.New(outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, share := range shares {
+		name := fmt.Sprintf("share-%d", share.Index)
+		pngPath, err := generator.GenerateText(share.Encode(), name+".png")
+		if err == nil {
+			err = os.WriteFile(filepath.Join(outputDir, name+".txt"), []byte(share.Encode()+"\n"), 0600)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing share %d: %v\n", share.Index, err)
+			os.Exit(1)
+		}
+		fmt.Printf("  Share %d of %d: %s\n", share.Index, share.Total, pngPath)
+	}
+
+	fmt.Printf("✓ Split the key of archive %s into %d shares, any %d of which can open it\n",
+		shares[0].ArchiveID, total, threshold)
+	fmt.Println("Give each share to a different custodian and delete this folder afterwards")
+}
+
+func handleKeyCombine() {
+	outputPath := ""
+	var shares []crypto.Share
 
-		if (i+1)%10 == 0 || i == frameCount-1 {
-			fmt.Printf("\rProgress: %d/%d frames (%.1f%% success)",
-				i+1, frameCount, float64(successCount)/float64(i+1)*100)
+	// Parse shares and flags
+	for i := 2; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 < len(os.Args) {
+				outputPath = os.Args[i+1]
+				i++
+			}
+		default:
+			share, err := readShare(os.Args[i])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading share %s: %v\n", os.Args[i], err)
+				os.Exit(1)
+			}
+			shares = append(shares, share)
 		}
 	}
 
-	fmt.Printf("\n\n")
+	if outputPath == "" || len(shares) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: shares and -o <key file> required")
+		fmt.Println("Usage: pixe keycombine <share.png|share.txt>... -o <archive.datakey>")
+		os.Exit(1)
+	}
 
-	if failCount == 0 {
-		fmt.Printf("✅ All %d frames verified successfully!\n", frameCount)
-		fmt.Println("File integrity: GOOD")
-	} else {
-		fmt.Printf("⚠️  %d/%d frames failed verification\n", failCount, frameCount)
-		fmt.Println("File integrity: DEGRADED")
+	key, err := crypto.CombineShares(shares)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error combining shares: %v\n", err)
+		os.Exit(1)
+	}
+	if err := crypto.WriteDataKey(outputPath, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing key: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Recovered the key of archive %s from %d shares\n", shares[0].ArchiveID, len(shares))
+	fmt.Printf("  Key file: %s (keep secret, use with pixe extract --key-file)\n", outputPath)
+}
+
+// readShare loads a key share from a QR image or a text file
+func readShare(path string) (crypto.Share, error) {
+	var text string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg":
+		decoded, err := qr.DecodeTextFile(path)
+		if err != nil {
+			return crypto.Share{}, err
+		}
+		text = decoded
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return crypto.Share{}, err
+		}
+		text = string(data)
 	}
+	return crypto.ParseShare(text)
 }
 
 // ============================================================================
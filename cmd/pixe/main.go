@@ -1,10 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/ArqonAi/Pixelog/internal/converter"
+	"github.com/ArqonAi/Pixelog/internal/crypto"
+	"github.com/ArqonAi/Pixelog/internal/paper"
+	"github.com/ArqonAi/Pixelog/internal/video"
 	"github.com/ArqonAi/Pixelog/pkg/config"
 )
 
@@ -21,10 +28,18 @@ func main() {
 		handleConvert()
 	case "extract":
 		handleExtract()
+	case "capture":
+		handleCapture()
+	case "print":
+		handlePrint()
+	case "scan":
+		handleScan()
 	case "index":
 		handleIndex()
 	case "search":
 		handleSearch()
+	case "cache":
+		handleCache()
 	case "version":
 		handleVersion()
 	case "versions":
@@ -39,6 +54,16 @@ func main() {
 		handleInfo()
 	case "verify":
 		handleVerify()
+	case "keygen":
+		handleKeygen()
+	case "rekey":
+		handleRekey()
+	case "keysplit":
+		handleKeySplit()
+	case "keycombine":
+		handleKeyCombine()
+	case "keyring":
+		handleKeyring()
 	case "help", "--help", "-h":
 		printUsage()
 	default:
@@ -48,6 +73,22 @@ func main() {
 	}
 }
 
+// allowCostlyKDF reports whether key derivation costs past the default
+// bounds were lifted with PIXELOG_ALLOW_COSTLY_KDF=1, for archives from a
+// trusted source
+func allowCostlyKDF() bool {
+	return os.Getenv("PIXELOG_ALLOW_COSTLY_KDF") == "1"
+}
+
+// kdfLimits returns the key derivation costs accepted from archives opened
+// without a converter
+func kdfLimits() crypto.KDFLimits {
+	if allowCostlyKDF() {
+		return crypto.CostlyKDFLimits
+	}
+	return crypto.DefaultKDFLimits
+}
+
 func formatSize(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
@@ -68,13 +109,23 @@ Basic Commands:
   pixe convert <input> [options]    Convert file to .pixe format
     --stream                        Use streaming mode for large files (constant memory)
   pixe extract <input> [options]    Extract content from .pixe file
+  pixe capture <video> [options]    Recover a .pixe from a camera recording of it playing
+  pixe print <input> [options]      Print a .pixe as QR code pages (PDF)
+  pixe scan <folder> [options]      Recover files from scanned printed pages
   pixe info <input>                 Show detailed file information
-  pixe verify <input>               Verify file integrity
+  pixe verify <input> [--json]      Verify per-file integrity (OK, CORRUPT, INCOMPLETE)
+  pixe keygen [-o <name>]           Generate an Ed25519 key pair for signing archives
+    --encryption                    Generate an X25519 key pair for receiving archives
+  pixe rekey <input> [options]      Change passwords or recipients without reconverting
+  pixe keysplit <input> [options]   Split an archive's key into printable QR shares
+  pixe keycombine <share>... -o <f> Recover the key from enough shares (PNG or text)
+  pixe keyring set|delete <name>    Store a password in the OS keyring (prompted for)
 
 Smart Indexing:
   pixe index <input>                Build vector index for fast search
-  pixe search <input> <query>       Semantic search in .pixe file
+  pixe search <input> <query>       Semantic and keyword search in .pixe file
   pixe chat <input> [options]       Interactive LLM chat with memory
+  pixe cache stats|prune            Show or shrink the embedding cache
 
 Version Control (Git for QR codes):
   pixe version <input> [options]    Create new version with delta encoding
@@ -88,18 +139,102 @@ Help:
 Convert Options:
   -o, --output <file>               Output file path (default: input.pixe)
   --encrypt                         Enable encryption
-  --password <password>             Password for encryption
+  --encrypt-metadata                Encrypt whole frames, hiding file names,
+                                    types and sizes (implies --encrypt)
+  --password-file <file>            Password for encryption (prompted for if
+                                    --encrypt is given without a recipient)
+  --kdf <argon2id|pbkdf2>           Password key derivation (default: argon2id)
+  --kdf-iterations <N>              Argon2id passes or PBKDF2 iterations
+  --kdf-memory <MiB>                Argon2id memory (default: 64, at most 1024
+                                    unless PIXELOG_ALLOW_COSTLY_KDF=1)
+  --parity <N>                      Add one XOR parity frame per N data frames
+  --sign <key>                      Sign the manifest with an Ed25519 private key
+  --reproducible                    Identical input gives a byte-identical file; timestamps
+                                    come from SOURCE_DATE_EPOCH (default: 1970-01-01)
+  --recipient <key>                 Encrypt to an X25519 public key (file or base64),
+                                    with or without a password; repeatable
 
 Extract Options:
   -o, --output <dir>                Output directory (default: ./output)
-  --password <password>             Password for decryption
+  --password-file <file>            Password for decryption (see Password Options)
+  --identity <key>                  X25519 private key for archives sent to recipients
+  --key-file <file>                 Data key recovered with pixe keycombine
+  --salvage                         Write partial files for damaged archives
+                                    (zero-filled gaps + .missing sidecar)
+
+Capture Options:
+  -o, --output <dir>                Output directory (default: ./output)
+  --password-file <file>            Password for decryption (see Password Options)
+  --fps <N>                         Sample the recording at N frames per second
+
+Print Options:
+  -o, --output <file>               Output PDF path (default: input.pdf)
+  --paper <a4|letter>               Paper size (default: a4)
+  --grid <COLSxROWS>                QR codes per page (default: 2x3)
+
+Scan Options:
+  -o, --output <dir>                Output directory (default: ./output)
+  --password-file <file>            Password for decryption (see Password Options)
+
+Rekey Options:
+  -o, --output <file>               Write a new archive (default: replace input)
+  --password-file <file>            Current password (prompted for without
+                                    --identity or --key-file)
+  --identity <key>                  Current X25519 private key, instead of a password
+  --key-file <file>                 Data key recovered with pixe keycombine
+  --new-password-prompt             Replace the password; also -file, -fd, -keyring
+  --remove-password                 Drop the password, leaving only recipients
+  --recipient <key>                 Add a recipient public key (repeatable)
+  --remove-recipient <key|id>       Revoke a recipient by public key or key ID
+  --sign <key>                      Re-sign the manifest (signatures are otherwise dropped)
+
+Keysplit Options:
+  --shares <N>                      Number of shares to create (default: 5)
+  --threshold <K>                   Shares needed to recover the key (default: 3)
+  --password-* / --identity         Unlock the archive as for extract
+  -o, --output <dir>                Directory for share-N.png and share-N.txt (default: ./shares)
+
+Verify Options:
+  --json                            Print a machine-readable report
+                                    (exit code 2 if corrupt, 3 if incomplete)
+  --pubkey <key.pub>                Require a signature by this public key
+  --password-file <file>            Password for archives with encrypted metadata
+
+Password Options (any command taking a password):
+  --password-prompt                 Ask on the terminal with echo off
+  --password-file <file>            Read the first line of a file
+  --password-fd <N>                 Read the first line from file descriptor N
+  --password-keyring <name>         Use a password stored with pixe keyring set
 
 Index Options:
-  --provider <provider>             Embedding provider (openai, mock)
+  --provider <provider>             Embedding provider: openai, openrouter, gemini,
+                                    ollama or local (default: the first with an
+                                    API key, else local, which works offline)
   --api-key <key>                   API key for embeddings
+  --vectors <format>                Stored vectors: float32 (default), float16,
+                                    int8 (4x smaller) or pq (32x smaller); the
+                                    file shrinks, but searches still hold
+                                    float32 vectors in memory
+  --pq-subspaces <N>                PQ codes per vector (default: dimensions / 8)
+  --no-rerank                       Don't keep exact vectors for re-ranking
+                                    int8 and pq results
+  --batch-size <N>                  Passages per embedding request (default: 64)
+  --concurrency <N>                 Embedding requests in flight (default: 4)
+  --rate <N>                        Embedding requests per second (default: no limit)
+  --allow-partial                   Save the index even if some passages fail
+                                    to embed, listing their frames
+
+Cache Options:
+  --max-size <MB>                   Prune down to this size (default: the limit,
+                                    EMBEDDING_CACHE_MAX_MB or 1024)
+  --all                             Remove every cached embedding
 
 Search Options:
   --top <N>                         Return top N results (default: 5)
+  --mode <mode>                     hybrid (default), semantic (meaning only) or
+                                    lexical (exact words, no API key needed)
+  --rerank <N>                      Candidates re-ranked exactly in int8 and pq
+                                    indexes (default: 100)
 
 Version Options:
   -m, --message <message>           Version commit message
@@ -127,8 +262,34 @@ Examples:
   pixe query doc.pixe 1 "what was in version 1?"
   
   # Encryption
-  pixe convert secret.txt -o secret.pixe --encrypt --password mypass123
-  pixe extract secret.pixe -o ./extracted --password mypass123`)
+  pixe convert secret.txt -o secret.pixe --encrypt          # prompts for a password
+  pixe extract secret.pixe -o ./extracted --password-prompt
+  pixe convert ./contracts -o legal.pixe --encrypt-metadata --password-file pass.txt
+  pixe keyring set legal && pixe extract legal.pixe --password-keyring legal
+
+  # Signed archives
+  pixe keygen -o records
+  pixe convert records.pdf -o records.pixe --sign records.key
+  pixe verify records.pixe --pubkey records.pub
+
+  # Sharing with a team instead of a password
+  pixe keygen --encryption -o alice
+  pixe convert plans.pdf -o plans.pixe --recipient alice.pub --recipient bob.pub
+  pixe extract plans.pixe -o ./plans --identity alice.key
+  pixe rekey plans.pixe --identity alice.key --remove-recipient bob.pub --recipient carol.pub
+
+  # Key escrow: any 3 of 5 custodians can open the archive
+  pixe keysplit plans.pixe --identity alice.key --shares 5 --threshold 3 -o ./shares
+  pixe keycombine share-1.png share-4.png share-5.txt -o plans.datakey
+  pixe extract plans.pixe -o ./plans --key-file plans.datakey
+
+  # Phone recording of a screen playing the archive
+  pixe convert notes.md -o notes.pixe --parity 4
+  pixe capture recording.mp4 -o ./recovered
+
+  # Paper backup
+  pixe print notes.pixe -o notes.pdf --paper letter
+  pixe scan ./scanned-pages -o ./recovered`)
 }
 
 func handleConvert() {
@@ -140,9 +301,17 @@ func handleConvert() {
 
 	inputPath := os.Args[2]
 	outputPath := ""
-	password := ""
+	passwordFlag := newPasswordFlags("--password")
 	encrypt := false
+	encryptMetadata := false
 	useStreaming := false
+	reproducible := false
+	parity := 0
+	signingKey := ""
+	kdf := ""
+	kdfIterations := 0
+	kdfMemory := 0
+	var recipients []string
 
 	// Parse flags
 	for i := 3; i < len(os.Args); i++ {
@@ -154,13 +323,57 @@ func handleConvert() {
 			}
 		case "--encrypt":
 			encrypt = true
-		case "--password":
+		case "--encrypt-metadata":
+			encrypt = true
+			encryptMetadata = true
+		case "--stream":
+			useStreaming = true
+		case "--reproducible":
+			reproducible = true
+		case "--parity":
 			if i+1 < len(os.Args) {
-				password = os.Args[i+1]
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n < 2 {
+					fmt.Fprintln(os.Stderr, "Error: --parity requires a group size of at least 2")
+					os.Exit(1)
+				}
+				parity = n
 				i++
 			}
-		case "--stream":
-			useStreaming = true
+		case "--sign":
+			if i+1 < len(os.Args) {
+				signingKey = os.Args[i+1]
+				i++
+			}
+		case "--recipient":
+			if i+1 < len(os.Args) {
+				recipients = append(recipients, os.Args[i+1])
+				encrypt = true
+				i++
+			}
+		case "--kdf":
+			if i+1 < len(os.Args) {
+				kdf = os.Args[i+1]
+				i++
+			}
+		case "--kdf-iterations", "--kdf-memory":
+			if i+1 < len(os.Args) {
+				n, err := strconv.Atoi(os.Args[i+1])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "Error: %s requires a positive number\n", os.Args[i])
+					os.Exit(1)
+				}
+				if os.Args[i] == "--kdf-iterations" {
+					kdfIterations = n
+				} else {
+					kdfMemory = n
+				}
+				i++
+			}
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
+			}
 		}
 	}
 
@@ -168,11 +381,35 @@ func handleConvert() {
 		outputPath = inputPath + ".pixe"
 	}
 
-	if encrypt && password == "" {
-		fmt.Fprintln(os.Stderr, "Error: --password required when using --encrypt")
+	if len(recipients) > 0 && encryptMetadata {
+		fmt.Fprintln(os.Stderr, "Error: --recipient cannot be combined with --encrypt-metadata")
+		os.Exit(1)
+	}
+
+	if reproducible && encrypt {
+		fmt.Fprintln(os.Stderr, "Error: --reproducible cannot be combined with encryption, which is randomized")
 		os.Exit(1)
 	}
 
+	// Without recipients a password is required, so ask for one
+	password := passwordFlag.read(encrypt && len(recipients) == 0, true)
+
+	// Check recipient keys up front as well
+	for _, r := range recipients {
+		if _, err := crypto.ParseRecipient(r); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Check the key up front rather than after a long conversion
+	if signingKey != "" {
+		if _, err := crypto.LoadSigningKey(signingKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Initialize converter
 	cfg := &config.Config{
 		ChunkSize: 2900,
@@ -181,6 +418,17 @@ func handleConvert() {
 		Verbose:   true,
 		TempDir:   "./temp",
 		OutputDir: "./output",
+
+		ParityGroupSize:   parity,
+		SigningKeyPath:    signingKey,
+		Reproducible:      reproducible,
+		EncryptionEnabled: encrypt,
+		AllowCostlyKDF:    allowCostlyKDF(),
+		EncryptMetadata:   encryptMetadata,
+		KDF:               kdf,
+		KDFIterations:     kdfIterations,
+		KDFMemoryMiB:      kdfMemory,
+		Recipients:        recipients,
 	}
 
 	conv, err := converter.New(cfg)
@@ -241,7 +489,10 @@ func handleExtract() {
 
 	inputPath := os.Args[2]
 	outputDir := "./output"
-	password := ""
+	passwordFlag := newPasswordFlags("--password")
+	identity := ""
+	keyFile := ""
+	salvage := false
 
 	// Parse flags
 	for i := 3; i < len(os.Args); i++ {
@@ -251,13 +502,25 @@ func handleExtract() {
 				outputDir = os.Args[i+1]
 				i++
 			}
-		case "--password":
+		case "--identity":
 			if i+1 < len(os.Args) {
-				password = os.Args[i+1]
+				identity = os.Args[i+1]
 				i++
 			}
+		case "--key-file":
+			if i+1 < len(os.Args) {
+				keyFile = os.Args[i+1]
+				i++
+			}
+		case "--salvage":
+			salvage = true
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
+			}
 		}
 	}
+	password := passwordFlag.read(false, false)
 
 	// Initialize converter
 	cfg := &config.Config{
@@ -267,6 +530,11 @@ func handleExtract() {
 		Verbose:   true,
 		TempDir:   "./temp",
 		OutputDir: outputDir,
+
+		EncryptionEnabled: password != "" || identity != "" || keyFile != "",
+		AllowCostlyKDF:    allowCostlyKDF(),
+		IdentityPath:      identity,
+		DataKeyPath:       keyFile,
 	}
 
 	conv, err := converter.New(cfg)
@@ -278,11 +546,284 @@ func handleExtract() {
 	fmt.Printf("Extracting %s to %s...\n", inputPath, outputDir)
 
 	// Extract
-	err = conv.Extract(inputPath, outputDir, password)
+	report, err := conv.ExtractWithReport(inputPath, outputDir, video.ExtractOptions{Salvage: salvage}, password)
+	if err != nil {
+		// Files are only saved once every chunk is there, unless salvaging
+		if !salvage && (report == nil || len(report.Files) == 0) {
+			fmt.Fprintln(os.Stderr, "Hint: use --salvage to recover what is left of damaged files")
+		}
+		exitExtractError("extracting file", report, err)
+	}
+
+	if salvage {
+		printExtractReport(report)
+	}
+
+	if report.Complete() {
+		fmt.Printf("✓ Successfully extracted to %s\n", outputDir)
+	} else {
+		fmt.Printf("⚠️  Partially extracted to %s (see .missing files for gaps)\n", outputDir)
+	}
+}
+
+func handleCapture() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: recording file required")
+		printUsage()
+		os.Exit(1)
+	}
+
+	inputPath := os.Args[2]
+	outputDir := "./output"
+	passwordFlag := newPasswordFlags("--password")
+	var opts video.CaptureOptions
+
+	// Parse flags
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 < len(os.Args) {
+				outputDir = os.Args[i+1]
+				i++
+			}
+		case "--fps":
+			if i+1 < len(os.Args) {
+				fps, err := strconv.ParseFloat(os.Args[i+1], 64)
+				if err != nil || fps <= 0 {
+					fmt.Fprintln(os.Stderr, "Error: --fps requires a positive number")
+					os.Exit(1)
+				}
+				opts.SampleRate = fps
+				i++
+			}
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
+			}
+		}
+	}
+	password := passwordFlag.read(false, false)
+
+	// Initialize converter
+	cfg := &config.Config{
+		ChunkSize: 2900,
+		FrameRate: 2.0,
+		Quality:   23,
+		Verbose:   true,
+		TempDir:   "./temp",
+		OutputDir: outputDir,
+
+		EncryptionEnabled: password != "",
+		AllowCostlyKDF:    allowCostlyKDF(),
+	}
+
+	conv, err := converter.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing converter: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔍 Scanning recording %s for QR frames...\n", inputPath)
+
+	report, err := conv.Capture(inputPath, outputDir, opts, password)
+	if err != nil {
+		exitExtractError("decoding capture", report, err)
+	}
+
+	printExtractReport(report)
+
+	if report.Complete() {
+		fmt.Printf("✓ Successfully recovered archive to %s\n", outputDir)
+	} else {
+		fmt.Printf("⚠️  Partially recovered to %s (re-record the missing frames or see .missing files)\n", outputDir)
+	}
+}
+
+func handlePrint() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: input .pixe file required")
+		printUsage()
+		os.Exit(1)
+	}
+
+	inputPath := os.Args[2]
+	outputPath := ""
+	opts := paper.Options{Title: filepath.Base(inputPath)}
+
+	// Parse flags
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 < len(os.Args) {
+				outputPath = os.Args[i+1]
+				i++
+			}
+		case "--paper":
+			if i+1 < len(os.Args) {
+				size, err := paper.PaperSizeByName(os.Args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				opts.Paper = size
+				i++
+			}
+		case "--grid":
+			if i+1 < len(os.Args) {
+				if _, err := fmt.Sscanf(os.Args[i+1], "%dx%d", &opts.Columns, &opts.Rows); err != nil || opts.Columns < 1 || opts.Rows < 1 {
+					fmt.Fprintln(os.Stderr, "Error: --grid expects COLSxROWS, e.g. 2x3")
+					os.Exit(1)
+				}
+				i++
+			}
+		}
+	}
+
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".pdf"
+	}
+
+	// Initialize converter
+	cfg := &config.Config{
+		ChunkSize: 2900,
+		FrameRate: 2.0,
+		Quality:   23,
+		Verbose:   true,
+		TempDir:   "./temp",
+		OutputDir: "./output",
+	}
+
+	conv, err := converter.New(cfg)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error extracting file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error initializing converter: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("✓ Successfully extracted to %s\n", outputDir)
+	fmt.Printf("🖨️  Printing %s to %s...\n", inputPath, outputPath)
+
+	scan, err := conv.Print(inputPath, outputPath, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error printing archive: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(scan.FailedFrames) > 0 {
+		fmt.Printf("⚠️  %d frames could not be read and are not in the printout: %v\n", len(scan.FailedFrames), scan.FailedFrames)
+	}
+	fmt.Printf("✓ Printed %d QR codes to %s\n", len(scan.Chunks), outputPath)
+}
+
+func handleScan() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: folder of scanned pages required")
+		printUsage()
+		os.Exit(1)
+	}
+
+	scanDir := os.Args[2]
+	outputDir := "./output"
+	passwordFlag := newPasswordFlags("--password")
+
+	// Parse flags
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "-o", "--output":
+			if i+1 < len(os.Args) {
+				outputDir = os.Args[i+1]
+				i++
+			}
+		default:
+			if next, ok := passwordFlag.parse(i); ok {
+				i = next
+			}
+		}
+	}
+	password := passwordFlag.read(false, false)
+
+	// Initialize converter
+	cfg := &config.Config{
+		ChunkSize: 2900,
+		FrameRate: 2.0,
+		Quality:   23,
+		Verbose:   true,
+		TempDir:   "./temp",
+		OutputDir: outputDir,
+
+		EncryptionEnabled: password != "",
+		AllowCostlyKDF:    allowCostlyKDF(),
+	}
+
+	conv, err := converter.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing converter: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔍 Scanning pages in %s...\n", scanDir)
+
+	report, err := conv.Scan(scanDir, outputDir, password)
+	if err != nil {
+		exitExtractError("scanning pages", report, err)
+	}
+
+	fmt.Printf("\nPages: %d with QR codes (of %d)\n", report.DecodedFrames, report.TotalFrames)
+	printFileReports(report)
+
+	if report.Complete() {
+		fmt.Printf("✓ Successfully recovered archive to %s\n", outputDir)
+	} else {
+		fmt.Printf("⚠️  Partially recovered to %s (rescan the pages listed in the manifest or see .missing files)\n", outputDir)
+	}
+}
+
+// exitExtractError lists the outcome of every file a failed extraction got
+// to, with the reason each one failed, and exits
+func exitExtractError(action string, report *video.ExtractReport, err error) {
+	if report != nil && len(report.Files) > 0 {
+		printFileReports(report)
+	}
+	fmt.Fprintf(os.Stderr, "Error %s: %v\n", action, err)
+	if errors.Is(err, converter.ErrNoCredentials) || errors.Is(err, video.ErrSealed) {
+		fmt.Fprintln(os.Stderr, "Hint: the archive is encrypted, give its password with --password-prompt or --password-file")
+	}
+	os.Exit(1)
+}
+
+func printExtractReport(report *video.ExtractReport) {
+	fmt.Printf("\nFrames: %d decoded, %d failed (of %d)\n",
+		report.DecodedFrames, len(report.FailedFrames), report.TotalFrames)
+	if len(report.FailedFrames) > 0 {
+		fmt.Printf("Failed frames: %v\n", report.FailedFrames)
+	}
+
+	printFileReports(report)
+}
+
+func printFileReports(report *video.ExtractReport) {
+	fmt.Println("\nFiles:")
+	for _, file := range report.Files {
+		switch file.Status {
+		case video.FileComplete:
+			fmt.Printf("  ✓ %s (%d chunks)\n", file.Name, file.TotalChunks)
+			if len(file.RepairedIndices) > 0 {
+				fmt.Printf("    repaired from parity: %v\n", file.RepairedIndices)
+			}
+		case video.FilePartial:
+			fmt.Printf("  ⚠️  %s: %d/%d chunks, missing %v\n",
+				file.Name, file.RecoveredChunks, file.TotalChunks, file.MissingIndices)
+		default:
+			fmt.Printf("  ❌ %s: %s\n", file.Name, file.Error)
+		}
+	}
+	fmt.Println()
 }
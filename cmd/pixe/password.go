@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ArqonAi/Pixelog/internal/secret"
+)
+
+// passwordFlags collects the ways a command can be given a password:
+//
+//	--password-file <file>   first line of a file
+//	--password-fd <n>        first line read from an inherited descriptor
+//	--password-keyring <n>   entry stored with pixe keyring set
+//	--password-prompt        ask on the terminal with echo off
+//
+// The same forms exist under other names, such as --new-password for rekey.
+// A password given as the argument of the bare flag is refused, since it
+// would end up in shell history and process lists.
+type passwordFlags struct {
+	flag    string
+	file    string
+	fd      int
+	keyring string
+	prompt  bool
+}
+
+func newPasswordFlags(flag string) *passwordFlags {
+	return &passwordFlags{flag: flag, fd: -1}
+}
+
+// parse handles os.Args[i] if it is one of the password flags and returns
+// the index of the last argument it used
+func (p *passwordFlags) parse(i int) (int, bool) {
+	suffix, ok := strings.CutPrefix(os.Args[i], p.flag)
+	if !ok {
+		return i, false
+	}
+	switch suffix {
+	case "-prompt":
+		p.prompt = true
+		return i, true
+	case "":
+		fmt.Fprintf(os.Stderr, "Error: passwords are not accepted on the command line, where shell history and process lists expose them; use %[1]s-prompt, %[1]s-file, %[1]s-fd or %[1]s-keyring\n", p.flag)
+		os.Exit(1)
+	case "-file", "-fd", "-keyring":
+	default:
+		return i, false
+	}
+
+	if i+1 >= len(os.Args) {
+		return i, true
+	}
+	value := os.Args[i+1]
+	switch suffix {
+	case "-file":
+		p.file = value
+	case "-fd":
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 0 {
+			fmt.Fprintf(os.Stderr, "Error: %s-fd requires a file descriptor number\n", p.flag)
+			os.Exit(1)
+		}
+		p.fd = fd
+	case "-keyring":
+		p.keyring = value
+	}
+	return i + 1, true
+}
+
+// given reports whether any source was specified
+func (p *passwordFlags) given() bool {
+	return p.file != "" || p.fd >= 0 || p.keyring != "" || p.prompt
+}
+
+// read returns the password from the specified source. Without one it
+// prompts if required is set and returns "" otherwise. New passwords are
+// prompted for twice. Errors are fatal.
+func (p *passwordFlags) read(required, confirm bool) string {
+	sources := 0
+	for _, set := range []bool{p.file != "", p.fd >= 0, p.keyring != "", p.prompt} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fmt.Fprintf(os.Stderr, "Error: give only one of %[1]s-file, %[1]s-fd, %[1]s-keyring and %[1]s-prompt\n", p.flag)
+		os.Exit(1)
+	}
+
+	var password string
+	var err error
+	switch {
+	case p.file != "":
+		password, err = secret.FromFile(p.file)
+	case p.fd >= 0:
+		password, err = secret.FromFD(p.fd)
+	case p.keyring != "":
+		var keyring secret.Keyring
+		if keyring, err = secret.OpenKeyring(); err == nil {
+			password, err = keyring.Get(p.keyring)
+		}
+	case p.prompt || required:
+		label := strings.TrimPrefix(p.flag, "--")
+		label = strings.ToUpper(label[:1]) + strings.ReplaceAll(label[1:], "-", " ") + ": "
+		if confirm {
+			password, err = secret.PromptNew(label)
+		} else {
+			password, err = secret.Prompt(label)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return password
+}
+
+func handleKeyring() {
+	if len(os.Args) < 4 || (os.Args[2] != "set" && os.Args[2] != "delete") {
+		fmt.Println("Usage: pixe keyring set|delete <name> [--password-file file | --password-fd n]")
+		os.Exit(1)
+	}
+	action, name := os.Args[2], os.Args[3]
+
+	keyring, err := secret.OpenKeyring()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening keyring: %v\n", err)
+		os.Exit(1)
+	}
+
+	if action == "delete" {
+		if err := keyring.Delete(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Deleted %s from %s\n", name, keyring.Backend())
+		return
+	}
+
+	password := newPasswordFlags("--password")
+	for i := 4; i < len(os.Args); i++ {
+		if next, ok := password.parse(i); ok {
+			i = next
+		}
+	}
+	if password.keyring != "" {
+		fmt.Fprintln(os.Stderr, "Error: --password-keyring cannot be used to set a keyring entry")
+		os.Exit(1)
+	}
+	value := password.read(true, true)
+
+	if err := keyring.Set(name, value); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("🔑 Stored %s in %s\n", name, keyring.Backend())
+	fmt.Printf("   Use it with --password-keyring %s\n", name)
+}
@@ -11,7 +11,12 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	handlers "github.com/ArqonAi/Pixelog/internal/api"
 	"github.com/ArqonAi/Pixelog/internal/converter"
+	"github.com/ArqonAi/Pixelog/internal/embedding"
+	"github.com/ArqonAi/Pixelog/internal/index"
+	"github.com/ArqonAi/Pixelog/internal/search"
+	"github.com/ArqonAi/Pixelog/internal/secret"
 	"github.com/ArqonAi/Pixelog/pkg/config"
 )
 
@@ -30,20 +35,49 @@ func main() {
 	// Create output directory
 	os.MkdirAll("./output", 0755)
 	
-	// Initialize services
-	cfg := &config.Config{
-		ChunkSize:  2900,
-		FrameRate:  2.0,
-		Quality:    23,
-		Verbose:    false,
-		TempDir:    "./temp",
-		OutputDir:  "./output",
-	}
+	// Initialize services. Embedding settings come from the environment, as
+	// they do for pixe index and search.
+	cfg := config.Default()
+	cfg.Cleanup()
+	cfg.ChunkSize = 2900
+	cfg.FrameRate = 2.0
+	cfg.Quality = 23
+	cfg.Verbose = false
+	cfg.TempDir = "./temp"
+	cfg.OutputDir = "./output"
+	cfg.EncryptionEnabled = true
 	
 	conv, err := converter.New(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize converter: %v", err)
 	}
+
+	// Requests name a password stored with pixe keyring set instead of
+	// sending it. They can only name entries under cfg.KeyRefPrefix, so
+	// "backups" is the entry stored as "server/backups" by default and the
+	// CLI's own passwords stay out of reach.
+	keys, err := secret.OpenKeyring()
+	if err != nil {
+		log.Printf("Keyring unavailable, encrypted conversion disabled: %v", err)
+	} else {
+		keys = secret.Scoped(keys, cfg.KeyRefPrefix)
+	}
+
+	// Search over the indexes of the archives in the output directory,
+	// which pixe index and pixe search share. They are saved as they are
+	// built, so search survives restarts without a separate store.
+	providers := embedding.OptionsFromConfig(cfg)
+	embedder, err := embedding.New(providers)
+	if err != nil {
+		log.Printf("No embedding provider, archives can be searched but not indexed: %v", err)
+	}
+	indexes, err := index.NewIndexer(index.DefaultDir, embedder)
+	if err != nil {
+		log.Fatalf("Failed to initialize indexer: %v", err)
+	}
+	indexes.SetProviders(providers)
+	searchSvc := search.NewSearchService(indexes, cfg.OutputDir)
+	handler := handlers.NewHandler(conv, nil, searchSvc, nil, nil, keys)
 	
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
@@ -59,7 +93,7 @@ func main() {
 			c.JSON(http.StatusOK, gin.H{
 				"status":            "ok",
 				"mode":              "production",
-				"search_enabled":    false,
+				"search_enabled":    true,
 				"encryption_enabled": true,
 				"cloud_enabled":     false,
 				"video_enabled":     true,
@@ -83,6 +117,23 @@ func main() {
 				return
 			}
 
+			// Passwords are referenced by name so they never appear in requests
+			if c.PostForm("password") != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "password is no longer accepted; store it with pixe keyring set and send key_ref"})
+				return
+			}
+			password := ""
+			if ref := c.PostForm("key_ref"); ref != "" {
+				if keys == nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "server has no keyring for key references"})
+					return
+				}
+				if password, err = keys.Get(ref); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown key reference %q", ref)})
+					return
+				}
+			}
+
 			var processedFiles []FileInfo
 			for _, file := range files {
 				// Save uploaded file temporarily
@@ -95,7 +146,6 @@ func main() {
 				outputName := strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename)) + ".pixe"
 				outputPath := filepath.Join("./output", outputName)
 				
-				password := c.PostForm("password")
 				err := conv.Convert(tempPath, outputPath, nil, password)
 				os.Remove(tempPath)
 				
@@ -103,6 +153,9 @@ func main() {
 					log.Printf("Conversion error: %v", err)
 					continue
 				}
+				if _, err := searchSvc.IndexArchive(c.Request.Context(), outputPath); err != nil {
+					log.Printf("Not indexing %s: %v", outputName, err)
+				}
 
 				stat, _ := os.Stat(outputPath)
 				fileInfo := FileInfo{
@@ -126,6 +179,13 @@ func main() {
 			})
 		})
 
+		api.POST("/search", handler.Search)
+		api.GET("/documents", handler.ListDocuments)
+		api.GET("/documents/:id/similar", handler.GetSimilar)
+		api.GET("/search/content", handler.SearchContent)
+		api.GET("/llm/search", handler.LLMSearch)
+		api.POST("/files/:id/index", handler.IndexPixeFile)
+
 		api.GET("/files/:id", func(c *gin.Context) {
 			fileID := c.Param("id")
 			filePath := filepath.Join("./output", fileID+".pixe")
@@ -2,7 +2,9 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,22 +26,24 @@ import (
 	"github.com/ArqonAi/Pixelog/internal/converter"
 	"github.com/ArqonAi/Pixelog/internal/crypto"
 	"github.com/ArqonAi/Pixelog/internal/search"
+	"github.com/ArqonAi/Pixelog/internal/secret"
 	"github.com/ArqonAi/Pixelog/internal/storage"
 )
 
 type Handler struct {
 	converter  *converter.Converter
 	upgrader   *websocket.Upgrader
-	search     *search.SearchService
+	search     *search.SearchService // Indexes of the .pixe files in the output directory, shared with pixe index
 	encryption *crypto.EncryptionService
 	cloud      *storage.CloudService
+	keys       secret.Keyring // Passwords held by the server, referenced by name in requests
 }
 
 type ConvertRequest struct {
-	Quality            int     `json:"quality" form:"quality"`
-	FrameRate          float64 `json:"framerate" form:"framerate"`
-	ChunkSize          int     `json:"chunksize" form:"chunksize"`
-	EncryptionPassword string  `json:"encryption_password" form:"encryption_password"`
+	Quality          int     `json:"quality" form:"quality"`
+	FrameRate        float64 `json:"framerate" form:"framerate"`
+	ChunkSize        int     `json:"chunksize" form:"chunksize"`
+	EncryptionKeyRef string  `json:"encryption_key_ref" form:"encryption_key_ref"` // Name of a password in the server's keyring
 }
 
 type ConvertResponse struct {
@@ -57,21 +61,39 @@ type PixeFile struct {
 	Path      string    `json:"path"`
 }
 
-func NewHandler(conv *converter.Converter, upgrader *websocket.Upgrader, searchSvc *search.SearchService, encSvc *crypto.EncryptionService, cloudSvc *storage.CloudService) *Handler {
+func NewHandler(conv *converter.Converter, upgrader *websocket.Upgrader, searchSvc *search.SearchService, encSvc *crypto.EncryptionService, cloudSvc *storage.CloudService, keys secret.Keyring) *Handler {
 	return &Handler{
 		converter:  conv,
 		upgrader:   upgrader,
 		search:     searchSvc,
 		encryption: encSvc,
 		cloud:      cloudSvc,
+		keys:       keys,
 	}
 }
 
+// resolveKeyRef returns the password the server holds under ref, so that
+// clients never send passwords that could end up in request logs. An empty
+// ref means no password.
+func (h *Handler) resolveKeyRef(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	if h.keys == nil {
+		return "", fmt.Errorf("server has no keyring for key references")
+	}
+	password, err := h.keys.Get(ref)
+	if err != nil {
+		return "", fmt.Errorf("unknown key reference %q", ref)
+	}
+	return password, nil
+}
+
 // Search endpoints
 func (h *Handler) Search(c *gin.Context) {
 	if h.search == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Search service not available. Set OPENAI_API_KEY environment variable.",
+			"error": "Search service not available",
 		})
 		return
 	}
@@ -82,18 +104,31 @@ func (h *Handler) Search(c *gin.Context) {
 		return
 	}
 
-	results, err := h.search.Search(c.Request.Context(), &req)
+	results, unindexed, err := h.search.Search(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(searchStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"results": results,
-		"count":   len(results),
+		"results":   results,
+		"count":     len(results),
+		"unindexed": unindexed,
 	})
 }
 
+// searchStatus is the HTTP status to answer a search service error with
+func searchStatus(err error) int {
+	switch {
+	case errors.Is(err, search.ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, search.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h *Handler) GetSimilar(c *gin.Context) {
 	if h.search == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -116,7 +151,7 @@ func (h *Handler) GetSimilar(c *gin.Context) {
 
 	results, err := h.search.GetSimilarDocuments(c.Request.Context(), documentID, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(searchStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -149,7 +184,7 @@ func (h *Handler) ListDocuments(c *gin.Context) {
 
 	documents, err := h.search.ListDocuments(c.Request.Context(), limit, offset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(searchStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -185,6 +220,18 @@ func (h *Handler) ConvertFile(c *gin.Context) {
 		req.ChunkSize = 2800
 	}
 
+	// Refuse rather than ignore raw passwords, which would otherwise produce
+	// an unencrypted archive
+	if c.PostForm("encryption_password") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "encryption_password is no longer accepted; store the password on the server with pixe keyring set and send encryption_key_ref"})
+		return
+	}
+	password, err := h.resolveKeyRef(req.EncryptionKeyRef)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Create temporary directory for uploaded files
 	tempDir, err := os.MkdirTemp("", "pixelog-upload-*")
 	if err != nil {
@@ -228,48 +275,18 @@ func (h *Handler) ConvertFile(c *gin.Context) {
 		progressChan := make(chan converter.Progress, 10)
 		defer close(progressChan)
 
-		// Index files for search if search service is available
-		if h.search != nil {
-			for _, filePath := range uploadedFiles {
-				file, err := os.Open(filePath)
-				if err != nil {
-					continue // Skip files that can't be opened
-				}
-
-				// Check if file is supported for text extraction
-				if h.search.IsFileSupported(filepath.Base(filePath)) {
-					_, err = file.Seek(0, 0) // Reset file pointer
-					if err != nil {
-						file.Close()
-						continue
-					}
-
-					// Index the file
-					indexReq := &search.IndexRequest{
-						ID:       fmt.Sprintf("%s_%s", jobID, filepath.Base(filePath)),
-						Reader:   file,
-						Filename: filepath.Base(filePath),
-						Metadata: map[string]interface{}{
-							"job_id":     jobID,
-							"file_path":  filePath,
-							"indexed_at": time.Now(),
-						},
-					}
-
-					if err := h.search.IndexFile(c.Request.Context(), indexReq); err != nil {
-						// Log error but don't fail conversion
-						fmt.Printf("Failed to index file %s: %v\n", filePath, err)
-					}
-				}
-				file.Close()
-			}
-		}
-
-		err := h.converter.Convert(inputPath, outputPath, progressChan, req.EncryptionPassword)
+		err := h.converter.Convert(inputPath, outputPath, progressChan, password)
 		if err != nil {
 			fmt.Printf("Conversion error for job %s: %v\n", jobID, err)
-		} else {
-			fmt.Printf("Conversion completed successfully for job %s\n", jobID)
+			return
+		}
+		fmt.Printf("Conversion completed successfully for job %s\n", jobID)
+
+		// Index the archive the way pixe index does; the request is over
+		if h.search != nil {
+			if _, err := h.search.IndexArchive(context.Background(), outputPath); err != nil {
+				fmt.Printf("Failed to index %s: %v\n", outputPath, err)
+			}
 		}
 	}()
 
@@ -497,6 +514,35 @@ func (h *Handler) DeletePixeFile(c *gin.Context) {
 	})
 }
 
+// IndexPixeFile builds the search index of a .pixe file in the output
+// directory, the same index pixe index builds
+func (h *Handler) IndexPixeFile(c *gin.Context) {
+	if h.search == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Search service not available"})
+		return
+	}
+
+	fileID := filepath.Base(c.Param("id"))
+	filePath := filepath.Join(h.converter.GetOutputDir(), fileID+".pixe")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	idx, err := h.search.IndexArchive(c.Request.Context(), filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Indexing failed: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":         fileID,
+		"frames":          idx.TotalFrames,
+		"passages":        idx.Len(),
+		"embedding_model": idx.EmbeddingModel,
+	})
+}
+
 func (h *Handler) SearchContent(c *gin.Context) {
 	query := c.Query("q")
 	limit := c.DefaultQuery("limit", "20")
@@ -505,17 +551,8 @@ func (h *Handler) SearchContent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
 		return
 	}
-
-	// REAL content search through all .pixe files
-	var results []map[string]interface{}
-	outputDir := h.converter.GetOutputDir()
-	if outputDir == "" {
-		outputDir = "./output"
-	}
-
-	files, err := os.ReadDir(outputDir)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read files: %v", err)})
+	if h.search == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Search service not available"})
 		return
 	}
 
@@ -524,74 +561,57 @@ func (h *Handler) SearchContent(c *gin.Context) {
 		limitInt = 20
 	}
 
-	queryLower := strings.ToLower(query)
-	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".pixe") {
-			continue
-		}
+	matches, unindexed, err := h.search.Search(c.Request.Context(), &search.SearchRequest{
+		Query: query,
+		Limit: limitInt,
+		Mode:  c.DefaultQuery("mode", "hybrid"),
+	})
+	if err != nil {
+		c.JSON(searchStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
-		filePath := filepath.Join(outputDir, file.Name())
-		fileInfo, err := os.Stat(filePath)
-		if err != nil {
+	// One result per file, ranked by its best matching frame
+	outputDir := h.converter.GetOutputDir()
+	var results []map[string]interface{}
+	byFile := make(map[string]map[string]interface{})
+	for _, m := range matches {
+		fileID := m.Document.MemoryID
+		if result, ok := byFile[fileID]; ok {
+			result["occurrences"] = result["occurrences"].(int) + 1
 			continue
 		}
-
-		content, err := os.ReadFile(filePath)
+		info, err := os.Stat(filepath.Join(outputDir, fileID+".pixe"))
 		if err != nil {
 			continue
 		}
-
-		fileContent := strings.ToLower(string(content))
-		if strings.Contains(fileContent, queryLower) {
-			// Calculate relevance
-			occurrences := strings.Count(fileContent, queryLower)
-			totalWords := len(strings.Fields(fileContent))
-			relevance := float64(occurrences) / float64(totalWords)
-			if relevance > 1.0 {
-				relevance = 1.0
-			}
-
-			// Get file size
-			fileSize := formatFileSize(fileInfo.Size())
-
-			results = append(results, map[string]interface{}{
-				"id":           strings.TrimSuffix(file.Name(), ".pixe"),
-				"filename":     file.Name(),
-				"size":         fileSize,
-				"relevance":    relevance,
-				"occurrences":  occurrences,
-				"total_words":  totalWords,
-				"modified":     fileInfo.ModTime(),
-			})
-
-			if len(results) >= limitInt {
-				break
-			}
-		}
-	}
-
-	// Sort by relevance
-	for i := 0; i < len(results); i++ {
-		for j := i + 1; j < len(results); j++ {
-			if results[i]["relevance"].(float64) < results[j]["relevance"].(float64) {
-				results[i], results[j] = results[j], results[i]
-			}
+		result := map[string]interface{}{
+			"id":          fileID,
+			"filename":    fileID + ".pixe",
+			"size":        formatFileSize(info.Size()),
+			"relevance":   m.Score,
+			"occurrences": 1,
+			"modified":    info.ModTime(),
 		}
+		byFile[fileID] = result
+		results = append(results, result)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"query":   query,
-		"results": results,
-		"total":   len(results),
-		"limit":   limit,
+		"query":     query,
+		"results":   results,
+		"total":     len(results),
+		"limit":     limit,
+		"unindexed": unindexed,
 	})
 }
 
 // LLM Memory Processing
 type ProcessMemoryRequest struct {
-	FileIDs       []string `json:"file_ids"`
-	FileNames     []string `json:"file_names"`
-	DecryptionKey string   `json:"decryption_key,omitempty"`
+	FileIDs          []string `json:"file_ids"`
+	FileNames        []string `json:"file_names"`
+	DecryptionKey    string   `json:"decryption_key,omitempty"`     // Refused, passwords are sent as references
+	DecryptionKeyRef string   `json:"decryption_key_ref,omitempty"` // Name of a password in the server's keyring
 }
 
 type ProcessedMemory struct {
@@ -619,6 +639,14 @@ func (h *Handler) ProcessLLMMemories(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
 		return
 	}
+	if req.DecryptionKey != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decryption_key is no longer accepted; store the password on the server with pixe keyring set and send decryption_key_ref"})
+		return
+	}
+	if _, err := h.resolveKeyRef(req.DecryptionKeyRef); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var memories []ProcessedMemory
 	outputDir := h.converter.GetOutputDir()
@@ -671,7 +699,7 @@ func (h *Handler) ProcessLLMMemories(c *gin.Context) {
 			Chunks:    chunks,
 			Size:      fileInfo.Size(),
 			Status:    "ready",
-			Encrypted: req.DecryptionKey != "",
+			Encrypted: req.DecryptionKeyRef != "",
 		}
 
 		memories = append(memories, memory)
@@ -687,12 +715,12 @@ func (h *Handler) ProcessLLMMemories(c *gin.Context) {
 
 // LLM Chat endpoint
 type ChatRequest struct {
-	Query              string   `json:"query"`
-	MemoryIDs          []string `json:"memory_ids"`
-	Provider           string   `json:"provider"`
-	Model              string   `json:"model"`
-	APIKey             string   `json:"api_key"`
-	DecryptionPassword string   `json:"decryption_password,omitempty"`
+	Query            string   `json:"query"`
+	MemoryIDs        []string `json:"memory_ids"`
+	Provider         string   `json:"provider"`
+	Model            string   `json:"model"`
+	APIKey           string   `json:"api_key"`
+	DecryptionKeyRef string   `json:"decryption_key_ref,omitempty"` // Name of a password in the server's keyring
 }
 
 type ChatResponse struct {
@@ -715,6 +743,12 @@ func (h *Handler) LLMChat(c *gin.Context) {
 		return
 	}
 
+	password, err := h.resolveKeyRef(req.DecryptionKeyRef)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Prepare context for LLM
 	var prompt string
 	
@@ -766,7 +800,7 @@ func (h *Handler) LLMChat(c *gin.Context) {
 			}
 			defer os.RemoveAll(tempDir)
 			
-			err = h.converter.Extract(filePath, tempDir, req.DecryptionPassword)
+			err = h.converter.Extract(filePath, tempDir, password)
 			if err != nil {
 				fmt.Printf("Error extracting content from %s: %v\n", filePath, err)
 				continue
@@ -833,87 +867,37 @@ func (h *Handler) LLMSearch(c *gin.Context) {
 		return
 	}
 
-	// REAL search implementation through processed .pixe files
-	var results []map[string]interface{}
-	outputDir := h.converter.GetOutputDir()
-	if outputDir == "" {
-		outputDir = "./output"
-	}
-
-	// Read all .pixe files and search through their content
-	files, err := os.ReadDir(outputDir)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read output directory: %v", err)})
-		return
-	}
-
 	limitInt, _ := strconv.Atoi(limit)
 	if limitInt <= 0 {
 		limitInt = 10
 	}
 
-	queryLower := strings.ToLower(query)
-	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".pixe") {
-			continue
-		}
-
-		// Skip if looking for specific memory and this isn't it
-		fileID := strings.TrimSuffix(file.Name(), ".pixe")
-		if memoryID != "" && fileID != memoryID {
-			continue
-		}
-
-		filePath := filepath.Join(outputDir, file.Name())
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			continue
-		}
-
-		fileContent := strings.ToLower(string(content))
-		if strings.Contains(fileContent, queryLower) {
-			// Calculate simple relevance score
-			occurrences := strings.Count(fileContent, queryLower)
-			relevance := float64(occurrences) / float64(len(strings.Fields(fileContent)))
-			if relevance > 1.0 {
-				relevance = 1.0
-			}
-
-			// Extract context around the match
-			contextStart := strings.Index(fileContent, queryLower)
-			contextLength := 200
-			start := contextStart - contextLength/2
-			if start < 0 {
-				start = 0
-			}
-			end := start + contextLength
-			if end > len(fileContent) {
-				end = len(fileContent)
-			}
-			context := string(content[start:end])
-
-			results = append(results, map[string]interface{}{
-				"content":      context,
-				"filename":     file.Name(),
-				"file_id":      fileID,
-				"relevance":    relevance,
-				"occurrences":  occurrences,
-				"match_start":  contextStart,
-			})
-
-			if len(results) >= limitInt {
-				break
-			}
-		}
+	if h.search == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Search service not available"})
+		return
+	}
+	matches, unindexed, err := h.search.Search(c.Request.Context(), &search.SearchRequest{
+		Query:    query,
+		Limit:    limitInt,
+		Mode:     c.DefaultQuery("mode", "hybrid"),
+		MemoryID: memoryID,
+	})
+	if err != nil {
+		c.JSON(searchStatus(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	// Sort by relevance (highest first)
-	for i := 0; i < len(results); i++ {
-		for j := i + 1; j < len(results); j++ {
-			if results[i]["relevance"].(float64) < results[j]["relevance"].(float64) {
-				results[i], results[j] = results[j], results[i]
-			}
-		}
+	var results []map[string]interface{}
+	for _, m := range matches {
+		results = append(results, map[string]interface{}{
+			"content":      m.Document.Content,
+			"filename":     m.Document.MemoryID + ".pixe",
+			"file_id":      m.Document.MemoryID,
+			"source_file":  m.Document.SourceFile,
+			"frame_number": m.Document.FrameNumber,
+			"relevance":    m.Score,
+			"match_start":  m.Document.Offset,
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -922,6 +906,7 @@ func (h *Handler) LLMSearch(c *gin.Context) {
 		"limit":     limit,
 		"memory_id": memoryID,
 		"total":     len(results),
+		"unindexed": unindexed,
 	})
 }
 
@@ -1487,6 +1472,9 @@ func (h *Handler) extractPixeContent(filePath string) (string, error) {
 			fmt.Printf("DEBUG: Failed to decode QR from frame %s: %v\n", frameFile, err)
 			continue  
 		}
+		if !chunk.IsData() {
+			continue // Parity frames only matter for damaged archives
+		}
 		fmt.Printf("DEBUG: Successfully decoded QR chunk %d from frame %s\n", chunk.Index, frameFile)
 		allChunks = append(allChunks, *chunk)
 	}
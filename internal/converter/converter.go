@@ -1,8 +1,11 @@
 package converter
 
 import (
+	"crypto/ecdh"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"mime"
 	"os"
@@ -12,6 +15,7 @@ import (
 	"time"
 
 	"github.com/ArqonAi/Pixelog/internal/crypto"
+	"github.com/ArqonAi/Pixelog/internal/paper"
 	"github.com/ArqonAi/Pixelog/internal/qr"
 	"github.com/ArqonAi/Pixelog/internal/video"
 	"github.com/ArqonAi/Pixelog/pkg/config"
@@ -22,6 +26,7 @@ type Converter struct {
 	qrGenerator   *qr.Generator
 	videoMaker    *video.Maker
 	cryptoService *crypto.EncryptionService
+	kdf           crypto.KDFParams
 	mu            sync.RWMutex
 	jobs          map[string]*Job
 }
@@ -76,17 +81,63 @@ func New(cfg *config.Config) (*Converter, error) {
 	}
 
 	// Initialize crypto service
+	kdf, err := kdfParams(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 	cryptoService := crypto.NewEncryptionService(cfg.EncryptionEnabled)
+	cryptoService.SetKDFLimits(KDFLimits(cfg))
+	if err := cryptoService.SetKDF(kdf); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 
 	return &Converter{
 		config:        cfg,
 		qrGenerator:   qrGen,
 		videoMaker:    videoMaker,
 		cryptoService: cryptoService,
+		kdf:           kdf,
 		jobs:          make(map[string]*Job),
 	}, nil
 }
 
+// kdfParams builds the key derivation settings for new archives, starting
+// from the algorithm's defaults and applying any configured costs
+func kdfParams(cfg *config.Config) (crypto.KDFParams, error) {
+	params := crypto.DefaultKDF
+	if cfg.KDF != "" {
+		algorithm, err := crypto.ParseKDFAlgorithm(cfg.KDF)
+		if err != nil {
+			return params, err
+		}
+		if algorithm == crypto.KDFPBKDF2 {
+			params = crypto.DefaultPBKDF2
+		}
+	}
+
+	if cfg.KDFIterations > 0 {
+		params.Iterations = uint32(cfg.KDFIterations)
+	}
+	if params.Algorithm == crypto.KDFArgon2id {
+		if cfg.KDFMemoryMiB > 0 {
+			params.Memory = uint32(cfg.KDFMemoryMiB) * 1024
+		}
+		if cfg.KDFThreads > 0 {
+			params.Threads = uint8(cfg.KDFThreads)
+		}
+	}
+	return params, params.Validate(KDFLimits(cfg))
+}
+
+// KDFLimits returns the key derivation costs cfg accepts, for new archives
+// and from archives being opened
+func KDFLimits(cfg *config.Config) crypto.KDFLimits {
+	if cfg.AllowCostlyKDF {
+		return crypto.CostlyKDFLimits
+	}
+	return crypto.DefaultKDFLimits
+}
+
 // GetVideoMaker returns the video maker instance
 func (c *Converter) GetVideoMaker() (*video.Maker, error) {
 	if c.videoMaker == nil {
@@ -142,6 +193,13 @@ func (c *Converter) Convert(inputPath, outputPath string, progressChan chan<- Pr
 		}
 	}
 
+	if c.config.EncryptMetadata && password == "" {
+		job.Status = "failed"
+		job.Error = "password required for metadata encryption"
+		c.setJob(jobID, job)
+		return fmt.Errorf("password required for metadata encryption")
+	}
+
 	updateProgress("Analyzing input", 10, "Scanning files...")
 
 	// Analyze input
@@ -155,12 +213,32 @@ func (c *Converter) Convert(inputPath, outputPath string, progressChan chan<- Pr
 
 	updateProgress("Processing files", 25, fmt.Sprintf("Found %d files", len(files)))
 
+	// Every frame carries a Merkle proof, so keep room for it in each chunk
+	proofRoom := c.proofReserve(files, c.encrypting(password))
+
+	// Files are encrypted under a random data key, which the manifest holds
+	// wrapped for the password and every recipient
+	var archiveKey *crypto.ArchiveKey
+	var recipients []qr.Recipient
+	if c.encrypting(password) {
+		archiveKey, err = crypto.NewDataKey()
+		if err == nil {
+			recipients, err = c.wrapDataKey(archiveKey, password, c.config.Recipients)
+		}
+		if err != nil {
+			job.Status = "failed"
+			job.Error = err.Error()
+			c.setJob(jobID, job)
+			return fmt.Errorf("failed to set up encryption: %w", err)
+		}
+	}
+
 	// Process all files and create chunks
 	var allChunks []qr.Chunk
 	var contents []ContentItem
 
 	for i, file := range files {
-		chunks, item, err := c.processFile(file, password)
+		chunks, item, err := c.processFile(file, archiveKey, proofRoom)
 		if err != nil {
 			job.Status = "failed"
 			job.Error = err.Error()
@@ -175,6 +253,20 @@ func (c *Converter) Convert(inputPath, outputPath string, progressChan chan<- Pr
 		updateProgress("Processing files", progress, fmt.Sprintf("Processed %s", filepath.Base(file)))
 	}
 
+	// Lead with the manifest so readers know what the archive should contain,
+	// including the Merkle root that authenticates each frame on its own
+	root, leaves := qr.AttachMerkleProofs(allChunks)
+	if c.config.EncryptMetadata {
+		updateProgress("Encrypting metadata", 58, "Sealing frames...")
+	}
+	allChunks, err = c.archiveChunks(allChunks, root, leaves, recipients, password)
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		c.setJob(jobID, job)
+		return err
+	}
+
 	updateProgress("Generating QR codes", 60, fmt.Sprintf("Creating %d QR frames", len(allChunks)))
 
 	// Generate QR codes
@@ -188,10 +280,15 @@ func (c *Converter) Convert(inputPath, outputPath string, progressChan chan<- Pr
 
 	updateProgress("Creating video", 80, "Assembling video file...")
 
+	// Sealed archives keep file names out of the video metadata as well
+	if c.config.EncryptMetadata {
+		contents = nil
+	}
+
 	// Create metadata
 	metadata := &Metadata{
 		Version:     "1.0.0",
-		CreatedAt:   time.Now(),
+		CreatedAt:   c.config.BuildTime(),
 		TotalChunks: len(allChunks),
 		Contents:    contents,
 		Config:      c.config,
@@ -223,62 +320,382 @@ func (c *Converter) Convert(inputPath, outputPath string, progressChan chan<- Pr
 	return nil
 }
 
+// archiveChunks puts the manifest in front of an archive's data and parity
+// chunks, signed if a key is configured, and seals every frame, manifest
+// included, when metadata is encrypted. root and leaves describe the Merkle
+// tree over the chunks, if they carry proofs.
+func (c *Converter) archiveChunks(chunks []qr.Chunk, root string, leaves int, recipients []qr.Recipient, password string) ([]qr.Chunk, error) {
+	manifest := qr.NewManifest(chunks, c.config.BuildTime())
+	manifest.MerkleRoot = root
+	manifest.MerkleLeaves = leaves
+	manifest.Recipients = recipients
+	if err := c.signManifest(manifest); err != nil {
+		return nil, err
+	}
+	// One frame more than needed leaves room to add recipients when
+	// rekeying, without moving the payload frames
+	manifestChunks, err := manifest.Chunks(c.frameBudget() - 200)
+	if err == nil {
+		manifestChunks, err = manifest.PaddedChunks(c.frameBudget()-200, len(manifestChunks)+1)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest: %w", err)
+	}
+	chunks = append(manifestChunks, chunks...)
+
+	if !c.config.EncryptMetadata {
+		return chunks, nil
+	}
+	envelope, err := crypto.NewEnvelope(password, c.kdf)
+	if err == nil {
+		chunks, err = qr.SealChunks(chunks, envelope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt metadata: %w", err)
+	}
+	return chunks, nil
+}
+
+// wrapDataKey wraps the data key for a password, if given, and for every
+// recipient public key
+func (c *Converter) wrapDataKey(key *crypto.ArchiveKey, password string, recipients []string) ([]qr.Recipient, error) {
+	var wrapped []qr.Recipient
+	if password != "" {
+		params, wrappedKey, err := key.WrapWithPassword(password, c.kdf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap key for password: %w", err)
+		}
+		wrapped = append(wrapped, qr.Recipient{
+			Type:       crypto.WrapPassword,
+			Salt:       base64.StdEncoding.EncodeToString(params),
+			WrappedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+		})
+	}
+
+	for _, r := range recipients {
+		pub, err := crypto.ParseRecipient(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recipient: %w", err)
+		}
+		ephemeral, wrappedKey, err := key.WrapFor(pub)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap key for recipient %s: %w", crypto.RecipientFingerprint(pub), err)
+		}
+		wrapped = append(wrapped, qr.Recipient{
+			Type:       crypto.WrapX25519,
+			KeyID:      crypto.RecipientFingerprint(pub),
+			Ephemeral:  base64.StdEncoding.EncodeToString(ephemeral),
+			WrappedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+		})
+	}
+	return wrapped, nil
+}
+
+// signManifest signs the manifest when a signing key is configured
+func (c *Converter) signManifest(manifest *qr.Manifest) error {
+	if c.config.SigningKeyPath == "" {
+		return nil
+	}
+	key, err := crypto.LoadSigningKey(c.config.SigningKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load signing key: %w", err)
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	if err := manifest.Sign(key, crypto.KeyFingerprint(pub)); err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	return nil
+}
+
 func (c *Converter) Extract(pixeFilePath, outputDir string, decryptionPassword ...string) error {
+	_, err := c.ExtractWithReport(pixeFilePath, outputDir, video.ExtractOptions{}, decryptionPassword...)
+	return err
+}
+
+// ExtractWithReport extracts a .pixe file and returns a per-file report.
+// With opts.Salvage set, files with missing chunks are written with
+// zero-filled gaps instead of aborting the extraction.
+func (c *Converter) ExtractWithReport(pixeFilePath, outputDir string, opts video.ExtractOptions, decryptionPassword ...string) (*video.ExtractReport, error) {
 	// Get the password if provided
 	var password string
 	if len(decryptionPassword) > 0 {
 		password = decryptionPassword[0]
 	}
 
-	fmt.Printf("DEBUG: Starting extraction from %s\n", pixeFilePath)
-	
+	if opts.Sealer == nil {
+		opts.Sealer = c.sealer(password)
+	}
+
 	// Use the video maker to extract data - this will create the files
-	err := c.videoMaker.ExtractData(pixeFilePath, outputDir)
+	report, err := c.videoMaker.ExtractDataWithReport(pixeFilePath, outputDir, opts)
+	if err != nil {
+		return report, fmt.Errorf("failed to extract data from video: %w", err)
+	}
+
+	return report, c.decryptReportFiles(report, password)
+}
+
+// Capture rebuilds an archive from a camera recording of a screen playing
+// a .pixe file. Incomplete files are kept with zero-filled gaps.
+func (c *Converter) Capture(recordingPath, outputDir string, opts video.CaptureOptions, decryptionPassword ...string) (*video.ExtractReport, error) {
+	var password string
+	if len(decryptionPassword) > 0 {
+		password = decryptionPassword[0]
+	}
+
+	if opts.Sealer == nil {
+		opts.Sealer = c.sealer(password)
+	}
+
+	report, err := c.videoMaker.CaptureData(recordingPath, outputDir, opts)
+	if err != nil {
+		return report, fmt.Errorf("failed to decode capture: %w", err)
+	}
+
+	return report, c.decryptReportFiles(report, password)
+}
+
+// Print decodes a .pixe file and lays its chunks out as a printable PDF of
+// QR grids. The frame scan is returned so callers can warn about frames
+// that could not be read and are therefore missing from the printout.
+func (c *Converter) Print(pixeFilePath, pdfPath string, opts paper.Options) (*video.FrameScan, error) {
+	scan, err := c.videoMaker.DecodeChunks(pixeFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", pixeFilePath, err)
+	}
+
+	chunks := make([]qr.Chunk, len(scan.Chunks))
+	for i, decoded := range scan.Chunks {
+		chunks[i] = decoded.Chunk
+	}
+
+	file, err := os.Create(pdfPath)
 	if err != nil {
-		return fmt.Errorf("failed to extract data from video: %w", err)
+		return scan, fmt.Errorf("failed to create %s: %w", pdfPath, err)
 	}
+	defer file.Close()
 
-	fmt.Printf("DEBUG: Video extraction completed, now processing for decryption if needed\n")
-	
-	// If no password provided, we're done
+	if err := paper.Print(chunks, file, opts); err != nil {
+		return scan, fmt.Errorf("failed to print archive: %w", err)
+	}
+	return scan, nil
+}
+
+// Scan rebuilds an archive's files from a folder of scanned paper pages
+func (c *Converter) Scan(scanDir, outputDir string, decryptionPassword ...string) (*video.ExtractReport, error) {
+	var password string
+	if len(decryptionPassword) > 0 {
+		password = decryptionPassword[0]
+	}
+
+	report, err := paper.Scan(scanDir, outputDir, c.sealer(password))
+	if err != nil {
+		return report, fmt.Errorf("failed to scan pages: %w", err)
+	}
+
+	return report, c.decryptReportFiles(report, password)
+}
+
+// sealer opens sealed archives with the password, or is nil without one
+func (c *Converter) sealer(password string) qr.Sealer {
 	if password == "" {
 		return nil
 	}
-
-	// If password is provided, we need to decrypt the extracted files
-	// This is a simplified approach - in reality we'd need to read the chunk metadata
-	// to determine which files are encrypted, but for now let's try to decrypt all files
-	extractedFiles, err := filepath.Glob(filepath.Join(outputDir, "*"))
+	envelope, err := crypto.NewEnvelope(password, c.kdf)
 	if err != nil {
-		return fmt.Errorf("failed to list extracted files: %w", err)
+		return nil
+	}
+	envelope.SetKDFLimits(KDFLimits(c.config))
+	return envelope
+}
+
+// ErrNoCredentials is returned when an archive holds encrypted files and
+// no password, identity or key file was given to open them
+var ErrNoCredentials = errors.New("archive is encrypted, a password, identity or key file is required")
+
+// decryptReportFiles decrypts the extracted files in place. Encrypted files
+// that cannot be decrypted, whether for a wrong password, a tampered
+// segment, missing chunks or missing credentials, are marked failed and
+// renamed with an .encrypted suffix, so ciphertext never sits under the
+// plaintext's name. It returns an error if any file failed.
+func (c *Converter) decryptReportFiles(report *video.ExtractReport, password string) error {
+	var decrypter *crypto.Decrypter
+	var keyErr error
+	if password == "" && c.config.IdentityPath == "" && c.config.DataKeyPath == "" {
+		keyErr = ErrNoCredentials
+	} else {
+		decrypter, keyErr = c.decrypter(report.Manifest, password)
 	}
 
-	for _, filePath := range extractedFiles {
-		// Try to decrypt the file
-		data, err := os.ReadFile(filePath)
+	locked := false
+	for i := range report.Files {
+		file := &report.Files[i]
+		if !file.Encrypted || file.OutputPath == "" {
+			continue
+		}
+		err := keyErr
+		switch {
+		case err != nil:
+		case file.Status != video.FileComplete:
+			err = fmt.Errorf("cannot decrypt a file with missing chunks")
+		default:
+			err = c.decryptFile(file, decrypter, password)
+		}
 		if err != nil {
-			continue // Skip files we can't read
+			withhold(file, err)
+			locked = locked || keyErr != nil
 		}
+	}
 
-		// Attempt decryption
-		decryptedData, err := c.cryptoService.DecryptData(data, password)
-		if err != nil {
-			// If decryption fails, the file might not be encrypted, so leave it as is
-			fmt.Printf("DEBUG: File %s is not encrypted or decryption failed: %v\n", filepath.Base(filePath), err)
-			continue
+	if locked {
+		return keyErr
+	}
+	var failed []string
+	for _, file := range report.Files {
+		if file.Status == video.FileFailed {
+			failed = append(failed, fmt.Sprintf("%s: %s", file.Name, file.Error))
 		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to extract %d of %d files: %s", len(failed), len(report.Files), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// decryptFile replaces an extracted file with its plaintext
+func (c *Converter) decryptFile(file *video.FileReport, decrypter *crypto.Decrypter, password string) error {
+	data, err := os.ReadFile(file.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for decryption: %w", file.OutputPath, err)
+	}
+
+	// Archives from before chunked encryption hold one encrypted blob
+	var decryptedData []byte
+	if file.Cipher != "" {
+		decryptedData, err = decrypter.DecryptFile(file.Cipher, data)
+	} else {
+		decryptedData, err = c.cryptoService.DecryptData(data, password)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	if err := os.WriteFile(file.OutputPath, decryptedData, 0644); err != nil {
+		return fmt.Errorf("failed to write decrypted file %s: %w", file.OutputPath, err)
+	}
+	return nil
+}
+
+// withhold marks an encrypted file failed and moves its ciphertext, and the
+// .missing sidecar of a partial file, out of the plaintext's name
+func withhold(file *video.FileReport, err error) {
+	file.Status = video.FileFailed
+	file.Error = err.Error()
+
+	encrypted := file.OutputPath + ".encrypted"
+	if err := os.Rename(file.OutputPath, encrypted); err != nil {
+		os.Remove(file.OutputPath)
+		os.Remove(file.OutputPath + ".missing")
+		file.OutputPath = ""
+		return
+	}
+	os.Rename(file.OutputPath+".missing", encrypted+".missing")
+	file.OutputPath = encrypted
+}
+
+// decrypter prepares a decrypter from a recovered data key file if one is
+// configured, and otherwise from the password or identity
+func (c *Converter) decrypter(manifest *qr.Manifest, password string) (*crypto.Decrypter, error) {
+	if c.config.DataKeyPath == "" {
+		return NewDecrypter(manifest, password, c.config.IdentityPath, KDFLimits(c.config))
+	}
+	key, err := crypto.LoadDataKey(c.config.DataKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data key: %w", err)
+	}
+	decrypter := crypto.NewDecrypter(password)
+	decrypter.SetKDFLimits(KDFLimits(c.config))
+	decrypter.AddArchiveKey(key)
+	return decrypter, nil
+}
 
-		// Write the decrypted data back
-		err = os.WriteFile(filePath, decryptedData, 0644)
+// NewDecrypter prepares a decrypter for an archive's files. The data key is
+// unwrapped from the manifest with the password or the identity at
+// identityPath; archives from before data keys derive it from the password.
+// Key derivation costs past limits are refused.
+func NewDecrypter(manifest *qr.Manifest, password, identityPath string, limits crypto.KDFLimits) (*crypto.Decrypter, error) {
+	decrypter := crypto.NewDecrypter(password)
+	decrypter.SetKDFLimits(limits)
+	key, err := UnwrapDataKey(manifest, password, identityPath, limits)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		decrypter.AddArchiveKey(key)
+	}
+	return decrypter, nil
+}
+
+// UnwrapDataKey opens the manifest entry for the password or identity and
+// returns the data key. It returns nil for archives without wrapped keys,
+// whose files derive their key from the password directly.
+func UnwrapDataKey(manifest *qr.Manifest, password, identityPath string, limits crypto.KDFLimits) ([]byte, error) {
+	var identity *ecdh.PrivateKey
+	if identityPath != "" {
+		var err error
+		if identity, err = crypto.LoadIdentity(identityPath); err != nil {
+			return nil, fmt.Errorf("failed to load identity: %w", err)
+		}
+	}
+	if manifest == nil || len(manifest.Recipients) == 0 {
+		if identity != nil {
+			return nil, fmt.Errorf("archive manifest lists no recipients")
+		}
+		return nil, nil
+	}
+
+	var lastErr error
+	for _, r := range manifest.Recipients {
+		wrapped, err := base64.StdEncoding.DecodeString(r.WrappedKey)
 		if err != nil {
-			fmt.Printf("ERROR: Failed to write decrypted file %s: %v\n", filePath, err)
+			lastErr = fmt.Errorf("invalid %s entry in manifest: %w", r.Type, err)
 			continue
 		}
 
-		fmt.Printf("DEBUG: Successfully decrypted file %s\n", filepath.Base(filePath))
+		var key []byte
+		switch {
+		case r.Type == crypto.WrapPassword && password != "":
+			params, err := base64.StdEncoding.DecodeString(r.Salt)
+			if err != nil {
+				lastErr = fmt.Errorf("invalid password entry in manifest: %w", err)
+				continue
+			}
+			key, err = crypto.UnwrapWithPassword(password, params, wrapped, limits)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+		case r.Type == crypto.WrapX25519 && identity != nil && r.KeyID == crypto.RecipientFingerprint(identity.PublicKey()):
+			ephemeral, err := base64.StdEncoding.DecodeString(r.Ephemeral)
+			if err != nil {
+				lastErr = fmt.Errorf("invalid recipient entry in manifest: %w", err)
+				continue
+			}
+			key, err = crypto.UnwrapKey(identity, ephemeral, wrapped)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+		default:
+			continue
+		}
+		return key, nil
 	}
 
-	return nil
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("archive is not encrypted to this password or identity")
 }
 
 func (c *Converter) ListContents(inputPath string) ([]ContentItem, error) {
@@ -327,22 +744,23 @@ func (c *Converter) analyzeInput(inputPath string) ([]string, error) {
 	return files, err
 }
 
-func (c *Converter) processFile(filePath string, encryptionPassword string) ([]qr.Chunk, *ContentItem, error) {
+func (c *Converter) processFile(filePath string, key *crypto.ArchiveKey, proofRoom int) ([]qr.Chunk, *ContentItem, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Encrypt data if password is provided
-	originalData := data
-	if encryptionPassword != "" && c.cryptoService.IsEnabled() {
-		fmt.Printf("DEBUG: Encrypting file %s with AES-256-GCM\n", filepath.Base(filePath))
-		encryptedData, err := c.cryptoService.EncryptData(data, encryptionPassword)
+	// Encrypt in segments that line up with chunks, so every chunk can be
+	// decrypted on its own
+	isEncrypted := key != nil
+	var cipherHeader string
+	if isEncrypted {
+		fileCipher, err := key.NewFile(c.segmentSize(proofRoom))
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to encrypt data: %w", err)
 		}
-		data = encryptedData
-		fmt.Printf("DEBUG: Encryption successful - size changed from %d to %d bytes\n", len(originalData), len(data))
+		data = encryptSegments(fileCipher, data)
+		cipherHeader = fileCipher.Header()
 	}
 
 	// Calculate hash (of encrypted data if encrypted)
@@ -362,27 +780,108 @@ func (c *Converter) processFile(filePath string, encryptionPassword string) ([]q
 		Type:      mimeType,
 		Size:      formatSize(int64(len(data))),
 		Hash:      hash,
-		CreatedAt: time.Now(),
+		CreatedAt: c.config.BuildTime(),
 	}
 
-	// Encode data
+	// Encode data; ciphertext is always base64, see qr.Chunk.RawText
 	var encodedData string
-	if strings.HasPrefix(mimeType, "text/") {
+	if strings.HasPrefix(mimeType, "text/") && !isEncrypted {
 		encodedData = string(data)
 	} else {
 		encodedData = base64.StdEncoding.EncodeToString(data)
 	}
 
 	// Create chunks
-	isEncrypted := encryptionPassword != "" && c.cryptoService.IsEnabled()
-	chunks := c.createChunks(encodedData, filePath, mimeType, hash, isEncrypted)
+	chunks := c.createChunks(encodedData, filePath, mimeType, hash, cipherHeader, proofRoom)
 
 	return chunks, item, nil
 }
 
-func (c *Converter) createChunks(data, filePath, mimeType, hash string, encrypted bool) []qr.Chunk {
+// encryptSegments encrypts data segment by segment and concatenates the
+// results. Empty files still get one segment so they authenticate.
+func encryptSegments(fileCipher *crypto.FileCipher, data []byte) []byte {
+	size := fileCipher.SegmentSize()
+	var out []byte
+	for i := 0; i == 0 || i*size < len(data); i++ {
+		end := min((i+1)*size, len(data))
+		last := end == len(data)
+		out = append(out, fileCipher.Seal(i, last, data[i*size:end])...)
+	}
+	return out
+}
+
+// DecryptChunk decrypts one data chunk of a chunk-encrypted file on its own,
+// giving random access to single frames without reassembling the file
+func DecryptChunk(chunk qr.Chunk, decrypter *crypto.Decrypter) ([]byte, error) {
+	if !chunk.IsData() || chunk.Cipher == "" {
+		return nil, fmt.Errorf("chunk %d is not an encrypted data chunk", chunk.Index)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(chunk.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode chunk %d: %w", chunk.Index, err)
+	}
+	return decrypter.OpenSegment(chunk.Cipher, chunk.Index, chunk.Index == chunk.Total-1, ciphertext)
+}
+
+// encrypting reports whether file data is encrypted in chunks. Sealed
+// archives encrypt whole frames instead, so data is not encrypted twice.
+func (c *Converter) encrypting(password string) bool {
+	return (password != "" || len(c.config.Recipients) > 0) && c.cryptoService.IsEnabled() && !c.config.EncryptMetadata
+}
+
+// segmentSize is the plaintext carried by each encrypted chunk, chosen so
+// a segment's ciphertext base64 encodes to exactly one chunk
+func (c *Converter) segmentSize(proofRoom int) int {
+	return c.chunkDataSize(proofRoom, true)/4*3 - crypto.SegmentOverhead
+}
+
+// frameBudget is the serialized size available to each chunk. Sealed frames
+// store the chunk encrypted and base64 encoded inside a frame of their own.
+func (c *Converter) frameBudget() int {
+	if !c.config.EncryptMetadata {
+		return c.config.ChunkSize
+	}
+	return (c.config.ChunkSize-200)*3/4 - crypto.EnvelopeOverhead
+}
+
+// chunkDataSize is the number of encoded characters stored per chunk. Only
+// chunks of encrypted files, see encrypting, carry a cipher header.
+func (c *Converter) chunkDataSize(proofRoom int, encrypted bool) int {
+	chunkSize := c.frameBudget() - 200 - proofRoom // Leave room for metadata
+	if encrypted {
+		chunkSize -= crypto.StreamHeaderSize + len(`,"cipher":""`)
+	}
+	if c.config.ParityGroupSize > 1 {
+		// Parity frames carry base64 payloads, so shrink data chunks to
+		// keep parity frames within the same QR capacity
+		chunkSize = chunkSize * 3 / 4
+	}
+	return chunkSize - chunkSize%4 // Keep base64 chunks independently decodable
+}
+
+// proofReserve estimates how many characters each frame needs for its
+// Merkle proof. The leaf count is estimated from file sizes before chunking,
+// with slack so the smaller chunks it causes cannot deepen the tree further.
+func (c *Converter) proofReserve(files []string, encrypted bool) int {
+	dataSize := c.chunkDataSize(0, encrypted)
+	leaves := 0
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		// Base64 and encryption overhead, as an upper bound
+		encoded := int(info.Size()+64) * 4 / 3
+		chunks := (encoded + dataSize - 1) / dataSize
+		leaves += chunks + qr.ParityGroups(chunks, c.config.ParityGroupSize)
+	}
+	depth := qr.MerkleDepth(leaves*2 + 1)
+	return qr.ProofLength(depth) + len(`,"leaf":0000000,"proof":""`)
+}
+
+func (c *Converter) createChunks(data, filePath, mimeType, hash, cipherHeader string, proofRoom int) []qr.Chunk {
 	var chunks []qr.Chunk
-	chunkSize := c.config.ChunkSize - 200 // Leave room for metadata
+	chunkSize := c.chunkDataSize(proofRoom, cipherHeader != "")
 
 	for i := 0; i < len(data); i += chunkSize {
 		end := i + chunkSize
@@ -398,8 +897,9 @@ func (c *Converter) createChunks(data, filePath, mimeType, hash string, encrypte
 			SourceFile: filepath.Base(filePath),
 			MimeType:   mimeType,
 			Hash:       hash,
-			Encrypted:  encrypted,
-			CreatedAt:  time.Now(),
+			Encrypted:  cipherHeader != "",
+			Cipher:     cipherHeader,
+			CreatedAt:  c.config.BuildTime(),
 		}
 
 		chunks = append(chunks, chunk)
@@ -410,6 +910,9 @@ func (c *Converter) createChunks(data, filePath, mimeType, hash string, encrypte
 		chunks[i].Total = len(chunks)
 	}
 
+	// Append interleaved parity so lost frames can be rebuilt
+	chunks = append(chunks, qr.BuildParity(chunks, c.config.ParityGroupSize)...)
+
 	return chunks
 }
 
@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/video"
+	"github.com/ArqonAi/Pixelog/pkg/config"
+)
+
+// extractChunks saves the files in chunks to a new directory the way an
+// extraction does before decrypting them
+func extractChunks(t *testing.T, chunks []qr.Chunk) *video.ExtractReport {
+	t.Helper()
+	reassembler := video.NewReassembler()
+	for _, chunk := range chunks {
+		reassembler.Add(chunk)
+	}
+	report := &video.ExtractReport{}
+	report.Manifest, _ = reassembler.Manifest()
+	dir := t.TempDir()
+	for _, file := range reassembler.Assemble() {
+		report.Files = append(report.Files, file.Save(dir))
+	}
+	return report
+}
+
+func TestDecryptReportFiles(t *testing.T) {
+	data := bytes.Repeat([]byte("launch codes\n"), 1000)
+	path := filepath.Join(t.TempDir(), "codes.txt")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	conv := testConverter(t, &config.Config{ChunkSize: 2800, EncryptionEnabled: true})
+	chunks, _, err := NewStreamingProcessor(conv).ProcessFileStreaming(path, "right")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ciphertext never stays under the plaintext's name
+	for _, password := range []string{"", "wrong"} {
+		report := extractChunks(t, chunks)
+		plainPath := report.Files[0].OutputPath
+		err := conv.decryptReportFiles(report, password)
+		if err == nil {
+			t.Fatalf("password %q: encrypted file was reported as extracted", password)
+		}
+		if password == "" && !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("no password: got %v, want ErrNoCredentials", err)
+		}
+		file := report.Files[0]
+		if file.Status != video.FileFailed || file.OutputPath != plainPath+".encrypted" {
+			t.Errorf("password %q: file is %s at %s", password, file.Status, file.OutputPath)
+		}
+		if _, err := os.Stat(plainPath); !os.IsNotExist(err) {
+			t.Errorf("password %q: ciphertext left at %s", password, plainPath)
+		}
+	}
+
+	report := extractChunks(t, chunks)
+	if err := conv.decryptReportFiles(report, "right"); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := os.ReadFile(report.Files[0].OutputPath)
+	if err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("file did not decrypt: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ArqonAi/Pixelog/internal/crypto"
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/video"
+)
+
+// RekeyOptions describes how access to an archive changes. Entries that are
+// not removed are kept as they are, so revoking one recipient does not
+// require the public keys of everyone else.
+type RekeyOptions struct {
+	Password         string   // Current password, unless the configured identity unlocks the archive
+	NewPassword      string   // Replaces any existing password entries
+	RemovePassword   bool     // Drops the password entries
+	AddRecipients    []string // X25519 public keys, as files or base64
+	RemoveRecipients []string // X25519 public keys or their key IDs
+}
+
+// RekeyResult describes the rewritten archive
+type RekeyResult struct {
+	Recipients       []qr.Recipient
+	SignatureRemoved bool // The old signature no longer matched and no signing key was configured
+
+	// FramesShifted is how many frames the payload moved because the
+	// manifest outgrew its frames. Search indexes record frame numbers, so
+	// indexes built on the old copy must be rebuilt when it is not zero.
+	FramesShifted int
+}
+
+// Rekey changes who can open an archive by rewrapping its data key in the
+// manifest. Payload chunks are carried over unchanged, so nothing is
+// decrypted or re-encrypted. Only the start of the video is re-encoded: the
+// manifest frames and the frames up to the next keyframe, which are drawn
+// again from their chunks where they can be read and kept as they are
+// otherwise. The rest of the video is copied as it is, with the frame rate
+// and, when the encoder recorded it, the quality of the original, so no
+// frame is dropped for being unreadable. The manifest keeps its frame count
+// unless it has outgrown it, so frame numbers recorded in indexes stay
+// valid. Revoked keys can no longer open the new copy; anyone who already
+// unwrapped the data key can still read the content.
+func (c *Converter) Rekey(inputPath, outputPath string, opts RekeyOptions) (*RekeyResult, error) {
+	parts, err := c.videoMaker.ReadManifestChunks(inputPath)
+	if errors.Is(err, video.ErrSealed) {
+		return nil, fmt.Errorf("archives with encrypted metadata are sealed frame by frame and must be reconverted")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest of %s: %w", inputPath, err)
+	}
+	manifestChunks, result, err := c.rekeyManifest(parts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The frames up to the first keyframe after the manifest are encoded
+	// again, from there on the video is copied
+	keyframe, err := c.videoMaker.NextKeyframe(inputPath, len(parts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a keyframe in %s: %w", inputPath, err)
+	}
+	imageDir, images, err := c.videoMaker.ExtractFrameImages(inputPath, len(parts), keyframe.Frame)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(imageDir)
+
+	tempDir, err := os.MkdirTemp("", "pixelog-rekey-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	generator, err := qr.New(tempDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create QR generator: %w", err)
+	}
+	var framePaths []string
+	for i, chunk := range manifestChunks {
+		framePath, err := generator.GenerateFrame(chunk, i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate QR frames: %w", err)
+		}
+		framePaths = append(framePaths, framePath)
+	}
+	for _, image := range images {
+		i := len(framePaths)
+		if image.Chunk == nil {
+			framePath := filepath.Join(tempDir, fmt.Sprintf("frame_%05d.png", i))
+			if err := os.Rename(image.Path, framePath); err != nil {
+				return nil, fmt.Errorf("failed to keep frame %d: %w", image.Frame, err)
+			}
+			framePaths = append(framePaths, framePath)
+			continue
+		}
+		framePath, err := generator.GenerateFrame(*image.Chunk, i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate QR frames: %w", err)
+		}
+		framePaths = append(framePaths, framePath)
+	}
+
+	// The new frames must be encoded like the ones they are joined to
+	cfg := *c.config
+	if cfg.FrameRate, err = c.videoMaker.FrameRate(inputPath); err != nil {
+		return nil, fmt.Errorf("failed to read the frame rate of %s: %w", inputPath, err)
+	}
+	if quality, ok := c.videoMaker.EncodedQuality(inputPath); ok {
+		cfg.Quality = quality
+	}
+	metadata := &Metadata{
+		Version:     "1.0.0",
+		CreatedAt:   c.config.BuildTime(),
+		TotalChunks: len(framePaths),
+		Config:      &cfg,
+	}
+
+	// Write next to the output first so an in-place rekey never leaves a
+	// half-written archive behind
+	tempPath := outputPath + ".rekey"
+	if err := c.videoMaker.SpliceVideo(inputPath, tempPath, framePaths, keyframe, metadata, &cfg); err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to create video: %w", err)
+	}
+	if err := os.Rename(tempPath, outputPath); err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to replace %s: %w", outputPath, err)
+	}
+	return result, nil
+}
+
+// rekeyManifest rewrites the manifest chunks of an archive, given by index,
+// with the data key rewrapped as opts asks, and returns the new chunks in
+// frame order
+func (c *Converter) rekeyManifest(manifestParts map[int]qr.Chunk, opts RekeyOptions) ([]qr.Chunk, *RekeyResult, error) {
+	if len(manifestParts) == 0 {
+		return nil, nil, fmt.Errorf("archive has no manifest and must be reconverted")
+	}
+	manifest, err := qr.ParseManifest(manifestParts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(manifest.Recipients) == 0 {
+		for _, file := range manifest.Files {
+			if file.Encrypted {
+				return nil, nil, fmt.Errorf("archive files are encrypted with a key derived from the password rather than a wrapped data key; archives from older versions must be reconverted")
+			}
+		}
+		return nil, nil, fmt.Errorf("archive is not encrypted, so it has no key to change")
+	}
+
+	key, err := c.unlockDataKey(manifest, opts.Password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recipients, err := c.rekeyRecipients(manifest.Recipients, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, nil, fmt.Errorf("no password or recipient would be left to open the archive")
+	}
+	manifest.Recipients = recipients
+
+	// The signature covers the recipients, so it is renewed or dropped
+	result := &RekeyResult{Recipients: recipients}
+	if manifest.Signature != nil && c.config.SigningKeyPath == "" {
+		manifest.Signature = nil
+		result.SignatureRemoved = true
+	}
+	if err := c.signManifest(manifest); err != nil {
+		return nil, nil, err
+	}
+
+	frames := len(manifestParts)
+	manifestChunks, err := manifest.PaddedChunks(c.frameBudget()-200, frames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create manifest: %w", err)
+	}
+	result.FramesShifted = len(manifestChunks) - frames
+	return manifestChunks, result, nil
+}
+
+// SplitDataKey reads an archive's manifest, unwraps its data key with the
+// password or configured identity, and splits it into total shares of which
+// any threshold recover the key
+func (c *Converter) SplitDataKey(inputPath, password string, threshold, total int) ([]crypto.Share, error) {
+	manifest, err := c.videoMaker.ReadManifest(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if len(manifest.Recipients) == 0 {
+		return nil, fmt.Errorf("archive has no wrapped data key; archives from older versions must be reconverted")
+	}
+
+	key, err := c.unlockDataKey(manifest, password)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SplitKey(key.Bytes(), manifest.ArchiveID, threshold, total)
+}
+
+// unlockDataKey returns the data key from the configured key file, or
+// unwraps it from the manifest with the password or identity
+func (c *Converter) unlockDataKey(manifest *qr.Manifest, password string) (*crypto.ArchiveKey, error) {
+	var dataKey []byte
+	var err error
+	if c.config.DataKeyPath != "" {
+		dataKey, err = crypto.LoadDataKey(c.config.DataKeyPath)
+	} else {
+		dataKey, err = UnwrapDataKey(manifest, password, c.config.IdentityPath, KDFLimits(c.config))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock archive: %w", err)
+	}
+	return crypto.DataKeyFrom(dataKey)
+}
+
+// rekeyRecipients applies the requested removals and additions to the
+// manifest's wrapped keys
+func (c *Converter) rekeyRecipients(current []qr.Recipient, key *crypto.ArchiveKey, opts RekeyOptions) ([]qr.Recipient, error) {
+	remove := make(map[string]bool)
+	for _, r := range opts.RemoveRecipients {
+		if pub, err := crypto.ParseRecipient(r); err == nil {
+			r = crypto.RecipientFingerprint(pub)
+		}
+		remove[r] = true
+	}
+
+	var kept []qr.Recipient
+	removed := make(map[string]bool)
+	for _, r := range current {
+		switch {
+		case r.Type == crypto.WrapPassword && (opts.RemovePassword || opts.NewPassword != ""):
+			continue
+		case r.Type == crypto.WrapX25519 && remove[r.KeyID]:
+			removed[r.KeyID] = true
+			continue
+		}
+		kept = append(kept, r)
+	}
+	for id := range remove {
+		if !removed[id] {
+			return nil, fmt.Errorf("recipient %s is not listed in the archive", id)
+		}
+	}
+
+	added, err := c.wrapDataKey(key, opts.NewPassword, opts.AddRecipients)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range added {
+		if r.Type == crypto.WrapX25519 && listsRecipient(kept, r.KeyID) {
+			return nil, fmt.Errorf("recipient %s is already listed in the archive", r.KeyID)
+		}
+		kept = append(kept, r)
+	}
+	return kept, nil
+}
+
+func listsRecipient(recipients []qr.Recipient, keyID string) bool {
+	for _, r := range recipients {
+		if r.Type == crypto.WrapX25519 && r.KeyID == keyID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/crypto"
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/video"
+	"github.com/ArqonAi/Pixelog/pkg/config"
+)
+
+// testIdentity writes a new X25519 key pair and returns its paths
+func testIdentity(t *testing.T, name string) (string, string) {
+	t.Helper()
+	identity, err := crypto.GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath, err := crypto.WriteIdentity(filepath.Join(t.TempDir(), name), identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath
+}
+
+// openChunks reassembles and decrypts the one file in an archive's chunks
+func openChunks(chunks []qr.Chunk, password, identityPath string) ([]byte, error) {
+	reassembler := video.NewReassembler()
+	for _, chunk := range chunks {
+		reassembler.Add(chunk)
+	}
+	manifest, err := reassembler.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	decrypter, err := NewDecrypter(manifest, password, identityPath, crypto.DefaultKDFLimits)
+	if err != nil {
+		return nil, err
+	}
+	file := reassembler.Assemble()[0]
+	return decrypter.DecryptFile(file.Cipher, file.Data)
+}
+
+func TestRekeyRoundTrip(t *testing.T) {
+	alice, alicePub := testIdentity(t, "alice")
+	bob, bobPub := testIdentity(t, "bob")
+
+	data := bytes.Repeat([]byte("attack at dawn\n"), 2000)
+	path := filepath.Join(t.TempDir(), "orders.txt")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Streamed archives carry the same manifest and wrapped keys as converted ones
+	cfg := &config.Config{ChunkSize: 2800, EncryptionEnabled: true, Recipients: []string{alicePub, bobPub}}
+	chunks, _, err := NewStreamingProcessor(testConverter(t, cfg)).ProcessFileStreaming(path, "old password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, identity := range []string{"", alice, bob} {
+		password := ""
+		if identity == "" {
+			password = "old password"
+		}
+		if plain, err := openChunks(chunks, password, identity); err != nil || !bytes.Equal(plain, data) {
+			t.Fatalf("original archive did not open with %q/%q: %v", password, identity, err)
+		}
+	}
+
+	// Rekey reads only the manifest frames and copies the rest of the video
+	manifestParts := make(map[int]qr.Chunk)
+	var payload []qr.Chunk
+	for _, chunk := range chunks {
+		if chunk.Kind == qr.KindManifest {
+			manifestParts[chunk.Index] = chunk
+		} else {
+			payload = append(payload, chunk)
+		}
+	}
+	manifestChunks, result, err := testConverter(t, &config.Config{ChunkSize: 2800, EncryptionEnabled: true}).rekeyManifest(manifestParts, RekeyOptions{
+		Password:         "old password",
+		NewPassword:      "new password",
+		RemoveRecipients: []string{bobPub},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekeyed := append(manifestChunks, payload...)
+
+	// Payload frames keep their numbers, so indexes of the old copy still apply
+	if result.FramesShifted != 0 || len(rekeyed) != len(chunks) {
+		t.Fatalf("rekeying moved the payload by %d frames", result.FramesShifted)
+	}
+	for i, chunk := range rekeyed {
+		if chunk.Kind != qr.KindManifest && chunk.ID != chunks[i].ID {
+			t.Fatalf("frame %d holds %s, was %s", i, chunk.ID, chunks[i].ID)
+		}
+	}
+
+	if _, err := openChunks(rekeyed, "old password", ""); err == nil {
+		t.Error("old password still opens the rekeyed archive")
+	}
+	if _, err := openChunks(rekeyed, "", bob); err == nil {
+		t.Error("removed recipient still opens the rekeyed archive")
+	}
+	for _, identity := range []string{"", alice} {
+		password := ""
+		if identity == "" {
+			password = "new password"
+		}
+		if plain, err := openChunks(rekeyed, password, identity); err != nil || !bytes.Equal(plain, data) {
+			t.Errorf("rekeyed archive did not open with %q/%q: %v", password, identity, err)
+		}
+	}
+}
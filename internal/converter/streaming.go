@@ -3,18 +3,20 @@ package converter
 import (
 	"bufio"
 	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"mime"
 	"os"
 	"path/filepath"
-	"time"
+	"strings"
 
+	"github.com/ArqonAi/Pixelog/internal/crypto"
 	"github.com/ArqonAi/Pixelog/internal/qr"
 )
 
 const (
-	// ChunkSize for streaming - 1MB chunks
+	// StreamChunkSize is the read buffer size for streaming - 1MB
 	StreamChunkSize = 1 * 1024 * 1024
 )
 
@@ -41,16 +43,76 @@ func (sp *StreamingProcessor) SetProgressCallback(callback ProgressCallback) {
 	sp.progressCallback = callback
 }
 
-// ProcessFileStreaming processes a file in chunks without loading it entirely into memory
+// ProcessFileStreaming processes a file in chunks without loading it entirely
+// into memory, and returns the archive's chunks led by the manifest. The
+// archive is encrypted, signed and sealed the same way Convert does it.
 func (sp *StreamingProcessor) ProcessFileStreaming(filePath string, encryptionPassword string) ([]qr.Chunk, *ContentItem, error) {
+	conv := sp.converter
+	if conv.config.EncryptMetadata && encryptionPassword == "" {
+		return nil, nil, fmt.Errorf("password required for metadata encryption")
+	}
+
+	// Files are encrypted under a random data key, which the manifest holds
+	// wrapped for the password and every recipient
+	var key *crypto.ArchiveKey
+	var recipients []qr.Recipient
+	if conv.encrypting(encryptionPassword) {
+		var err error
+		key, err = crypto.NewDataKey()
+		if err == nil {
+			recipients, err = conv.wrapDataKey(key, encryptionPassword, conv.config.Recipients)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set up encryption: %w", err)
+		}
+	}
+
+	// Every frame carries a Merkle proof. The number of leaves, and so the
+	// room a proof needs, follows from the file size before reading it.
+	chunks, contentItem, err := sp.readChunks(filePath, key, conv.proofReserve([]string{filePath}, key != nil))
+	if err != nil {
+		return nil, nil, err
+	}
+	root, leaves := qr.AttachMerkleProofs(chunks)
+	chunks, err = conv.archiveChunks(chunks, root, leaves, recipients, encryptionPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chunks, contentItem, nil
+}
+
+// readChunks reads a file into data and parity chunks, encrypting it under
+// key if set, with proofRoom characters of each frame left for its proof
+func (sp *StreamingProcessor) readChunks(filePath string, key *crypto.ArchiveKey, proofRoom int) ([]qr.Chunk, *ContentItem, error) {
 	// Get file info
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
+	// Detect MIME type
+	mimeType := mime.TypeByExtension(filepath.Ext(filePath))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	// Each read fills exactly one chunk: raw text as-is, anything else as
+	// base64 of a whole number of 3-byte groups so chunks join cleanly
+	conv := sp.converter
+	dataSize := conv.chunkDataSize(proofRoom, key != nil)
+	segment := dataSize / 4 * 3
+	var fileCipher *crypto.FileCipher
+	if key != nil {
+		if fileCipher, err = key.NewFile(conv.segmentSize(proofRoom)); err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt data: %w", err)
+		}
+		segment = fileCipher.SegmentSize()
+	} else if strings.HasPrefix(mimeType, "text/") {
+		segment = dataSize
+	}
+
 	totalBytes := fileInfo.Size()
-	estimatedChunks := int((totalBytes + int64(sp.chunkSize) - 1) / int64(sp.chunkSize))
+	estimatedChunks := int(max((totalBytes+int64(segment)-1)/int64(segment), 1))
 
 	// Open file for reading
 	file, err := os.Open(filePath)
@@ -62,71 +124,72 @@ func (sp *StreamingProcessor) ProcessFileStreaming(filePath string, encryptionPa
 	// Create buffered reader
 	reader := bufio.NewReaderSize(file, sp.chunkSize)
 
-	// Initialize hash for entire file
+	// Hash the stored bytes, i.e. the ciphertext for encrypted files
 	fileHasher := sha256.New()
 
 	// Process chunks
 	var chunks []qr.Chunk
-	buffer := make([]byte, sp.chunkSize)
+	buffer := make([]byte, segment)
 	bytesProcessed := int64(0)
 	chunkIndex := 0
 
 	for {
-		n, err := reader.Read(buffer)
-		if n > 0 {
-			chunkData := buffer[:n]
-			
-			// Update file hash
-			fileHasher.Write(chunkData)
-
-			// Encrypt chunk if needed
-			if encryptionPassword != "" && sp.converter.cryptoService.IsEnabled() {
-				encryptedData, encErr := sp.converter.cryptoService.EncryptData(chunkData, encryptionPassword)
-				if encErr != nil {
-					return nil, nil, fmt.Errorf("failed to encrypt chunk %d: %w", chunkIndex, encErr)
-				}
-				chunkData = encryptedData
-			}
-
-			// Create QR chunk
-			chunk := qr.Chunk{
-				Index: chunkIndex,
-				Data:  string(chunkData),
-				Total: estimatedChunks, // Will be updated at the end
-			}
-			chunks = append(chunks, chunk)
-
-			bytesProcessed += int64(n)
-			chunkIndex++
-
-			// Report progress
-			if sp.progressCallback != nil {
-				sp.progressCallback(bytesProcessed, totalBytes, chunkIndex, estimatedChunks)
-			}
+		n, err := io.ReadFull(reader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, nil, fmt.Errorf("failed to read chunk %d: %w", chunkIndex, err)
 		}
-
-		if err == io.EOF {
+		last := err != nil || bytesProcessed+int64(n) == totalBytes
+		if n == 0 && !(last && chunkIndex == 0 && fileCipher != nil) {
 			break
 		}
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read chunk %d: %w", chunkIndex, err)
+
+		stored := buffer[:n]
+		if fileCipher != nil {
+			stored = fileCipher.Seal(chunkIndex, last, stored)
 		}
-	}
+		fileHasher.Write(stored)
+
+		chunk := qr.Chunk{
+			Index:      chunkIndex,
+			Total:      estimatedChunks, // Will be updated at the end
+			SourceFile: filepath.Base(filePath),
+			MimeType:   mimeType,
+			Encrypted:  fileCipher != nil,
+			CreatedAt:  sp.converter.config.BuildTime(),
+		}
+		if fileCipher != nil {
+			chunk.Cipher = fileCipher.Header()
+		}
+		if chunk.RawText() {
+			chunk.Data = string(stored)
+		} else {
+			chunk.Data = base64.StdEncoding.EncodeToString(stored)
+		}
+		chunks = append(chunks, chunk)
 
-	// Update total chunks in all chunks
-	actualChunks := len(chunks)
-	for i := range chunks {
-		chunks[i].Total = actualChunks
+		bytesProcessed += int64(n)
+		chunkIndex++
+
+		// Report progress
+		if sp.progressCallback != nil {
+			sp.progressCallback(bytesProcessed, totalBytes, chunkIndex, estimatedChunks)
+		}
+
+		if last {
+			break
+		}
 	}
 
 	// Calculate final hash
 	fileHash := fmt.Sprintf("%x", fileHasher.Sum(nil))
 
-	// Detect MIME type
-	mimeType := mime.TypeByExtension(filepath.Ext(filePath))
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
+	// Update totals and identity now that the whole file has been read
+	for i := range chunks {
+		chunks[i].ID = fmt.Sprintf("%s_%d", fileHash[:8], i)
+		chunks[i].Total = len(chunks)
+		chunks[i].Hash = fileHash
 	}
+	chunks = append(chunks, qr.BuildParity(chunks, conv.config.ParityGroupSize)...)
 
 	// Create content item (matches existing ContentItem type)
 	contentItem := &ContentItem{
@@ -136,6 +199,9 @@ func (sp *StreamingProcessor) ProcessFileStreaming(filePath string, encryptionPa
 		Hash:      fileHash,
 		CreatedAt: fileInfo.ModTime(),
 	}
+	if conv.config.Reproducible {
+		contentItem.CreatedAt = conv.config.BuildTime()
+	}
 
 	return chunks, contentItem, nil
 }
@@ -151,7 +217,7 @@ func (sp *StreamingProcessor) StreamToVideo(filePath string, outputPath string,
 
 	totalBytes := fileInfo.Size()
 	fmt.Printf("📦 Streaming %s (%s) → %s\n", filepath.Base(filePath), formatSizeHelper(totalBytes), outputPath)
-	fmt.Printf("🔄 Processing in %s chunks...\n", formatSizeHelper(int64(sp.chunkSize)))
+	fmt.Printf("🔄 Reading in %s blocks...\n", formatSizeHelper(int64(sp.chunkSize)))
 
 	// Process file streaming
 	chunks, contentItem, err := sp.ProcessFileStreaming(filePath, encryptionPassword)
@@ -186,11 +252,17 @@ func (sp *StreamingProcessor) StreamToVideo(filePath string, outputPath string,
 		return fmt.Errorf("failed to get video maker: %w", err)
 	}
 
+	// Sealed archives keep file names out of the video metadata as well
+	contents := []ContentItem{*contentItem}
+	if sp.converter.config.EncryptMetadata {
+		contents = nil
+	}
+
 	metadata := Metadata{
 		Version:     "1.0",
-		CreatedAt:   time.Now(),
+		CreatedAt:   sp.converter.config.BuildTime(),
 		TotalChunks: len(chunks),
-		Contents:    []ContentItem{*contentItem},
+		Contents:    contents,
 		Config:      sp.converter.GetConfig(),
 	}
 
@@ -0,0 +1,117 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/crypto"
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/pkg/config"
+)
+
+var testKDF = crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Iterations: 1, Memory: 64, Threads: 1}
+
+// testConverter builds a converter without the video maker, which needs ffmpeg
+func testConverter(t *testing.T, cfg *config.Config) *Converter {
+	t.Helper()
+	service := crypto.NewEncryptionService(cfg.EncryptionEnabled)
+	if err := service.SetKDF(testKDF); err != nil {
+		t.Fatal(err)
+	}
+	return &Converter{config: cfg, cryptoService: service, kdf: testKDF, jobs: map[string]*Job{}}
+}
+
+func TestStreamingVerifiesFrames(t *testing.T) {
+	cfg := &config.Config{ChunkSize: 2800, ParityGroupSize: 4, EncryptionEnabled: true}
+	conv := testConverter(t, cfg)
+
+	data := make([]byte, 40000)
+	for i := range data {
+		data[i] = byte(rand.N(256))
+	}
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, _, err := NewStreamingProcessor(conv).ProcessFileStreaming(path, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := map[int]qr.Chunk{}
+	var frame *qr.Chunk
+	for i, chunk := range chunks {
+		if chunk.Kind == qr.KindManifest {
+			parts[chunk.Index] = chunk
+			continue
+		}
+		// Proofs fit in the room reserved for them
+		if encoded, _ := json.Marshal(chunk); len(encoded) > cfg.ChunkSize {
+			t.Errorf("frame %d holds %d bytes, more than the chunk size", i, len(encoded))
+		}
+		if chunk.IsData() && chunk.Index == 5 {
+			frame = &chunks[i]
+		}
+	}
+	manifest, err := qr.ParseManifest(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.MerkleRoot == "" || frame == nil {
+		t.Fatalf("streamed archive has no Merkle root or no frame 5")
+	}
+
+	// One frame proves itself against the manifest and decrypts on its own
+	if err := manifest.CheckChunk(*frame); err != nil {
+		t.Fatalf("CheckChunk: %v", err)
+	}
+	decrypter, err := NewDecrypter(manifest, "hunter2", "", crypto.DefaultKDFLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := DecryptChunk(*frame, decrypter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start := 5 * len(plain); !bytes.Equal(plain, data[start:start+len(plain)]) {
+		t.Error("frame 5 decrypted to the wrong data")
+	}
+
+	tampered := *frame
+	tampered.Data = tampered.Data[:len(tampered.Data)-4] + "AAAA"
+	if err := manifest.CheckChunk(tampered); err == nil {
+		t.Error("tampered frame passed verification")
+	}
+}
+
+func TestStreamingUnencryptedChunkSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, make([]byte, 20000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Servers enable encryption for everyone, but only archives with a
+	// password or recipients lose room to cipher headers
+	sizes := map[bool]int{}
+	for _, enabled := range []bool{false, true} {
+		conv := testConverter(t, &config.Config{ChunkSize: 2800, EncryptionEnabled: enabled})
+		chunks, _, err := NewStreamingProcessor(conv).ProcessFileStreaming(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range chunks {
+			if chunk.IsData() {
+				sizes[enabled] = len(chunk.Data)
+				break
+			}
+		}
+	}
+	if sizes[true] != sizes[false] {
+		t.Errorf("unencrypted chunks hold %d characters with encryption enabled, %d without", sizes[true], sizes[false])
+	}
+}
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -8,19 +9,48 @@ import (
 	"fmt"
 	"math/big"
 	"os"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
 type EncryptionService struct {
 	enabled bool
+	kdf     KDFParams
+	limits  KDFLimits
 }
 
 func NewEncryptionService(enabled bool) *EncryptionService {
-	return &EncryptionService{enabled: enabled}
+	return &EncryptionService{enabled: enabled, kdf: DefaultKDF, limits: DefaultKDFLimits}
+}
+
+// SetKDFLimits changes the key derivation costs accepted, both for new
+// encryptions and from the data being decrypted
+func (e *EncryptionService) SetKDFLimits(limits KDFLimits) {
+	e.limits = limits
+}
+
+// SetKDF changes the key derivation used for new encryptions. Decryption
+// always uses the parameters stored with the data.
+func (e *EncryptionService) SetKDF(params KDFParams) error {
+	if err := params.Validate(e.limits); err != nil {
+		return err
+	}
+	e.kdf = params
+	return nil
+}
+
+// KDF returns the key derivation parameters used for new encryptions
+func (e *EncryptionService) KDF() KDFParams {
+	return e.kdf
 }
 
-// EncryptData encrypts data using AES-256-GCM with a password-derived key
+// blobMagic starts data written by EncryptData since KDF parameters are
+// stored; older data begins directly with its random salt
+var blobMagic = []byte("PXK1")
+
+const blobHeaderLen = 4 + KDFParamsSize + 32 // magic, KDF parameters, salt
+
+// EncryptData encrypts data using AES-256-GCM with a password-derived key.
+// The output is magic + KDF parameters + salt + nonce + ciphertext, with
+// everything before the nonce authenticated as associated data.
 func (e *EncryptionService) EncryptData(data []byte, password string) ([]byte, error) {
 	if !e.enabled {
 		return data, nil // Return data unencrypted if encryption disabled
@@ -36,19 +66,14 @@ func (e *EncryptionService) EncryptData(data []byte, password string) ([]byte, e
 		return nil, fmt.Errorf("failed to generate salt: %w", err)
 	}
 
-	// Derive key using PBKDF2
-	key := pbkdf2.Key([]byte(password), salt, 100000, 32, sha256.New)
-
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+	key, err := e.kdf.Derive(password, salt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
 
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	// Generate nonce
@@ -57,19 +82,18 @@ func (e *EncryptionService) EncryptData(data []byte, password string) ([]byte, e
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	// Encrypt data
-	ciphertext := gcm.Seal(nil, nonce, data, nil)
-
-	// Combine salt + nonce + ciphertext
-	encrypted := make([]byte, 0, len(salt)+len(nonce)+len(ciphertext))
-	encrypted = append(encrypted, salt...)
-	encrypted = append(encrypted, nonce...)
-	encrypted = append(encrypted, ciphertext...)
+	header := make([]byte, 0, blobHeaderLen)
+	header = append(header, blobMagic...)
+	header = append(header, e.kdf.Encode()...)
+	header = append(header, salt...)
 
-	return encrypted, nil
+	encrypted := append(header, nonce...)
+	return gcm.Seal(encrypted, nonce, data, header), nil
 }
 
-// DecryptData decrypts AES-256-GCM encrypted data
+// DecryptData decrypts data from EncryptData, reading the KDF parameters
+// from its header. Data written before parameters were stored is
+// decrypted with the legacy PBKDF2 setting.
 func (e *EncryptionService) DecryptData(encrypted []byte, password string) ([]byte, error) {
 	if !e.enabled {
 		return encrypted, nil // Return data as-is if encryption disabled
@@ -79,6 +103,45 @@ func (e *EncryptionService) DecryptData(encrypted []byte, password string) ([]by
 		return nil, fmt.Errorf("password required for decryption")
 	}
 
+	if bytes.HasPrefix(encrypted, blobMagic) && len(encrypted) >= blobHeaderLen+12 {
+		plaintext, err := decryptVersioned(encrypted, password, e.limits)
+		if err == nil {
+			return plaintext, nil
+		}
+		// A legacy salt can start with the magic bytes by chance
+		if legacy, legacyErr := decryptLegacy(encrypted, password); legacyErr == nil {
+			return legacy, nil
+		}
+		return nil, err
+	}
+	return decryptLegacy(encrypted, password)
+}
+
+func decryptVersioned(encrypted []byte, password string, limits KDFLimits) ([]byte, error) {
+	params, err := DecodeKDFParams(encrypted[len(blobMagic):], limits)
+	if err != nil {
+		return nil, err
+	}
+	header := encrypted[:blobHeaderLen]
+	key, err := params.Derive(password, header[len(blobMagic)+KDFParamsSize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := encrypted[blobHeaderLen : blobHeaderLen+gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, encrypted[blobHeaderLen+gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// decryptLegacy opens salt + nonce + ciphertext keyed with LegacyKDF
+func decryptLegacy(encrypted []byte, password string) ([]byte, error) {
 	if len(encrypted) < 44 { // 32 (salt) + 12 (nonce) minimum
 		return nil, fmt.Errorf("encrypted data too short")
 	}
@@ -88,19 +151,14 @@ func (e *EncryptionService) DecryptData(encrypted []byte, password string) ([]by
 	nonce := encrypted[32:44]
 	ciphertext := encrypted[44:]
 
-	// Derive key using same parameters
-	key := pbkdf2.Key([]byte(password), salt, 100000, 32, sha256.New)
-
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+	key, err := LegacyKDF.Derive(password, salt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
 
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	// Decrypt data
@@ -112,6 +170,21 @@ func (e *EncryptionService) DecryptData(encrypted []byte, password string) ([]by
 	return plaintext, nil
 }
 
+func newGCM(key []byte) (cipher.AEAD, error) {
+	// Create AES cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	// Create GCM mode
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
 // GenerateRandomPassword creates a cryptographically secure random password
 func (e *EncryptionService) GenerateRandomPassword(length int) (string, error) {
 	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*"
@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+const envelopeSaltSize = 16
+
+// EnvelopeOverhead is the number of bytes Seal adds: KDF parameters, salt,
+// nonce and GCM tag
+const EnvelopeOverhead = KDFParamsSize + envelopeSaltSize + 12 + 16
+
+// Envelope encrypts whole frames with AES-256-GCM under one password-derived
+// key. Every sealed frame carries the KDF parameters and salt so it can be
+// opened on its own, but an envelope is for a single archive and derives a
+// single key: the first frame it seals or opens fixes the parameters and
+// salt, and frames carrying others are refused without deriving anything,
+// so an archive cannot make opening it cost one derivation per frame.
+type Envelope struct {
+	password string
+	kdf      KDFParams
+	salt     []byte
+	limits   KDFLimits
+	mu       sync.Mutex
+	id       string // Encoded KDF parameters and salt of the key
+	gcm      cipher.AEAD
+}
+
+// NewEnvelope creates an envelope that seals with kdf under a fresh salt.
+// It can open frames sealed with any KDF parameters within DefaultKDFLimits,
+// see SetKDFLimits.
+func NewEnvelope(password string, kdf KDFParams) (*Envelope, error) {
+	if password == "" {
+		return nil, fmt.Errorf("password required for encryption")
+	}
+
+	salt := make([]byte, envelopeSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return &Envelope{
+		password: password,
+		kdf:      kdf,
+		salt:     salt,
+		limits:   DefaultKDFLimits,
+	}, nil
+}
+
+// SetKDFLimits changes the key derivation costs accepted from sealed frames
+func (e *Envelope) SetKDFLimits(limits KDFLimits) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limits = limits
+}
+
+// Seal encrypts plaintext, authenticating aad alongside it, and returns
+// KDF parameters + salt + nonce + ciphertext
+func (e *Envelope) Seal(plaintext, aad []byte) ([]byte, error) {
+	params := e.kdf.Encode()
+	gcm, err := e.aead(params, e.salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := make([]byte, 0, EnvelopeOverhead+len(plaintext))
+	sealed = append(sealed, params...)
+	sealed = append(sealed, e.salt...)
+	sealed = append(sealed, nonce...)
+	return gcm.Seal(sealed, nonce, plaintext, aad), nil
+}
+
+// Open decrypts a frame produced by Seal with the same aad
+func (e *Envelope) Open(sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < EnvelopeOverhead {
+		return nil, fmt.Errorf("sealed data too short")
+	}
+
+	saltEnd := KDFParamsSize + envelopeSaltSize
+	gcm, err := e.aead(sealed[:KDFParamsSize], sealed[KDFParamsSize:saltEnd])
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := sealed[saltEnd : saltEnd+gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, sealed[saltEnd+gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// aead returns the cipher for encoded KDF parameters and a salt, deriving
+// its key on first use
+func (e *Envelope) aead(params, salt []byte) (cipher.AEAD, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := string(params) + string(salt)
+	if e.gcm != nil {
+		if id != e.id {
+			return nil, fmt.Errorf("frame was sealed with different key derivation parameters than the rest of the archive")
+		}
+		return e.gcm, nil
+	}
+
+	// The envelope's own parameters were chosen by the caller, only those
+	// read from a frame are held to the limits
+	kdf := e.kdf
+	if string(params) != string(e.kdf.Encode()) {
+		var err error
+		if kdf, err = DecodeKDFParams(params, e.limits); err != nil {
+			return nil, err
+		}
+	}
+	key, err := kdf.Derive(e.password, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	e.id, e.gcm = id, gcm
+	return gcm, nil
+}
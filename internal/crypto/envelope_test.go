@@ -0,0 +1,41 @@
+package crypto
+
+import "testing"
+
+func TestEnvelopeDerivesOneKey(t *testing.T) {
+	archive, _ := NewEnvelope("hunter2", testKDF)
+	other, _ := NewEnvelope("hunter2", testKDF)
+	manifest, err := archive.Seal([]byte("manifest"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := other.Seal([]byte("frame"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first frame fixes the salt, so a frame under another one is
+	// refused even with the right password
+	opener, _ := NewEnvelope("hunter2", DefaultKDF)
+	if plaintext, err := opener.Open(manifest, nil); err != nil || string(plaintext) != "manifest" {
+		t.Fatalf("failed to open: %v", err)
+	}
+	if _, err := opener.Open(foreign, nil); err == nil {
+		t.Error("frame with a different salt was opened")
+	}
+
+	costly := KDFParams{Algorithm: KDFArgon2id, Iterations: 20, Memory: 64, Threads: 1}
+	sealer, _ := NewEnvelope("hunter2", costly)
+	sealed, err := sealer.Seal([]byte("slow"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opener, _ = NewEnvelope("hunter2", DefaultKDF)
+	if _, err := opener.Open(sealed, nil); err == nil {
+		t.Error("costly frame opened under the default limits")
+	}
+	opener.SetKDFLimits(CostlyKDFLimits)
+	if _, err := opener.Open(sealed, nil); err != nil {
+		t.Errorf("costly frame refused under CostlyKDFLimits: %v", err)
+	}
+}
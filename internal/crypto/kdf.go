@@ -0,0 +1,140 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// KDFAlgorithm identifies a password key derivation function
+type KDFAlgorithm byte
+
+const (
+	KDFPBKDF2   KDFAlgorithm = 1 // PBKDF2-HMAC-SHA256
+	KDFArgon2id KDFAlgorithm = 2
+)
+
+// KDFParamsSize is the encoded size of KDFParams
+const KDFParamsSize = 10
+
+// KDFLimits bounds the key derivation costs accepted, so a crafted archive
+// cannot tie up the machine opening it
+type KDFLimits struct {
+	Iterations uint32 // PBKDF2 iterations
+	Passes     uint32 // Argon2id passes
+	Memory     uint32 // Argon2id memory in KiB
+}
+
+// DefaultKDFLimits allow a few seconds of work and 1 GiB of memory
+var DefaultKDFLimits = KDFLimits{Iterations: 2_000_000, Passes: 10, Memory: 1024 * 1024}
+
+// CostlyKDFLimits are for creating and opening archives deliberately written
+// with costlier parameters. Only use them for archives from a trusted source.
+var CostlyKDFLimits = KDFLimits{Iterations: 10_000_000, Passes: 100, Memory: 4 * 1024 * 1024}
+
+// KDFParams records how a key was derived from a password. The parameters
+// are stored next to every salt, so costs can be raised for new archives
+// while old ones keep decrypting with the values they were written with.
+type KDFParams struct {
+	Algorithm  KDFAlgorithm
+	Iterations uint32 // PBKDF2 iterations, or Argon2id passes
+	Memory     uint32 // Argon2id memory in KiB
+	Threads    uint8  // Argon2id parallelism
+}
+
+// DefaultKDF is used for new archives: Argon2id with the RFC 9106 second
+// recommended parameter set
+var DefaultKDF = KDFParams{Algorithm: KDFArgon2id, Iterations: 3, Memory: 64 * 1024, Threads: 4}
+
+// DefaultPBKDF2 is used when PBKDF2 is chosen without an iteration count
+var DefaultPBKDF2 = KDFParams{Algorithm: KDFPBKDF2, Iterations: 600000}
+
+// LegacyKDF is the fixed PBKDF2 setting used before parameters were stored
+var LegacyKDF = KDFParams{Algorithm: KDFPBKDF2, Iterations: 100000}
+
+// ParseKDFAlgorithm maps a name such as "argon2id" or "pbkdf2" to its algorithm
+func ParseKDFAlgorithm(name string) (KDFAlgorithm, error) {
+	switch strings.ToLower(name) {
+	case "argon2id", "argon2":
+		return KDFArgon2id, nil
+	case "pbkdf2":
+		return KDFPBKDF2, nil
+	}
+	return 0, fmt.Errorf("unknown key derivation function %q (use argon2id or pbkdf2)", name)
+}
+
+func (a KDFAlgorithm) String() string {
+	switch a {
+	case KDFPBKDF2:
+		return "pbkdf2"
+	case KDFArgon2id:
+		return "argon2id"
+	}
+	return fmt.Sprintf("kdf(%d)", byte(a))
+}
+
+// Validate checks the parameters are supported and within limits
+func (p KDFParams) Validate(limits KDFLimits) error {
+	maxIterations, maxPasses, maxMemory := limits.Iterations, limits.Passes, limits.Memory
+	switch p.Algorithm {
+	case KDFPBKDF2:
+		if p.Iterations < 1000 || p.Iterations > maxIterations {
+			return fmt.Errorf("PBKDF2 iterations must be between 1000 and %d", maxIterations)
+		}
+	case KDFArgon2id:
+		if p.Iterations < 1 || p.Iterations > maxPasses {
+			return fmt.Errorf("Argon2id passes must be between 1 and %d", maxPasses)
+		}
+		if p.Memory < 8*uint32(max(p.Threads, 1)) || p.Memory > maxMemory {
+			return fmt.Errorf("Argon2id memory must be between %d KiB and %d KiB", 8*max(p.Threads, 1), maxMemory)
+		}
+		if p.Threads < 1 {
+			return fmt.Errorf("Argon2id needs at least one thread")
+		}
+	default:
+		return fmt.Errorf("unsupported key derivation function %s", p.Algorithm)
+	}
+	return nil
+}
+
+// Derive stretches a password into a 32-byte key. It refuses parameters past
+// CostlyKDFLimits; parameters read from an archive are checked against the
+// caller's limits when they are decoded.
+func (p KDFParams) Derive(password string, salt []byte) ([]byte, error) {
+	if err := p.Validate(CostlyKDFLimits); err != nil {
+		return nil, err
+	}
+	if p.Algorithm == KDFArgon2id {
+		return argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Threads, 32), nil
+	}
+	return pbkdf2.Key([]byte(password), salt, int(p.Iterations), 32, sha256.New), nil
+}
+
+// Encode serializes the parameters into KDFParamsSize bytes
+func (p KDFParams) Encode() []byte {
+	b := make([]byte, KDFParamsSize)
+	b[0] = byte(p.Algorithm)
+	binary.BigEndian.PutUint32(b[1:5], p.Iterations)
+	binary.BigEndian.PutUint32(b[5:9], p.Memory)
+	b[9] = p.Threads
+	return b
+}
+
+// DecodeKDFParams reads parameters written by Encode, refusing costs past
+// limits
+func DecodeKDFParams(b []byte, limits KDFLimits) (KDFParams, error) {
+	if len(b) < KDFParamsSize {
+		return KDFParams{}, fmt.Errorf("truncated key derivation parameters")
+	}
+	p := KDFParams{
+		Algorithm:  KDFAlgorithm(b[0]),
+		Iterations: binary.BigEndian.Uint32(b[1:5]),
+		Memory:     binary.BigEndian.Uint32(b[5:9]),
+		Threads:    b[9],
+	}
+	return p, p.Validate(limits)
+}
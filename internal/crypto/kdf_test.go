@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+// testKDF keeps Argon2id cheap enough for tests
+var testKDF = KDFParams{Algorithm: KDFArgon2id, Iterations: 1, Memory: 64, Threads: 1}
+
+func TestKDFParamsEncoding(t *testing.T) {
+	for _, params := range []KDFParams{DefaultKDF, DefaultPBKDF2, LegacyKDF, testKDF} {
+		decoded, err := DecodeKDFParams(params.Encode(), DefaultKDFLimits)
+		if err != nil || decoded != params {
+			t.Fatalf("%+v: decoded %+v, %v", params, decoded, err)
+		}
+	}
+
+	for _, params := range []KDFParams{
+		{Algorithm: 0, Iterations: 1},
+		{Algorithm: KDFPBKDF2, Iterations: 10},
+		{Algorithm: KDFArgon2id, Iterations: 0, Memory: 64, Threads: 1},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: 1 << 30, Threads: 1},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: 64, Threads: 0},
+	} {
+		if _, err := DecodeKDFParams(params.Encode(), CostlyKDFLimits); err == nil {
+			t.Fatalf("%+v: expected invalid parameters to be rejected", params)
+		}
+	}
+
+	// Costs past the default bounds need an explicit opt-in
+	for _, params := range []KDFParams{
+		{Algorithm: KDFPBKDF2, Iterations: 5_000_000},
+		{Algorithm: KDFArgon2id, Iterations: 20, Memory: 64, Threads: 1},
+		{Algorithm: KDFArgon2id, Iterations: 1, Memory: 2 << 20, Threads: 1},
+	} {
+		if _, err := DecodeKDFParams(params.Encode(), DefaultKDFLimits); err == nil {
+			t.Errorf("%+v: costly parameters accepted by default", params)
+		}
+		if _, err := DecodeKDFParams(params.Encode(), CostlyKDFLimits); err != nil {
+			t.Errorf("%+v: rejected with CostlyKDFLimits: %v", params, err)
+		}
+	}
+
+	// The limits apply to data being decrypted too, before any derivation
+	blob := append(append([]byte{}, blobMagic...), KDFParams{Algorithm: KDFPBKDF2, Iterations: 5_000_000}.Encode()...)
+	blob = append(blob, make([]byte, 32+12+16)...)
+	if _, err := NewEncryptionService(true).DecryptData(blob, "hunter2"); err == nil || !strings.Contains(err.Error(), "iterations") {
+		t.Errorf("costly blob under the default limits returned %v", err)
+	}
+}
+
+func TestEncryptDataRecordsKDF(t *testing.T) {
+	for _, params := range []KDFParams{testKDF, {Algorithm: KDFPBKDF2, Iterations: 1000}} {
+		service := NewEncryptionService(true)
+		if err := service.SetKDF(params); err != nil {
+			t.Fatal(err)
+		}
+		blob, err := service.EncryptData([]byte("attack at dawn"), "hunter2")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A service with different defaults still reads the stored parameters
+		plaintext, err := NewEncryptionService(true).DecryptData(blob, "hunter2")
+		if err != nil || string(plaintext) != "attack at dawn" {
+			t.Fatalf("%s: round trip failed: %v", params.Algorithm, err)
+		}
+		if _, err := service.DecryptData(blob, "wrong"); err == nil {
+			t.Fatalf("%s: wrong password accepted", params.Algorithm)
+		}
+	}
+}
+
+func TestDecryptLegacyData(t *testing.T) {
+	// salt + nonce + ciphertext, as written before parameters were stored
+	salt := make([]byte, 32)
+	nonce := make([]byte, 12)
+	rand.Read(salt)
+	rand.Read(nonce)
+	key, err := LegacyKDF.Derive("hunter2", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append(append(salt, nonce...), gcm.Seal(nil, nonce, []byte("old archive"), nil)...)
+
+	plaintext, err := NewEncryptionService(true).DecryptData(blob, "hunter2")
+	if err != nil || !bytes.Equal(plaintext, []byte("old archive")) {
+		t.Fatalf("legacy blob did not decrypt: %v", err)
+	}
+}
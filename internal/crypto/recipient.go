@@ -0,0 +1,271 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// Archives use envelope encryption: files are encrypted under a random data
+// key, which is wrapped separately for every password and X25519 public key
+// allowed to open the archive. For a public key an ephemeral key agreement
+// yields a one-time wrapping key, so anyone holding one of the matching
+// private keys (an identity) can unwrap it. Because the wrapped keys live
+// in the manifest, access can change without touching the encrypted files.
+
+// Key wrapping schemes recorded in the manifest
+const (
+	WrapX25519   = "x25519"
+	WrapPassword = "password"
+)
+
+// GenerateIdentity creates a new X25519 key pair for receiving archives
+func GenerateIdentity() (*ecdh.PrivateKey, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	return priv, nil
+}
+
+// WriteIdentity saves an identity as PEM files: the PKCS#8 private key to
+// base.key (readable only by the owner) and the PKIX public key to base.pub.
+// Existing files are never overwritten.
+func WriteIdentity(base string, priv *ecdh.PrivateKey) (string, string, error) {
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.PublicKey())
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	privPath, pubPath := base+".key", base+".pub"
+	if err := writeNewFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return "", "", err
+	}
+	if err := writeNewFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		return "", "", err
+	}
+	return privPath, pubPath, nil
+}
+
+// LoadIdentity reads an X25519 private key from a PKCS#8 PEM file
+func LoadIdentity(path string) (*ecdh.PrivateKey, error) {
+	block, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+	}
+	priv, ok := key.(*ecdh.PrivateKey)
+	if !ok || priv.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("%s is not an X25519 private key", path)
+	}
+	return priv, nil
+}
+
+// ParseRecipient reads a recipient public key, either a PKIX PEM file
+// written by WriteIdentity or the base64 string from EncodeRecipient
+func ParseRecipient(s string) (*ecdh.PublicKey, error) {
+	if _, err := os.Stat(s); err == nil {
+		block, err := readPEM(s, "PUBLIC KEY")
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", s, err)
+		}
+		pub, ok := key.(*ecdh.PublicKey)
+		if !ok || pub.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("%s is not an X25519 public key", s)
+		}
+		return pub, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("recipient %q is neither a key file nor a base64 public key", s)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient public key: %w", err)
+	}
+	return pub, nil
+}
+
+// EncodeRecipient returns the base64 form of a public key, short enough to
+// pass directly on the command line
+func EncodeRecipient(pub *ecdh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub.Bytes())
+}
+
+// RecipientFingerprint returns a short identifier for a recipient key
+func RecipientFingerprint(pub *ecdh.PublicKey) string {
+	return KeyFingerprint(pub.Bytes())
+}
+
+// NewDataKey creates a random archive key to be wrapped in the manifest
+func NewDataKey() (*ArchiveKey, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate archive key: %w", err)
+	}
+	return DataKeyFrom(key)
+}
+
+// DataKeyFrom restores a data key unwrapped from a manifest, so it can be
+// wrapped again for other passwords or recipients
+func DataKeyFrom(key []byte) (*ArchiveKey, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid data key length %d", len(key))
+	}
+	return &ArchiveKey{salt: archiveKeyID(key), key: key}, nil
+}
+
+// Bytes returns the raw key, for splitting into shares
+func (k *ArchiveKey) Bytes() []byte {
+	return k.key
+}
+
+// WrapFor encrypts the data key to a recipient and returns the ephemeral
+// public key and the wrapped key, both needed to unwrap it
+func (k *ArchiveKey) WrapFor(recipient *ecdh.PublicKey) ([]byte, []byte, error) {
+	if k.kdf.Algorithm != 0 {
+		return nil, nil, fmt.Errorf("password-derived keys cannot be wrapped")
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to agree on wrapping key: %w", err)
+	}
+
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	gcm, err := wrapAEAD(shared, ephemeralPub, recipient.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	// The wrapping key is used exactly once, so a fixed nonce is safe
+	return ephemeralPub, gcm.Seal(nil, make([]byte, gcm.NonceSize()), k.key, nil), nil
+}
+
+// UnwrapKey recovers an archive key wrapped for identity's public key
+func UnwrapKey(identity *ecdh.PrivateKey, ephemeral, wrapped []byte) ([]byte, error) {
+	ephemeralPub, err := ecdh.X25519().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	shared, err := identity.ECDH(ephemeralPub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on wrapping key: %w", err)
+	}
+
+	gcm, err := wrapAEAD(shared, ephemeral, identity.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	key, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap archive key: %w", err)
+	}
+	return key, nil
+}
+
+// WrapWithPassword encrypts the data key under a key derived from password
+// and returns the encoded KDF parameters and salt together with the wrapped
+// key, both needed to unwrap it
+func (k *ArchiveKey) WrapWithPassword(password string, kdf KDFParams) ([]byte, []byte, error) {
+	if k.kdf.Algorithm != 0 {
+		return nil, nil, fmt.Errorf("password-derived keys cannot be wrapped")
+	}
+	if password == "" {
+		return nil, nil, fmt.Errorf("password required for encryption")
+	}
+
+	salt := make([]byte, streamSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	params := append(kdf.Encode(), salt...)
+	gcm, err := passwordAEAD(password, params, CostlyKDFLimits)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Every wrap uses a fresh salt and so a fresh key, making a fixed nonce safe
+	return params, gcm.Seal(nil, make([]byte, gcm.NonceSize()), k.key, params), nil
+}
+
+// UnwrapWithPassword recovers a data key wrapped by WrapWithPassword,
+// refusing key derivation costs past limits
+func UnwrapWithPassword(password string, params, wrapped []byte, limits KDFLimits) ([]byte, error) {
+	gcm, err := passwordAEAD(password, params, limits)
+	if err != nil {
+		return nil, err
+	}
+	key, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), wrapped, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap archive key: wrong password or corrupted manifest")
+	}
+	return key, nil
+}
+
+// passwordAEAD derives the wrapping cipher from encoded KDF parameters and salt
+func passwordAEAD(password string, params []byte, limits KDFLimits) (cipher.AEAD, error) {
+	if len(params) != KDFParamsSize+streamSaltSize {
+		return nil, fmt.Errorf("malformed password entry")
+	}
+	kdf, err := DecodeKDFParams(params, limits)
+	if err != nil {
+		return nil, err
+	}
+	key, err := kdf.Derive(password, params[KDFParamsSize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return newGCM(key)
+}
+
+// AddArchiveKey lets the decrypter open files encrypted under an archive
+// key unwrapped with UnwrapKey
+func (d *Decrypter) AddArchiveKey(key []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.archives[recipientArchive(archiveKeyID(key))] = key
+}
+
+// wrapAEAD derives the one-time wrapping cipher from a shared secret, bound
+// to both public keys of the exchange
+func wrapAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	key, err := hkdf.Key(sha256.New, shared, salt, "pixelog x25519 wrap", 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive wrapping key: %w", err)
+	}
+	return newGCM(key)
+}
+
+// archiveKeyID identifies a random archive key in file headers without
+// revealing anything about it
+func archiveKeyID(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("pixelog archive key id\x00"), key...))
+	return sum[:streamSaltSize]
+}
+
+// recipientArchive is the Decrypter cache entry for a random archive key
+func recipientArchive(id []byte) string {
+	return string(KDFParams{}.Encode()) + string(id)
+}
@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecipientEncryptionRoundTrip(t *testing.T) {
+	alice, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(t.TempDir(), "alice")
+	privPath, pubPath, err := WriteIdentity(base, alice)
+	if err != nil {
+		t.Fatalf("failed to write identity: %v", err)
+	}
+	loaded, err := LoadIdentity(privPath)
+	if err != nil || !loaded.Equal(alice) {
+		t.Fatalf("failed to load identity: %v", err)
+	}
+	fromFile, err := ParseRecipient(pubPath)
+	if err != nil || !fromFile.Equal(alice.PublicKey()) {
+		t.Fatalf("failed to parse recipient file: %v", err)
+	}
+	fromString, err := ParseRecipient(EncodeRecipient(alice.PublicKey()))
+	if err != nil || !fromString.Equal(alice.PublicKey()) {
+		t.Fatalf("failed to parse base64 recipient: %v", err)
+	}
+
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ephemeral, wrapped, err := key.WrapFor(fromFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileCipher, err := key.NewFile(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("team"), 50)
+	ciphertext := bytes.Join(sealSegments(t, fileCipher, data), nil)
+
+	// Without the unwrapped key a password does not help
+	if _, err := NewDecrypter("hunter2").DecryptFile(fileCipher.Header(), ciphertext); err == nil {
+		t.Fatal("recipient file decrypted without an identity")
+	}
+
+	archiveKey, err := UnwrapKey(loaded, ephemeral, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypter := NewDecrypter("")
+	decrypter.AddArchiveKey(archiveKey)
+	plaintext, err := decrypter.DecryptFile(fileCipher.Header(), ciphertext)
+	if err != nil || !bytes.Equal(plaintext, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+
+	// Someone else's identity cannot unwrap the key
+	mallory, _ := GenerateIdentity()
+	if _, err := UnwrapKey(mallory, ephemeral, wrapped); err == nil {
+		t.Fatal("key unwrapped with the wrong identity")
+	}
+}
+
+func TestPasswordWrappedDataKey(t *testing.T) {
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, wrapped, err := key.WrapWithPassword("hunter2", testKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := UnwrapWithPassword("hunter2", params, wrapped, DefaultKDFLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := DataKeyFrom(unwrapped)
+	if err != nil || !bytes.Equal(restored.key, key.key) || !bytes.Equal(restored.salt, key.salt) {
+		t.Fatalf("unwrapped key differs: %v", err)
+	}
+
+	if _, err := UnwrapWithPassword("wrong", params, wrapped, DefaultKDFLimits); err == nil {
+		t.Fatal("key unwrapped with the wrong password")
+	}
+	params[KDFParamsSize] ^= 1
+	if _, err := UnwrapWithPassword("hunter2", params, wrapped, DefaultKDFLimits); err == nil {
+		t.Fatal("key unwrapped with a tampered salt")
+	}
+}
@@ -0,0 +1,226 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shamir secret sharing over GF(2^8): every byte of the key is the constant
+// term of its own random polynomial of degree threshold-1, and share i holds
+// the polynomials evaluated at x = i. Any threshold shares determine the
+// polynomials, fewer reveal nothing about the key.
+
+// sharePrefix starts the text form of a share, followed by its version
+const sharePrefix = "pixelog-share:1:"
+
+// Share is one custodian's piece of a split data key
+type Share struct {
+	ArchiveID string // Manifest archive ID, for labelling
+	KeyCheck  string // Hex prefix of the key ID, to detect mixed or wrong shares
+	Threshold int
+	Total     int
+	Index     int // Evaluation point, 1 to Total
+	Value     []byte
+}
+
+// SplitKey splits a data key into total shares, any threshold of which
+// recover it
+func SplitKey(key []byte, archiveID string, threshold, total int) ([]Share, error) {
+	if threshold < 2 || threshold > total || total > 255 {
+		return nil, fmt.Errorf("need 2 <= threshold <= shares <= 255, got %d of %d", threshold, total)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+
+	shares := make([]Share, total)
+	for i := range shares {
+		shares[i] = Share{
+			ArchiveID: archiveID,
+			KeyCheck:  keyCheck(key),
+			Threshold: threshold,
+			Total:     total,
+			Index:     i + 1,
+			Value:     make([]byte, len(key)),
+		}
+	}
+
+	coeffs := make([]byte, threshold)
+	for b, secret := range key {
+		coeffs[0] = secret
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate share: %w", err)
+		}
+		for i := range shares {
+			shares[i].Value[b] = evalPolynomial(coeffs, byte(shares[i].Index))
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares recovers the data key from at least threshold shares of
+// the same split
+func CombineShares(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares given")
+	}
+	first := shares[0]
+	if err := first.validate(); err != nil {
+		return nil, err
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("need %d shares, got %d", first.Threshold, len(shares))
+	}
+
+	seen := make(map[int]bool)
+	for _, s := range shares {
+		if s.KeyCheck != first.KeyCheck || s.ArchiveID != first.ArchiveID || s.Threshold != first.Threshold ||
+			s.Total != first.Total || len(s.Value) != len(first.Value) {
+			return nil, fmt.Errorf("shares come from different splits")
+		}
+		if s.Index < 1 || s.Index > s.Total || seen[s.Index] {
+			return nil, fmt.Errorf("duplicate or invalid share %d", s.Index)
+		}
+		seen[s.Index] = true
+	}
+
+	// Lagrange interpolation at x = 0 over the first threshold shares
+	used := shares[:first.Threshold]
+	key := make([]byte, len(first.Value))
+	for i, si := range used {
+		weight := byte(1)
+		for j, sj := range used {
+			if i == j {
+				continue
+			}
+			xi, xj := byte(si.Index), byte(sj.Index)
+			weight = gfMul(weight, gfDiv(xj, xj^xi))
+		}
+		for b := range key {
+			key[b] ^= gfMul(si.Value[b], weight)
+		}
+	}
+
+	if keyCheck(key) != first.KeyCheck {
+		return nil, fmt.Errorf("recovered key does not match its check value; a share is corrupted")
+	}
+	return key, nil
+}
+
+// Encode returns the share as a single line of text, suitable for a QR code
+func (s Share) Encode() string {
+	return sharePrefix + strings.Join([]string{
+		s.ArchiveID,
+		s.KeyCheck,
+		strconv.Itoa(s.Threshold),
+		strconv.Itoa(s.Total),
+		strconv.Itoa(s.Index),
+		base64.StdEncoding.EncodeToString(s.Value),
+	}, ":")
+}
+
+// ParseShare reads a share written by Encode
+func ParseShare(text string) (Share, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, sharePrefix) {
+		return Share{}, fmt.Errorf("not a pixelog key share")
+	}
+	fields := strings.Split(strings.TrimPrefix(text, sharePrefix), ":")
+	if len(fields) != 6 {
+		return Share{}, fmt.Errorf("malformed key share")
+	}
+
+	s := Share{ArchiveID: fields[0], KeyCheck: fields[1]}
+	var err error
+	if s.Threshold, err = strconv.Atoi(fields[2]); err != nil {
+		return Share{}, fmt.Errorf("malformed key share threshold: %w", err)
+	}
+	if s.Total, err = strconv.Atoi(fields[3]); err != nil {
+		return Share{}, fmt.Errorf("malformed key share count: %w", err)
+	}
+	if s.Index, err = strconv.Atoi(fields[4]); err != nil {
+		return Share{}, fmt.Errorf("malformed key share index: %w", err)
+	}
+	if s.Value, err = base64.StdEncoding.DecodeString(fields[5]); err != nil {
+		return Share{}, fmt.Errorf("malformed key share value: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return Share{}, err
+	}
+	return s, nil
+}
+
+// validate checks that a share's parameters could have come from SplitKey
+func (s Share) validate() error {
+	if s.Threshold < 2 || s.Threshold > s.Total || s.Total > 255 {
+		return fmt.Errorf("invalid key share: need 2 <= threshold <= shares <= 255, got %d of %d", s.Threshold, s.Total)
+	}
+	if s.Index < 1 || s.Index > s.Total {
+		return fmt.Errorf("invalid key share: index %d outside 1 to %d", s.Index, s.Total)
+	}
+	if len(s.Value) == 0 {
+		return fmt.Errorf("invalid key share: empty value")
+	}
+	return nil
+}
+
+// WriteDataKey saves a recovered data key as a PEM file readable only by
+// the owner. Existing files are never overwritten.
+func WriteDataKey(path string, key []byte) error {
+	return writeNewFile(path, pem.EncodeToMemory(&pem.Block{Type: "PIXELOG DATA KEY", Bytes: key}), 0600)
+}
+
+// LoadDataKey reads a data key written by WriteDataKey
+func LoadDataKey(path string) ([]byte, error) {
+	block, err := readPEM(path, "PIXELOG DATA KEY")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := DataKeyFrom(block.Bytes); err != nil {
+		return nil, err
+	}
+	return block.Bytes, nil
+}
+
+// keyCheck is a short public value identifying a data key. It is a prefix
+// of the key ID already stored in every encrypted file's header.
+func keyCheck(key []byte) string {
+	return hex.EncodeToString(archiveKeyID(key)[:8])
+}
+
+// evalPolynomial evaluates coeffs (constant term first) at x with Horner's rule
+func evalPolynomial(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1,
+// without data-dependent branches
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		carry := -(a >> 7) & 0x1b
+		a = a<<1 ^ carry
+		b >>= 1
+	}
+	return p
+}
+
+// gfDiv divides in GF(2^8); b must not be zero
+func gfDiv(a, b byte) byte {
+	// b^254 is the inverse of b since the multiplicative group has order 255
+	inv := byte(1)
+	for i := 0; i < 254; i++ {
+		inv = gfMul(inv, b)
+	}
+	return gfMul(a, inv)
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShamirSplitCombine(t *testing.T) {
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := SplitKey(key.Bytes(), "archive", 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Any three shares, in any order and after a text round trip, recover it
+	for _, pick := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var subset []Share
+		for _, i := range pick {
+			parsed, err := ParseShare(shares[i].Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			subset = append(subset, parsed)
+		}
+		recovered, err := CombineShares(subset)
+		if err != nil || !bytes.Equal(recovered, key.Bytes()) {
+			t.Fatalf("shares %v: recovery failed: %v", pick, err)
+		}
+	}
+
+	if _, err := CombineShares(shares[:2]); err == nil {
+		t.Fatal("key recovered from fewer shares than the threshold")
+	}
+	if _, err := CombineShares([]Share{shares[0], shares[0], shares[1]}); err == nil {
+		t.Fatal("duplicate shares accepted")
+	}
+
+	corrupted := shares[1]
+	corrupted.Value = append([]byte{}, corrupted.Value...)
+	corrupted.Value[0] ^= 1
+	if _, err := CombineShares([]Share{shares[0], corrupted, shares[2]}); err == nil {
+		t.Fatal("corrupted share went unnoticed")
+	}
+
+	if _, err := SplitKey(key.Bytes(), "archive", 1, 5); err == nil {
+		t.Fatal("threshold below two accepted")
+	}
+}
+
+func TestParseShareMalformed(t *testing.T) {
+	key, _ := NewDataKey()
+	shares, err := SplitKey(key.Bytes(), "archive", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tweak := range []func(s *Share){
+		func(s *Share) { s.Threshold = 0 },
+		func(s *Share) { s.Threshold = 1 },
+		func(s *Share) { s.Threshold = 4 },
+		func(s *Share) { s.Total, s.Threshold = 300, 260 },
+		func(s *Share) { s.Index = 0 },
+		func(s *Share) { s.Index = 4 },
+		func(s *Share) { s.Value = nil },
+	} {
+		s := shares[0]
+		tweak(&s)
+		if parsed, err := ParseShare(s.Encode()); err == nil {
+			t.Errorf("malformed share %+v accepted", parsed)
+		}
+	}
+
+	// Shares must agree on the split they come from
+	other := shares[1]
+	other.Total = 4
+	if _, err := CombineShares([]Share{shares[0], other}); err == nil {
+		t.Error("shares with different totals combined")
+	}
+	other = shares[1]
+	other.ArchiveID = "another"
+	if _, err := CombineShares([]Share{shares[0], other}); err == nil {
+		t.Error("shares of different archives combined")
+	}
+}
@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+)
+
+func TestSigningKeysRoundTrip(t *testing.T) {
+	pub, priv, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Join(t.TempDir(), "archive")
+	privPath, pubPath, err := WriteSigningKeys(base, pub, priv)
+	if err != nil {
+		t.Fatalf("failed to write keys: %v", err)
+	}
+	if _, _, err := WriteSigningKeys(base, pub, priv); err == nil {
+		t.Error("expected existing key files not to be overwritten")
+	}
+
+	loadedPriv, err := LoadSigningKey(privPath)
+	if err != nil {
+		t.Fatalf("failed to load private key: %v", err)
+	}
+	loadedPub, err := LoadVerifyKey(pubPath)
+	if err != nil {
+		t.Fatalf("failed to load public key: %v", err)
+	}
+
+	sig := ed25519.Sign(loadedPriv, []byte("manifest"))
+	if !ed25519.Verify(loadedPub, []byte("manifest"), sig) {
+		t.Error("loaded keys do not form a pair")
+	}
+	if _, err := LoadVerifyKey(privPath); err == nil {
+		t.Error("expected a private key file to be rejected as a public key")
+	}
+}
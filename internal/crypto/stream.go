@@ -0,0 +1,277 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// Chunked encryption follows the STREAM construction: a file is split into
+// segments of a fixed plaintext size, each sealed with AES-256-GCM under a
+// per-file key. The nonce is the segment index plus a flag marking the last
+// segment, so segments cannot be reordered, dropped from the end or
+// swapped between files, and any one of them can be decrypted on its own.
+//
+// The password is stretched once per archive with the KDF recorded in the
+// header. Each file then gets its own key from HKDF over the archive key and
+// a random file nonce. The header travels next to every chunk:
+//
+//	version 3: version | segment size | archive key ID | file nonce
+//	version 2: version | segment size | KDF parameters | salt | file nonce
+//	version 1: version | segment size | salt | file nonce (LegacyKDF)
+//
+// Version 3 is used when the archive key is a random data key wrapped in the
+// manifest, see NewDataKey, rather than derived from the password.
+
+const (
+	streamVersion          = 2
+	streamRecipientVersion = 3
+	streamSaltSize         = 16
+	fileNonceSize          = 16
+	streamHeaderLen        = 1 + 4 + KDFParamsSize + streamSaltSize + fileNonceSize
+
+	// SegmentOverhead is the GCM tag added to every encrypted segment
+	SegmentOverhead = 16
+)
+
+// StreamHeaderSize is the length of an encoded file header
+var StreamHeaderSize = base64.StdEncoding.EncodedLen(streamHeaderLen)
+
+// ArchiveKey is the key shared by every file in an archive, derived from a
+// password or a random data key with its ID in place of the salt
+type ArchiveKey struct {
+	kdf  KDFParams
+	salt []byte
+	key  []byte
+}
+
+// NewArchiveKey derives a key for a new archive under a fresh salt
+func NewArchiveKey(password string, kdf KDFParams) (*ArchiveKey, error) {
+	if password == "" {
+		return nil, fmt.Errorf("password required for encryption")
+	}
+
+	salt := make([]byte, streamSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := kdf.Derive(password, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return &ArchiveKey{kdf: kdf, salt: salt, key: key}, nil
+}
+
+// streamHeader is a decoded file header
+type streamHeader struct {
+	raw         []byte
+	segmentSize int
+	kdf         KDFParams
+	salt        []byte
+	fileNonce   []byte
+}
+
+func parseStreamHeader(header string, limits KDFLimits) (*streamHeader, error) {
+	raw, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(raw) < 5 {
+		return nil, fmt.Errorf("malformed encryption header")
+	}
+
+	h := &streamHeader{raw: raw, segmentSize: int(binary.BigEndian.Uint32(raw[1:5]))}
+	rest := raw[5:]
+	switch raw[0] {
+	case 1:
+		h.kdf = LegacyKDF
+	case 3:
+		// Random archive key, identified by the ID in the salt position
+	case 2:
+		if len(rest) < KDFParamsSize {
+			return nil, fmt.Errorf("malformed encryption header")
+		}
+		if h.kdf, err = DecodeKDFParams(rest, limits); err != nil {
+			return nil, err
+		}
+		rest = rest[KDFParamsSize:]
+	default:
+		return nil, fmt.Errorf("unsupported encryption version %d", raw[0])
+	}
+	if len(rest) != streamSaltSize+fileNonceSize || h.segmentSize <= 0 {
+		return nil, fmt.Errorf("malformed encryption header")
+	}
+	h.salt, h.fileNonce = rest[:streamSaltSize], rest[streamSaltSize:]
+	return h, nil
+}
+
+// FileCipher encrypts the segments of one file
+type FileCipher struct {
+	header      []byte
+	segmentSize int
+	aead        cipher.AEAD
+}
+
+// NewFile starts encrypting a file whose plaintext is cut into segments of
+// segmentSize bytes
+func (k *ArchiveKey) NewFile(segmentSize int) (*FileCipher, error) {
+	if segmentSize <= 0 {
+		return nil, fmt.Errorf("invalid segment size %d", segmentSize)
+	}
+
+	fileNonce := make([]byte, fileNonceSize)
+	if _, err := rand.Read(fileNonce); err != nil {
+		return nil, fmt.Errorf("failed to generate file nonce: %w", err)
+	}
+
+	header := make([]byte, 5, streamHeaderLen)
+	header[0] = streamVersion
+	binary.BigEndian.PutUint32(header[1:5], uint32(segmentSize))
+	if k.kdf.Algorithm == 0 {
+		header[0] = streamRecipientVersion
+	} else {
+		header = append(header, k.kdf.Encode()...)
+	}
+	header = append(header, k.salt...)
+	header = append(header, fileNonce...)
+
+	aead, err := fileAEAD(k.key, fileNonce)
+	if err != nil {
+		return nil, err
+	}
+	return &FileCipher{header: header, segmentSize: segmentSize, aead: aead}, nil
+}
+
+// Header returns the encoded header needed to decrypt the file's segments
+func (f *FileCipher) Header() string {
+	return base64.StdEncoding.EncodeToString(f.header)
+}
+
+// SegmentSize is the plaintext size of every segment but the last
+func (f *FileCipher) SegmentSize() int {
+	return f.segmentSize
+}
+
+// Seal encrypts the segment at index; last must be set for the final one
+func (f *FileCipher) Seal(index int, last bool, plaintext []byte) []byte {
+	return f.aead.Seal(nil, segmentNonce(index, last), plaintext, f.header)
+}
+
+// Decrypter opens chunked files, deriving each archive key only once
+type Decrypter struct {
+	password string
+	limits   KDFLimits
+	mu       sync.Mutex
+	archives map[string][]byte
+	files    map[string]cipher.AEAD
+}
+
+// NewDecrypter creates a decrypter for archives encrypted with password
+func NewDecrypter(password string) *Decrypter {
+	return &Decrypter{
+		password: password,
+		limits:   DefaultKDFLimits,
+		archives: make(map[string][]byte),
+		files:    make(map[string]cipher.AEAD),
+	}
+}
+
+// SetKDFLimits changes the key derivation costs accepted from file headers
+func (d *Decrypter) SetKDFLimits(limits KDFLimits) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.limits = limits
+}
+
+// OpenSegment decrypts a single segment of the file with this header
+func (d *Decrypter) OpenSegment(header string, index int, last bool, ciphertext []byte) ([]byte, error) {
+	h, aead, err := d.file(header)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, segmentNonce(index, last), ciphertext, h.raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt segment %d: %w", index, err)
+	}
+	return plaintext, nil
+}
+
+// DecryptFile decrypts a whole stored file, the concatenation of its
+// encrypted segments
+func (d *Decrypter) DecryptFile(header string, data []byte) ([]byte, error) {
+	h, aead, err := d.file(header)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := h.segmentSize + SegmentOverhead
+	count := max((len(data)+stored-1)/stored, 1)
+
+	var plaintext []byte
+	for i := 0; i < count; i++ {
+		start := i * stored
+		end := min(start+stored, len(data))
+		segment, err := aead.Open(nil, segmentNonce(i, i == count-1), data[start:end], h.raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt segment %d: %w", i, err)
+		}
+		plaintext = append(plaintext, segment...)
+	}
+	return plaintext, nil
+}
+
+// file returns the decoded header and the cipher for a file
+func (d *Decrypter) file(header string) (*streamHeader, cipher.AEAD, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, err := parseStreamHeader(header, d.limits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if aead, ok := d.files[header]; ok {
+		return h, aead, nil
+	}
+	archive := string(h.kdf.Encode()) + string(h.salt)
+	key, ok := d.archives[archive]
+	switch {
+	case ok:
+	case h.kdf.Algorithm == 0:
+		return nil, nil, fmt.Errorf("file is encrypted under the archive data key, which has not been unwrapped")
+	case d.password == "":
+		return nil, nil, fmt.Errorf("password required for decryption")
+	default:
+		if key, err = h.kdf.Derive(d.password, h.salt); err != nil {
+			return nil, nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		d.archives[archive] = key
+	}
+	aead, err := fileAEAD(key, h.fileNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.files[header] = aead
+	return h, aead, nil
+}
+
+// fileAEAD derives a file's key from the archive key and its file nonce
+func fileAEAD(archiveKey, fileNonce []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, archiveKey, fileNonce, "pixelog chunk key", 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive file key: %w", err)
+	}
+	return newGCM(key)
+}
+
+// segmentNonce is the big-endian segment index followed by the last flag
+func segmentNonce(index int, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], uint64(index))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func sealSegments(t *testing.T, fileCipher *FileCipher, data []byte) [][]byte {
+	t.Helper()
+	size := fileCipher.SegmentSize()
+	var segments [][]byte
+	for i := 0; i == 0 || i*size < len(data); i++ {
+		end := min((i+1)*size, len(data))
+		segments = append(segments, fileCipher.Seal(i, end == len(data), data[i*size:end]))
+	}
+	return segments
+}
+
+func TestChunkedEncryptionRoundTrip(t *testing.T) {
+	key, err := NewArchiveKey("hunter2", testKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypter := NewDecrypter("hunter2")
+
+	for _, size := range []int{0, 1, 99, 100, 101, 1000} {
+		fileCipher, err := key.NewFile(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := bytes.Repeat([]byte{byte(size)}, size)
+		segments := sealSegments(t, fileCipher, data)
+
+		plaintext, err := decrypter.DecryptFile(fileCipher.Header(), bytes.Join(segments, nil))
+		if err != nil || !bytes.Equal(plaintext, data) {
+			t.Fatalf("size %d: round trip failed: %v", size, err)
+		}
+
+		// Any segment decrypts on its own
+		last := len(segments) - 1
+		segment, err := decrypter.OpenSegment(fileCipher.Header(), last, true, segments[last])
+		if err != nil || !bytes.Equal(segment, data[last*100:]) {
+			t.Fatalf("size %d: random access failed: %v", size, err)
+		}
+	}
+}
+
+func TestChunkedEncryptionRejectsTampering(t *testing.T) {
+	key, _ := NewArchiveKey("hunter2", testKDF)
+	fileCipher, _ := key.NewFile(16)
+	segments := sealSegments(t, fileCipher, bytes.Repeat([]byte("x"), 64))
+	header := fileCipher.Header()
+	decrypter := NewDecrypter("hunter2")
+
+	if _, err := decrypter.OpenSegment(header, 1, false, segments[2]); err == nil {
+		t.Error("segment opened at the wrong index")
+	}
+	if _, err := decrypter.DecryptFile(header, bytes.Join(segments[:3], nil)); err == nil {
+		t.Error("truncated file decrypted")
+	}
+
+	other, _ := key.NewFile(16)
+	if _, err := decrypter.OpenSegment(other.Header(), 0, false, segments[0]); err == nil {
+		t.Error("segment opened under another file's header")
+	}
+
+	if _, err := NewDecrypter("wrong").DecryptFile(header, bytes.Join(segments, nil)); err == nil {
+		t.Error("wrong password decrypted the file")
+	}
+}
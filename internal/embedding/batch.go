@@ -0,0 +1,275 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchSize   = 64 // Texts per request, within every provider's limit
+	DefaultConcurrency = 4
+	DefaultRetries     = 5
+	DefaultTimeout     = 60 * time.Second
+
+	maxBackoff = 30 * time.Second
+)
+
+// BatchProvider is a Provider whose API embeds several texts per request
+type BatchProvider interface {
+	Provider
+	// EmbedBatch returns one vector per text, in order
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// BatchOptions tunes EmbedAll. Zero values pick the defaults.
+type BatchOptions struct {
+	BatchSize   int           // Texts per request
+	Concurrency int           // Requests in flight at once
+	Rate        float64       // Requests started per second, unlimited if 0
+	Retries     int           // Retries of a request after 429, 5xx or network errors, none if negative
+	Timeout     time.Duration // Limit on each attempt of a request
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultBatchSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.Retries == 0 {
+		o.Retries = DefaultRetries
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	return o
+}
+
+// StatusError is an error response from an embedding API
+type StatusError struct {
+	Provider   string
+	Code       int
+	Body       string
+	RetryAfter time.Duration // From the Retry-After header, 0 if absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.Code, e.Body)
+}
+
+// Failure is a text EmbedAll could not embed
+type Failure struct {
+	Index int // Position in the texts passed to EmbedAll
+	Err   error
+}
+
+// BatchError lists the texts that failed when others succeeded or all
+// failed for different reasons
+type BatchError struct {
+	Failures []Failure // Sorted by Index
+	Total    int
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to embed %d of %d texts: %v", len(e.Failures), e.Total, e.Failures[0].Err)
+}
+
+// EmbedAll embeds texts in batches, Concurrency requests at a time and at
+// most Rate per second, retrying rate limited and failed requests with
+// exponential backoff. It returns a vector for every text, or with a
+// *BatchError the vectors that succeeded and nil for the rest. When an API
+// rejects a batch its texts are retried one by one, so one bad input fails
+// only itself. progress, if set, is called with the number of texts done.
+func EmbedAll(ctx context.Context, p Provider, texts []string, opts BatchOptions, progress func(done int)) ([][]float32, error) {
+	opts = opts.withDefaults()
+	vectors := make([][]float32, len(texts))
+	if len(texts) == 0 {
+		return vectors, nil
+	}
+
+	batches := make(chan int) // Start of each batch
+	go func() {
+		defer close(batches)
+		for start := 0; start < len(texts); start += opts.BatchSize {
+			select {
+			case batches <- start:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	b := &batcher{provider: p, opts: opts, limiter: newLimiter(opts.Rate)}
+	var (
+		mu       sync.Mutex
+		done     int
+		failures []Failure
+		wg       sync.WaitGroup
+	)
+	for range min(opts.Concurrency, (len(texts)+opts.BatchSize-1)/opts.BatchSize) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				end := min(start+opts.BatchSize, len(texts))
+				batch, errs := b.embed(ctx, texts[start:end])
+
+				mu.Lock()
+				for i, vector := range batch {
+					if errs[i] != nil {
+						failures = append(failures, Failure{Index: start + i, Err: errs[i]})
+						continue
+					}
+					vectors[start+i] = vector
+				}
+				done += end - start
+				if progress != nil {
+					progress(done)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to embed texts: %w", err)
+	}
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Index < failures[j].Index })
+		return vectors, &BatchError{Failures: failures, Total: len(texts)}
+	}
+	return vectors, nil
+}
+
+type batcher struct {
+	provider Provider
+	opts     BatchOptions
+	limiter  *limiter
+}
+
+// embed returns a vector or an error for every text
+func (b *batcher) embed(ctx context.Context, texts []string) ([][]float32, []error) {
+	vectors := make([][]float32, len(texts))
+	errs := make([]error, len(texts))
+
+	bp, ok := b.provider.(BatchProvider)
+	if ok && len(texts) > 1 {
+		err := b.retry(ctx, func(ctx context.Context) error {
+			batch, err := bp.EmbedBatch(ctx, texts)
+			if err == nil && len(batch) != len(texts) {
+				err = fmt.Errorf("%d embeddings returned for %d texts", len(batch), len(texts))
+			}
+			if err == nil {
+				copy(vectors, batch)
+			}
+			return err
+		})
+		// A request rejected outright may be down to one text, so find the
+		// texts that fail by themselves. Other failures would only repeat.
+		if err == nil || ctx.Err() != nil || retryable(err) {
+			for i := range errs {
+				errs[i] = err
+			}
+			return vectors, errs
+		}
+	}
+
+	for i, text := range texts {
+		errs[i] = b.retry(ctx, func(ctx context.Context) error {
+			vector, err := b.provider.Embed(ctx, text)
+			vectors[i] = vector
+			return err
+		})
+	}
+	return vectors, errs
+}
+
+// retry makes a request until it succeeds, fails permanently or runs out
+// of retries, waiting for the rate limiter before every attempt
+func (b *batcher) retry(ctx context.Context, request func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		if err := b.limiter.wait(ctx); err != nil {
+			return err
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+		err := request(reqCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil || attempt >= b.opts.Retries || !retryable(err) {
+			return err
+		}
+
+		// Exponential backoff with jitter, or as long as the server asked
+		delay := min(maxBackoff, 500*time.Millisecond<<attempt)
+		delay = delay/2 + rand.N(delay/2+1)
+		var status *StatusError
+		if errors.As(err, &status) && status.RetryAfter > delay {
+			delay = status.RetryAfter
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retryable reports whether a failed request may succeed if repeated
+func retryable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code == http.StatusTooManyRequests || status.Code >= 500
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// limiter is a token bucket holding up to a second's worth of requests
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter allows rate requests per second, nil for no limit
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: rate, tokens: 1, last: time.Now()}
+}
+
+// wait takes a token, sleeping until one is available
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(max(1, l.rate), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEmbedAll(t *testing.T) {
+	var requests, limited atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		// Rate limit the first request, reject any containing a bad text
+		if limited.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if slices.Contains(req.Input, "bad") {
+			http.Error(w, "invalid input", http.StatusBadRequest)
+			return
+		}
+
+		type item struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var resp struct {
+			Data []item `json:"data"`
+		}
+		for i := len(req.Input) - 1; i >= 0; i-- { // Out of order, as the API allows
+			resp.Data = append(resp.Data, item{i, []float32{float32(len(req.Input[i])), 1}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	texts := []string{"a", "bb", "ccc", "bad", "eeeee", "ffffff", "g"}
+	p := newOpenAICompatible("test", "model", server.URL, "key", nil)
+	vectors, err := EmbedAll(context.Background(), p, texts, BatchOptions{BatchSize: 3, Concurrency: 2}, nil)
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failures) != 1 || batchErr.Failures[0].Index != 3 {
+		t.Fatalf("EmbedAll error = %v, want only text 3 failed", err)
+	}
+	for i, text := range texts {
+		if i == 3 {
+			if vectors[i] != nil {
+				t.Error("failed text has a vector")
+			}
+			continue
+		}
+		if len(vectors[i]) != 2 || vectors[i][0] != float32(len(text)) {
+			t.Errorf("text %d got vector %v", i, vectors[i])
+		}
+	}
+
+	// One rate limited retry, three batches, and the rejected batch again
+	// text by text
+	if n := requests.Load(); n != 1+3+3 {
+		t.Errorf("made %d requests, want 7", n)
+	}
+}
@@ -0,0 +1,395 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheMaxBytes bounds the cache unless configured otherwise
+const DefaultCacheMaxBytes = 1 << 30
+
+// TextHash is the cache key of a text: its hex SHA-256, the same as
+// index.FrameIndex.ContentHash
+func TextHash(text string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(text)))
+}
+
+// DefaultCacheDir is where embeddings are cached unless configured
+// otherwise, "" if the platform has no cache directory
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pixelog", "embeddings")
+}
+
+// Cache keeps embeddings on disk by model and text hash, so re-indexing
+// text that was embedded before costs no API calls. Each vector is a file
+// of little-endian float32s at <dir>/<model>/<hash[:2]>/<hash>. When the
+// cache grows past its limit the least recently used entries are removed.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu   sync.Mutex
+	size int64 // Bytes stored, -1 until first needed
+}
+
+// CacheStats describes what a cache holds
+type CacheStats struct {
+	Entries int
+	Bytes   int64
+	Models  map[string]ModelStats // By model directory name
+}
+
+// ModelStats describes the cached embeddings of one model
+type ModelStats struct {
+	Entries int
+	Bytes   int64
+}
+
+// NewCache opens the cache in dir, which is created when first written.
+// maxBytes of 0 or less means DefaultCacheMaxBytes.
+func NewCache(dir string, maxBytes int64) *Cache {
+	if maxBytes <= 0 {
+		maxBytes = DefaultCacheMaxBytes
+	}
+	return &Cache{dir: dir, maxBytes: maxBytes, size: -1}
+}
+
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// path is where the embedding of a text hash by a model is kept. Model
+// names are reduced to characters every file system accepts.
+func (c *Cache) path(model, hash string) string {
+	return filepath.Join(c.dir, modelDir(model), hash[:2], hash)
+}
+
+func modelDir(model string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, model)
+}
+
+// Get returns the cached embedding of a text hash by a model
+func (c *Cache) Get(model, hash string) ([]float32, bool) {
+	path := c.path(model, hash)
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 || len(data)%4 != 0 {
+		return nil, false
+	}
+
+	// The modification time records use, for least recently used eviction
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vector, true
+}
+
+// Put stores the embedding of a text hash by a model, evicting old entries
+// if the cache is over its limit
+func (c *Cache) Put(model, hash string, vector []float32) error {
+	data := make([]byte, len(vector)*4)
+	for i, x := range vector {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(x))
+	}
+
+	path := c.path(model, hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	// Written aside and renamed, so concurrent readers never see half a vector
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size < 0 {
+		stats, err := c.Stats()
+		if err != nil {
+			return err
+		}
+		c.size = stats.Bytes
+	} else {
+		c.size += int64(len(data))
+	}
+	if c.size > c.maxBytes {
+		// Prune below the limit, so the next few writes don't prune again
+		if _, _, err := c.prune(c.maxBytes * 9 / 10); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheEntry is a cached vector file found by walk
+type cacheEntry struct {
+	path  string
+	model string
+	size  int64
+	used  time.Time
+}
+
+// walk lists every entry in the cache. Only files laid out as entries,
+// <model>/<hash[:2]>/<hash>, are entries; anything else sharing the
+// directory is left alone.
+func (c *Cache) walk() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(c.dir, path)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 3 || !isTextHash(parts[2]) || parts[1] != parts[2][:2] || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed since the directory was read
+		}
+		entries = append(entries, cacheEntry{path, parts[0], info.Size(), info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	return entries, nil
+}
+
+// isTextHash reports whether name is a TextHash
+func isTextHash(name string) bool {
+	return len(name) == 2*sha256.Size && isHex(name)
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats counts the cached embeddings
+func (c *Cache) Stats() (CacheStats, error) {
+	entries, err := c.walk()
+	if err != nil {
+		return CacheStats{}, err
+	}
+	stats := CacheStats{Models: map[string]ModelStats{}}
+	for _, e := range entries {
+		m := stats.Models[e.model]
+		m.Entries++
+		m.Bytes += e.size
+		stats.Models[e.model] = m
+		stats.Entries++
+		stats.Bytes += e.size
+	}
+	return stats, nil
+}
+
+// Prune removes the least recently used entries until the cache holds at
+// most maxBytes, returning how many entries and bytes were removed
+func (c *Cache) Prune(maxBytes int64) (int, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.prune(maxBytes)
+}
+
+func (c *Cache) prune(maxBytes int64) (int, int64, error) {
+	entries, err := c.walk()
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+
+	removed, freed := 0, int64(0)
+	for _, e := range entries {
+		if size-freed <= maxBytes {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return removed, freed, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		removed++
+		freed += e.size
+	}
+	c.size = size - freed
+	return removed, freed, nil
+}
+
+// Clear removes every cached embedding and the directories that held them.
+// The cache directory itself and files that are not entries are kept.
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.walk()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+	}
+
+	// Remove the now empty prefix and model directories. Directories still
+	// holding other files fail to remove and stay.
+	models, _ := os.ReadDir(c.dir)
+	for _, model := range models {
+		if !model.IsDir() {
+			continue
+		}
+		prefixes, _ := os.ReadDir(filepath.Join(c.dir, model.Name()))
+		for _, prefix := range prefixes {
+			if prefix.IsDir() && len(prefix.Name()) == 2 && isHex(prefix.Name()) {
+				os.Remove(filepath.Join(c.dir, model.Name(), prefix.Name()))
+			}
+		}
+		os.Remove(filepath.Join(c.dir, model.Name()))
+	}
+	c.size = 0
+	return nil
+}
+
+// Cached is a Provider that looks embeddings up in a Cache before asking
+// the provider it wraps
+type Cached struct {
+	Provider
+	cache *Cache
+
+	hits, misses atomic.Int64
+}
+
+// NewCached wraps p with c
+func NewCached(p Provider, c *Cache) *Cached {
+	return &Cached{Provider: p, cache: c}
+}
+
+// Counts returns how many embeddings came from the cache and how many from
+// the provider
+func (p *Cached) Counts() (hits, misses int64) {
+	return p.hits.Load(), p.misses.Load()
+}
+
+func (p *Cached) Embed(ctx context.Context, text string) ([]float32, error) {
+	hash := TextHash(text)
+	if vector, ok := p.cache.Get(p.Model(), hash); ok {
+		p.hits.Add(1)
+		return vector, nil
+	}
+	vector, err := p.Provider.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	p.misses.Add(1)
+	p.store(hash, vector)
+	return vector, nil
+}
+
+// EmbedBatch asks the wrapped provider for the texts not in the cache only,
+// in one request if it supports batches
+func (p *Cached) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	hashes := make([]string, len(texts))
+	var missing []int
+	for i, text := range texts {
+		hashes[i] = TextHash(text)
+		if vector, ok := p.cache.Get(p.Model(), hashes[i]); ok {
+			vectors[i] = vector
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	p.hits.Add(int64(len(texts) - len(missing)))
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	uncached := make([]string, len(missing))
+	for i, pos := range missing {
+		uncached[i] = texts[pos]
+	}
+	var embedded [][]float32
+	if bp, ok := p.Provider.(BatchProvider); ok {
+		var err error
+		if embedded, err = bp.EmbedBatch(ctx, uncached); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, text := range uncached {
+			vector, err := p.Provider.Embed(ctx, text)
+			if err != nil {
+				return nil, err
+			}
+			embedded = append(embedded, vector)
+		}
+	}
+	if len(embedded) != len(missing) {
+		return nil, fmt.Errorf("%d embeddings returned for %d texts", len(embedded), len(missing))
+	}
+
+	p.misses.Add(int64(len(missing)))
+	for i, pos := range missing {
+		vectors[pos] = embedded[i]
+		p.store(hashes[pos], embedded[i])
+	}
+	return vectors, nil
+}
+
+// store caches an embedding. A cache that can't be written only costs
+// another API call later, so failures are not errors.
+func (p *Cached) store(hash string, vector []float32) {
+	if len(vector) > 0 {
+		p.cache.Put(p.Model(), hash, vector)
+	}
+}
@@ -0,0 +1,106 @@
+package embedding
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// countingProvider embeds a text as its length, counting the texts asked for
+type countingProvider struct {
+	embedded []string
+}
+
+func (p *countingProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	p.embedded = append(p.embedded, text)
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (p *countingProvider) Dim() int      { return 2 }
+func (p *countingProvider) Model() string { return "test:model/v1" }
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(t.TempDir(), 0)
+	inner := &countingProvider{}
+	p := NewCached(inner, cache)
+
+	if _, err := p.EmbedBatch(ctx, []string{"one", "three"}); err != nil {
+		t.Fatal(err)
+	}
+	vectors, err := p.EmbedBatch(ctx, []string{"three", "seven", "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(inner.embedded, []string{"one", "three", "seven"}) {
+		t.Errorf("provider embedded %q, want each text once", inner.embedded)
+	}
+	if vectors[0][0] != 5 || vectors[1][0] != 5 || vectors[2][0] != 3 {
+		t.Errorf("EmbedBatch returned %v", vectors)
+	}
+	if hits, misses := p.Counts(); hits != 2 || misses != 3 {
+		t.Errorf("Counts = %d hits, %d misses, want 2, 3", hits, misses)
+	}
+
+	stats, err := cache.Stats()
+	if err != nil || stats.Entries != 3 || stats.Bytes != 3*8 || stats.Models["test_model_v1"].Entries != 3 {
+		t.Fatalf("Stats = %+v, %v", stats, err)
+	}
+
+	// Make "one" the least recently used, then prune one entry
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(cache.path(p.Model(), TextHash("one")), old, old)
+	removed, freed, err := cache.Prune(2 * 8)
+	if err != nil || removed != 1 || freed != 8 {
+		t.Fatalf("Prune = %d, %d, %v", removed, freed, err)
+	}
+	if _, ok := cache.Get(p.Model(), TextHash("one")); ok {
+		t.Error("least recently used entry survived pruning")
+	}
+	if _, ok := cache.Get(p.Model(), TextHash("seven")); !ok {
+		t.Error("recently used entry was pruned")
+	}
+
+	// Writes past the limit evict without a prune command
+	small := NewCache(cache.Dir(), 4*8)
+	for _, text := range []string{"a", "bb", "ccc", "dddd", "eeeee"} {
+		if err := small.Put("test:model/v1", TextHash(text), []float32{1, 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats, _ := small.Stats(); stats.Bytes > small.MaxBytes() {
+		t.Errorf("cache holds %d bytes, limit %d", stats.Bytes, small.MaxBytes())
+	}
+
+	// Files that are not entries are neither counted nor removed, even when
+	// the cache directory is shared with other data
+	foreign := []string{
+		filepath.Join(cache.Dir(), "notes.txt"),
+		filepath.Join(cache.Dir(), "test_model_v1", "notes.txt"),
+		filepath.Join(cache.Dir(), "test_model_v1", "zz", TextHash("x")),
+	}
+	for _, path := range foreign {
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte("keep"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, _ := small.Stats()
+	if err := small.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := small.Stats(); stats.Entries != 0 || before.Bytes > small.MaxBytes() {
+		t.Errorf("Stats = %+v before and %+v after Clear", before, stats)
+	}
+	for _, path := range foreign {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Clear removed %s", path)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(cache.Dir(), "test_model_v1")); len(entries) != 2 {
+		t.Errorf("Clear left %d of the model's directories, want only the foreign ones", len(entries))
+	}
+}
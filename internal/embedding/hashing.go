@@ -0,0 +1,133 @@
+// Package embedding turns text into vectors for semantic search, through
+// a registry of remote providers and an offline embedder that needs no
+// network connection, GPU or model files.
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultDim is the vector size of NewHashingEmbedder(0). Larger vectors
+	// collide less but make indexes bigger.
+	DefaultDim = 512
+
+	hashModel = "hash-v1" // Model name of the local provider, before the dimension
+)
+
+func init() {
+	Register("local", hashModel,
+		func(opts Options) bool { return true },
+		func(opts Options, model string) (Provider, error) {
+			if model == hashModel {
+				return NewHashingEmbedder(opts.Dim), nil
+			}
+			dim, err := strconv.Atoi(strings.TrimPrefix(model, hashModel+"-"))
+			if !strings.HasPrefix(model, hashModel+"-") || err != nil || dim <= 0 {
+				return nil, fmt.Errorf("unknown local embedding model %q", model)
+			}
+			return NewHashingEmbedder(dim), nil
+		})
+}
+
+// Feature weights. Character trigrams let related word forms ("index",
+// "indexing") share features; bigrams reward phrases appearing intact.
+const (
+	wordWeight    = 1.0
+	bigramWeight  = 0.5
+	trigramWeight = 0.3
+)
+
+// HashingEmbedder maps text to vectors by feature hashing: every word,
+// word bigram and character trigram adds a signed weight to one of dim
+// buckets chosen by its hash. Texts sharing vocabulary get similar vectors,
+// which is lexical rather than true semantic similarity, but it is fully
+// deterministic and works air-gapped.
+type HashingEmbedder struct {
+	dim int
+}
+
+// NewHashingEmbedder creates an embedder producing dim-dimensional vectors,
+// DefaultDim if dim is 0 or less
+func NewHashingEmbedder(dim int) *HashingEmbedder {
+	if dim <= 0 {
+		dim = DefaultDim
+	}
+	return &HashingEmbedder{dim: dim}
+}
+
+// Model names the feature set and dimension
+func (e *HashingEmbedder) Model() string {
+	return "local:" + hashModel + "-" + strconv.Itoa(e.dim)
+}
+
+// Embed returns the unit-length vector of text, all zeros if it has no words
+func (e *HashingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+	vec := make([]float64, e.dim)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		weight := wordWeight
+		if stopWords[word] {
+			weight /= 4
+		}
+		e.add(vec, "w:"+word, weight)
+		if i > 0 {
+			e.add(vec, "b:"+words[i-1]+" "+word, bigramWeight)
+		}
+
+		runes := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(runes); j++ {
+			e.add(vec, "t:"+string(runes[j:j+3]), trigramWeight)
+		}
+	}
+
+	var norm float64
+	for _, x := range vec {
+		norm += x * x
+	}
+	out := make([]float32, e.dim)
+	if norm == 0 {
+		return out, nil
+	}
+	norm = math.Sqrt(norm)
+	for i, x := range vec {
+		out[i] = float32(x / norm)
+	}
+	return out, nil
+}
+
+// add hashes a feature to a bucket, with a sign from the same hash so
+// collisions cancel out on average instead of piling up
+func (e *HashingEmbedder) add(vec []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[sum%uint64(e.dim)] += weight
+}
+
+func (e *HashingEmbedder) Dim() int {
+	return e.dim
+}
+
+// stopWords carry little meaning, so they count a quarter of other words
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "from": true, "has": true,
+	"have": true, "in": true, "is": true, "it": true, "its": true, "of": true,
+	"on": true, "or": true, "that": true, "the": true, "this": true, "to": true,
+	"was": true, "were": true, "will": true, "with": true,
+}
@@ -0,0 +1,69 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestHashingEmbedder(t *testing.T) {
+	e := NewHashingEmbedder(0)
+	embed := func(text string) []float32 {
+		v, err := e.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v) != DefaultDim {
+			t.Fatalf("embedding has %d dimensions, want %d", len(v), DefaultDim)
+		}
+		return v
+	}
+
+	query := embed("How do I rotate the encryption keys?")
+	if n := dot(query, query); math.Abs(n-1) > 1e-5 {
+		t.Errorf("embedding length² = %v, want 1", n)
+	}
+	if again := embed("How do I rotate the encryption keys?"); dot(query, again) < 0.9999 {
+		t.Error("embedding is not deterministic")
+	}
+
+	related := embed("Rotating encryption keys: run pixe rekey with the old and new key")
+	unrelated := embed("The weather in the mountains was sunny all week")
+	if dot(query, related) <= dot(query, unrelated) {
+		t.Errorf("related text scored %.3f, unrelated %.3f", dot(query, related), dot(query, unrelated))
+	}
+
+	if empty := embed(" -- "); dot(empty, empty) != 0 {
+		t.Error("text without words has a non-zero embedding")
+	}
+}
+
+func TestForModel(t *testing.T) {
+	p, err := ForModel(NewHashingEmbedder(256).Model(), Options{})
+	if err != nil || p.Dim() != 256 {
+		t.Fatalf("ForModel = %v, %v", p, err)
+	}
+	for _, model := range []string{"text-embedding-3-small", "local:hash-v1--3", "openai:text-embedding-3-small", "nope:model"} {
+		if _, err := ForModel(model, Options{}); err == nil {
+			t.Errorf("ForModel(%q) succeeded", model)
+		}
+	}
+
+	// Without keys or a running Ollama, auto picks the offline embedder
+	p, err = New(Options{})
+	if err != nil || p.Model() != "local:hash-v1-512" {
+		t.Fatalf("New(auto) = %v, %v", p, err)
+	}
+	p, err = New(Options{OpenAIKey: "sk-test"})
+	if err != nil || p.Model() != "openai:text-embedding-3-large" || p.Dim() != 3072 {
+		t.Fatalf("New(auto) with an OpenAI key = %v, %v", p, err)
+	}
+}
@@ -0,0 +1,184 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ArqonAi/Pixelog/pkg/config"
+)
+
+// Provider turns text into vectors. The CLI indexer and the API search
+// service both embed through one, so an index built by either can be
+// searched by the other.
+type Provider interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// Dim is the vector size. Remote providers report their model's
+	// documented size until the first embedding shows the real one.
+	Dim() int
+	// Model names the provider and model as "provider:model". Only vectors
+	// from providers with the same Model are comparable.
+	Model() string
+}
+
+// Options selects a provider and holds the credentials of every provider,
+// so indexes built with any of them can be searched
+type Options struct {
+	Provider      string // Registered name, or "auto" or "" for the first usable one
+	Model         string // Model of the chosen provider, its default if empty
+	OpenAIKey     string
+	OpenRouterKey string
+	GoogleKey     string
+	OllamaURL     string // Ollama server, tried by "auto" only if it answers
+	Dim           int    // Vector size of the local provider, DefaultDim if 0
+	Cache         *Cache // Where remote providers' embeddings are kept, none if nil
+}
+
+// OptionsFromEnv reads the same environment variables as config.Default
+func OptionsFromEnv() Options {
+	maxMB, _ := strconv.Atoi(os.Getenv("EMBEDDING_CACHE_MAX_MB"))
+	return Options{
+		Provider:      os.Getenv("EMBEDDING_PROVIDER"),
+		OpenAIKey:     os.Getenv("OPENAI_API_KEY"),
+		OpenRouterKey: os.Getenv("OPENROUTER_API_KEY"),
+		GoogleKey:     os.Getenv("GOOGLE_API_KEY"),
+		OllamaURL:     os.Getenv("OLLAMA_BASE_URL"),
+		Cache:         cacheAt(os.Getenv("EMBEDDING_CACHE_DIR"), maxMB),
+	}
+}
+
+// cacheAt opens the cache in dir, DefaultCacheDir if empty, or none if dir
+// is "off"
+func cacheAt(dir string, maxMB int) *Cache {
+	if dir == "" {
+		dir = DefaultCacheDir()
+	}
+	if dir == "" || strings.EqualFold(dir, "off") {
+		return nil
+	}
+	return NewCache(dir, int64(maxMB)<<20)
+}
+
+// OptionsFromConfig takes the provider settings of a server configuration
+func OptionsFromConfig(cfg *config.Config) Options {
+	opts := Options{
+		Provider:      cfg.EmbeddingProvider,
+		OpenAIKey:     cfg.OpenAIAPIKey,
+		OpenRouterKey: cfg.OpenRouterAPIKey,
+		GoogleKey:     cfg.GoogleAPIKey,
+		OllamaURL:     cfg.OllamaBaseURL,
+		Cache:         cacheAt(cfg.EmbeddingCacheDir, cfg.EmbeddingCacheMaxMB),
+	}
+	switch strings.ToLower(opts.Provider) {
+	case "openrouter":
+		opts.Model = cfg.OpenRouterModel
+	case "ollama":
+		opts.Model = cfg.OllamaModel
+	}
+	return opts
+}
+
+// SetAPIKey stores a key given on the command line for the chosen
+// provider, or for OpenAI when the provider is picked automatically
+func (o *Options) SetAPIKey(key string) {
+	switch strings.ToLower(o.Provider) {
+	case "openrouter":
+		o.OpenRouterKey = key
+	case "gemini", "google":
+		o.GoogleKey = key
+	default:
+		o.OpenAIKey = key
+	}
+}
+
+type registration struct {
+	defaultModel string
+	usable       func(opts Options) bool // Whether "auto" may pick it
+	create       func(opts Options, model string) (Provider, error)
+}
+
+var registry = map[string]registration{}
+
+// autoOrder is the order "auto" tries providers in: remote services with
+// a key, then a running Ollama, then the offline embedder
+var autoOrder = []string{"openai", "openrouter", "gemini", "ollama", "local"}
+
+// Register makes a provider available to New under name
+func Register(name, defaultModel string, usable func(opts Options) bool, create func(opts Options, model string) (Provider, error)) {
+	registry[name] = registration{defaultModel, usable, create}
+}
+
+// Names lists the registered providers
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the provider opts select
+func New(opts Options) (Provider, error) {
+	name := strings.ToLower(opts.Provider)
+	if name == "google" {
+		name = "gemini"
+	}
+	if name == "" || name == "auto" {
+		for _, candidate := range autoOrder {
+			if r, ok := registry[candidate]; ok && r.usable(opts) {
+				name = candidate
+				break
+			}
+		}
+	}
+
+	r, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown embedding provider %q (use %s)", name, strings.Join(Names(), ", "))
+	}
+	model := opts.Model
+	if model == "" {
+		model = r.defaultModel
+	}
+	p, err := r.create(opts, model)
+	// The local embedder is faster than reading its vectors back
+	if err != nil || opts.Cache == nil || name == "local" {
+		return p, err
+	}
+	return NewCached(p, opts.Cache), nil
+}
+
+// ForModel creates a provider for a name returned by Provider.Model, to
+// embed queries against vectors stored with it
+func ForModel(model string, opts Options) (Provider, error) {
+	name, m, ok := strings.Cut(model, ":")
+	if !ok || name == "" || m == "" {
+		return nil, fmt.Errorf("unknown embedding model %q", model)
+	}
+	opts.Provider, opts.Model = name, m
+	return New(opts)
+}
+
+// Cosine returns the cosine similarity of two vectors, 0 if their sizes
+// differ or either is zero
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
@@ -0,0 +1,356 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultOllamaURL = "http://localhost:11434"
+
+	// Longer input is cut, since the APIs reject rather than truncate it
+	maxRemoteInput = 8000
+	maxOllamaInput = 32000
+)
+
+func init() {
+	Register("openai", "text-embedding-3-large",
+		func(opts Options) bool { return opts.OpenAIKey != "" },
+		func(opts Options, model string) (Provider, error) {
+			if opts.OpenAIKey == "" {
+				return nil, fmt.Errorf("OpenAI API key not configured")
+			}
+			return newOpenAICompatible("openai", model, "https://api.openai.com/v1/embeddings", opts.OpenAIKey, nil), nil
+		})
+	Register("openrouter", "openai/text-embedding-3-large",
+		func(opts Options) bool { return opts.OpenRouterKey != "" },
+		func(opts Options, model string) (Provider, error) {
+			if opts.OpenRouterKey == "" {
+				return nil, fmt.Errorf("OpenRouter API key not configured")
+			}
+			return newOpenAICompatible("openrouter", model, "https://openrouter.ai/api/v1/embeddings", opts.OpenRouterKey, map[string]string{
+				"HTTP-Referer": "https://github.com/ArqonAi/Pixelog",
+				"X-Title":      "Pixelog",
+			}), nil
+		})
+	Register("gemini", "models/text-embedding-004",
+		func(opts Options) bool { return opts.GoogleKey != "" },
+		func(opts Options, model string) (Provider, error) {
+			if opts.GoogleKey == "" {
+				return nil, fmt.Errorf("Google API key not configured")
+			}
+			return &gemini{remote: newRemote("gemini", model), apiKey: opts.GoogleKey}, nil
+		})
+	Register("ollama", "nomic-embed-text",
+		func(opts Options) bool { return opts.OllamaURL != "" && ollamaRunning(opts.OllamaURL) },
+		func(opts Options, model string) (Provider, error) {
+			url := opts.OllamaURL
+			if url == "" {
+				url = defaultOllamaURL
+			}
+			return &ollama{remote: newRemote("ollama", model), baseURL: strings.TrimSuffix(url, "/")}, nil
+		})
+}
+
+// remote holds what every HTTP provider shares
+type remote struct {
+	provider string
+	model    string
+	client   *http.Client
+
+	mu  sync.Mutex
+	dim int // Documented size of the model, then the size actually returned
+}
+
+func newRemote(provider, model string) remote {
+	return remote{
+		provider: provider,
+		model:    model,
+		client:   &http.Client{Timeout: 60 * time.Second},
+		dim:      knownDim(model),
+	}
+}
+
+func (r *remote) Model() string {
+	return r.provider + ":" + r.model
+}
+
+func (r *remote) Dim() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dim
+}
+
+// got records the size of a returned embedding
+func (r *remote) got(embedding []float32) ([]float32, error) {
+	if len(embedding) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+	r.mu.Lock()
+	r.dim = len(embedding)
+	r.mu.Unlock()
+	return embedding, nil
+}
+
+// post sends a JSON request and decodes the JSON response into out
+func (r *remote) post(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := &StatusError{Provider: r.provider, Code: resp.StatusCode, Body: string(body)}
+		if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+			err.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// openAICompatible speaks the OpenAI embeddings API, which OpenRouter
+// also serves
+type openAICompatible struct {
+	remote
+	url     string
+	headers map[string]string
+}
+
+func newOpenAICompatible(provider, model, url, apiKey string, headers map[string]string) *openAICompatible {
+	all := map[string]string{"Authorization": "Bearer " + apiKey}
+	for key, value := range headers {
+		all[key] = value
+	}
+	return &openAICompatible{remote: newRemote(provider, model), url: url, headers: all}
+}
+
+func (p *openAICompatible) Embed(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := p.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch sends every text in one request's input array
+func (p *openAICompatible) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	input := make([]string, len(texts))
+	for i, text := range texts {
+		input[i] = truncate(text, maxRemoteInput)
+	}
+	body := map[string]any{"input": input, "model": p.model}
+	if err := p.post(ctx, p.url, p.headers, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("%d embeddings returned for %d texts", len(resp.Data), len(texts))
+	}
+
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Index < resp.Data[j].Index })
+	embeddings := make([][]float32, len(texts))
+	for i, data := range resp.Data {
+		embedding, err := p.got(data.Embedding)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+// gemini uses the Google Generative Language API
+type gemini struct {
+	remote
+	apiKey string
+}
+
+func (p *gemini) Embed(ctx context.Context, text string) ([]float32, error) {
+	body := map[string]any{
+		"content": map[string]any{
+			"parts": []map[string]string{{"text": truncate(text, maxRemoteInput)}},
+		},
+	}
+	var resp struct {
+		Embedding struct {
+			Values []float32 `json:"values"`
+		} `json:"embedding"`
+	}
+	if err := p.post(ctx, p.url("embedContent"), map[string]string{"x-goog-api-key": p.apiKey}, body, &resp); err != nil {
+		return nil, err
+	}
+	return p.got(resp.Embedding.Values)
+}
+
+// EmbedBatch uses batchEmbedContents, which takes up to 100 texts
+func (p *gemini) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	requests := make([]map[string]any, len(texts))
+	for i, text := range texts {
+		requests[i] = map[string]any{
+			"model": p.modelPath(),
+			"content": map[string]any{
+				"parts": []map[string]string{{"text": truncate(text, maxRemoteInput)}},
+			},
+		}
+	}
+	var resp struct {
+		Embeddings []struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	}
+	body := map[string]any{"requests": requests}
+	if err := p.post(ctx, p.url("batchEmbedContents"), map[string]string{"x-goog-api-key": p.apiKey}, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("%d embeddings returned for %d texts", len(resp.Embeddings), len(texts))
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for i, e := range resp.Embeddings {
+		embedding, err := p.got(e.Values)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+func (p *gemini) modelPath() string {
+	if strings.HasPrefix(p.model, "models/") {
+		return p.model
+	}
+	return "models/" + p.model
+}
+
+func (p *gemini) url(method string) string {
+	return fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/%s:%s", p.modelPath(), method)
+}
+
+// ollama uses a local Ollama server
+type ollama struct {
+	remote
+	baseURL string
+}
+
+func (p *ollama) Embed(ctx context.Context, text string) ([]float32, error) {
+	var resp struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	body := map[string]string{"model": p.model, "prompt": truncate(text, maxOllamaInput)}
+	if err := p.post(ctx, p.baseURL+"/api/embeddings", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return p.got(resp.Embedding)
+}
+
+// EmbedBatch uses /api/embed, which takes an input array. Servers older
+// than that endpoint get one request per text.
+func (p *ollama) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	input := make([]string, len(texts))
+	for i, text := range texts {
+		input[i] = truncate(text, maxOllamaInput)
+	}
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	body := map[string]any{"model": p.model, "input": input}
+	err := p.post(ctx, p.baseURL+"/api/embed", nil, body, &resp)
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == http.StatusNotFound {
+		embeddings := make([][]float32, len(texts))
+		for i, text := range texts {
+			if embeddings[i], err = p.Embed(ctx, text); err != nil {
+				return nil, err
+			}
+		}
+		return embeddings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("%d embeddings returned for %d texts", len(resp.Embeddings), len(texts))
+	}
+
+	for i, embedding := range resp.Embeddings {
+		if resp.Embeddings[i], err = p.got(embedding); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Embeddings, nil
+}
+
+// ollamaRunning checks whether an Ollama server answers at baseURL
+func ollamaRunning(baseURL string) bool {
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(strings.TrimSuffix(baseURL, "/") + "/api/tags")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// knownDim is the documented vector size of a model, 0 if unknown
+func knownDim(model string) int {
+	switch {
+	case strings.Contains(model, "3-large"):
+		return 3072
+	case strings.Contains(model, "3-small"), strings.Contains(model, "ada-002"):
+		return 1536
+	case strings.Contains(model, "embedding-004"), strings.Contains(model, "nomic-embed"), strings.Contains(model, "embedding-001"):
+		return 768
+	case strings.Contains(model, "minilm"):
+		return 384
+	default:
+		return 0
+	}
+}
+
+// truncate cuts text to at most max bytes without splitting a character
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	for max > 0 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	return text[:max]
+}
@@ -0,0 +1,531 @@
+// Package hnsw implements Hierarchical Navigable Small World graphs
+// (Malkov and Yashunin, 2016) for approximate nearest-neighbour search by
+// cosine similarity.
+//
+// Every vector is a node on layer 0 and, with exponentially decreasing
+// probability, on the layers above it. A search walks greedily down from the
+// sparse top layer and then explores a bounded candidate list on layer 0,
+// touching a few thousand nodes instead of every vector.
+package hnsw
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// maxLevel bounds node levels; reaching it by chance is practically impossible
+const maxLevel = 31
+
+// maxDim and maxM bound the parameters a graph accepts, and so what reading
+// a corrupted file can allocate
+const (
+	maxDim = 1 << 16
+	maxM   = 1 << 10
+)
+
+// Config holds the graph parameters
+type Config struct {
+	M              int    // Links per node on upper layers; layer 0 allows 2*M
+	EfConstruction int    // Candidate list size while inserting
+	EfSearch       int    // Candidate list size while searching, raised to k if smaller
+	Seed           uint64 // Seeds level assignment, so identical inserts build identical graphs
+}
+
+// DefaultConfig suits embeddings of a few hundred to a few thousand dimensions
+var DefaultConfig = Config{M: 16, EfConstruction: 100, EfSearch: 64, Seed: 1}
+
+// Result is a stored vector matched by a search
+type Result struct {
+	Key   string
+	Score float32 // Cosine similarity to the query
+}
+
+type node struct {
+	key     string
+	vector  []float32  // Normalized, so cosine similarity is a dot product
+	links   [][]uint32 // Neighbour IDs per layer, 0 to the node's level
+	deleted bool       // Still routes searches but is never returned or linked to
+}
+
+// Graph is an HNSW index. It is safe for concurrent use; searches run in
+// parallel with each other but not with inserts and deletes.
+type Graph struct {
+	mu        sync.RWMutex
+	cfg       Config
+	dim       int
+	nodes     []*node // Indexed by ID, nil once a delete is purged
+	keys      map[string]uint32
+	free      []uint32 // IDs of purged nodes, reused by inserts
+	deleted   int      // Deleted nodes not yet purged
+	entry     int      // Entry point ID, -1 when empty
+	top       int      // Level of the entry point
+	rng       *rand.Rand
+	levelMult float64
+}
+
+// New creates an empty graph for vectors of dim dimensions. Zero fields in
+// cfg take their values from DefaultConfig.
+func New(dim int, cfg Config) (*Graph, error) {
+	if dim <= 0 || dim > maxDim {
+		return nil, fmt.Errorf("invalid vector dimension %d", dim)
+	}
+	if cfg.M == 0 {
+		cfg.M = DefaultConfig.M
+	}
+	if cfg.EfConstruction == 0 {
+		cfg.EfConstruction = DefaultConfig.EfConstruction
+	}
+	if cfg.EfSearch == 0 {
+		cfg.EfSearch = DefaultConfig.EfSearch
+	}
+	if cfg.M < 2 || cfg.M > maxM || cfg.EfConstruction < 1 || cfg.EfSearch < 1 {
+		return nil, fmt.Errorf("invalid HNSW parameters: M=%d efConstruction=%d efSearch=%d", cfg.M, cfg.EfConstruction, cfg.EfSearch)
+	}
+
+	return &Graph{
+		cfg:       cfg,
+		dim:       dim,
+		keys:      make(map[string]uint32),
+		entry:     -1,
+		rng:       rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)),
+		levelMult: 1 / math.Log(float64(cfg.M)),
+	}, nil
+}
+
+// Dim returns the vector dimension
+func (g *Graph) Dim() int {
+	return g.dim
+}
+
+// Len returns the number of vectors in the graph
+func (g *Graph) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.keys)
+}
+
+// SetEfSearch changes the search candidate list size. Larger values trade
+// speed for recall.
+func (g *Graph) SetEfSearch(ef int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ef > 0 {
+		g.cfg.EfSearch = ef
+	}
+}
+
+// Insert adds a vector under key, replacing any vector already stored there
+func (g *Graph) Insert(key string, vector []float32) error {
+	if len(vector) != g.dim {
+		return fmt.Errorf("vector has %d dimensions, index has %d", len(vector), g.dim)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if id, ok := g.keys[key]; ok {
+		g.remove(id)
+	}
+
+	level := g.randomLevel()
+	n := &node{key: key, vector: Normalize(vector), links: make([][]uint32, level+1)}
+	id := g.allocate(n)
+	g.keys[key] = id
+
+	if g.entry < 0 {
+		g.entry, g.top = int(id), level
+		return nil
+	}
+
+	// Descend greedily to the node's top layer, then link it on every layer
+	// from there down
+	ep := []candidate{{id: uint32(g.entry), dist: distance(n.vector, g.nodes[g.entry].vector)}}
+	for layer := g.top; layer > level; layer-- {
+		ep = g.searchLayer(n.vector, ep, 1, layer)
+	}
+	for layer := min(level, g.top); layer >= 0; layer-- {
+		candidates := g.searchLayer(n.vector, ep, g.cfg.EfConstruction, layer)
+		n.links[layer] = g.selectNeighbors(n.vector, g.live(candidates), g.cfg.M)
+		for _, nb := range n.links[layer] {
+			g.link(nb, id, layer)
+		}
+		ep = candidates
+	}
+
+	if level > g.top {
+		g.entry, g.top = int(id), level
+	}
+	return nil
+}
+
+// Delete removes the vector stored under key and reports whether it existed.
+// The node keeps routing searches until deletes make up a fifth of the
+// graph; then one pass reconnects every node that linked to a deleted one
+// through the deleted node's neighbours, so the graph stays navigable
+// without a rebuild and a delete costs O(M) amortized.
+func (g *Graph) Delete(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id, ok := g.keys[key]
+	if !ok {
+		return false
+	}
+	g.remove(id)
+	return true
+}
+
+// Search returns up to k stored vectors most similar to query, best first
+func (g *Graph) Search(query []float32, k int) []Result {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.search(query, k, g.cfg.EfSearch)
+}
+
+// SearchEf is Search with an explicit candidate list size
+func (g *Graph) SearchEf(query []float32, k, ef int) []Result {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.search(query, k, ef)
+}
+
+func (g *Graph) search(query []float32, k, ef int) []Result {
+	if g.entry < 0 || k <= 0 || len(query) != g.dim {
+		return nil
+	}
+
+	q := Normalize(query)
+	ep := []candidate{{id: uint32(g.entry), dist: distance(q, g.nodes[g.entry].vector)}}
+	for layer := g.top; layer > 0; layer-- {
+		ep = g.searchLayer(q, ep, 1, layer)
+	}
+	found := g.live(g.searchLayer(q, ep, max(ef, k), 0))
+	if len(found) > k {
+		found = found[:k]
+	}
+	results := make([]Result, len(found))
+	for i, c := range found {
+		results[i] = Result{Key: g.nodes[c.id].key, Score: 1 - c.dist}
+	}
+	return results
+}
+
+// remove marks a node deleted, purging deleted nodes once they make up a
+// fifth of the graph
+func (g *Graph) remove(id uint32) {
+	gone := g.nodes[id]
+	delete(g.keys, gone.key)
+	gone.deleted = true
+	g.deleted++
+	if g.deleted*4 > len(g.keys) {
+		g.purge()
+	}
+}
+
+// purge frees deleted nodes. Each node linking to one is relinked among its
+// other links and the deleted node's links, following those through further
+// deleted nodes, which keeps the neighbourhoods the paths ran through.
+func (g *Graph) purge() {
+	for id, n := range g.nodes {
+		if n == nil || n.deleted {
+			continue
+		}
+		for layer, links := range n.links {
+			if !slices.ContainsFunc(links, func(nb uint32) bool { return g.nodes[nb].deleted }) {
+				continue
+			}
+			var candidates []candidate
+			seen := map[uint32]bool{uint32(id): true}
+			pending := slices.Clone(links)
+			for len(pending) > 0 {
+				nb := pending[len(pending)-1]
+				pending = pending[:len(pending)-1]
+				if seen[nb] {
+					continue
+				}
+				seen[nb] = true
+				if other := g.nodes[nb]; other.deleted {
+					pending = append(pending, other.links[layer]...)
+				} else {
+					candidates = append(candidates, candidate{id: nb, dist: distance(n.vector, other.vector)})
+				}
+			}
+			sortCandidates(candidates)
+			n.links[layer] = g.selectNeighbors(n.vector, candidates, g.maxLinks(layer))
+		}
+	}
+
+	if g.entry >= 0 && g.nodes[g.entry].deleted {
+		g.entry, g.top = -1, 0
+		for id, n := range g.nodes {
+			if n != nil && !n.deleted && (g.entry < 0 || len(n.links)-1 > g.top) {
+				g.entry, g.top = id, len(n.links)-1
+			}
+		}
+	}
+	for id, n := range g.nodes {
+		if n != nil && n.deleted {
+			g.nodes[id] = nil
+			g.free = append(g.free, uint32(id))
+		}
+	}
+	g.deleted = 0
+}
+
+// live filters deleted nodes out of candidates
+func (g *Graph) live(candidates []candidate) []candidate {
+	if g.deleted == 0 {
+		return candidates
+	}
+	return slices.DeleteFunc(slices.Clone(candidates), func(c candidate) bool { return g.nodes[c.id].deleted })
+}
+
+// link adds a directed edge, pruning the node's links if it has too many
+func (g *Graph) link(from, to uint32, layer int) {
+	n := g.nodes[from]
+	n.links[layer] = append(n.links[layer], to)
+	if len(n.links[layer]) <= g.maxLinks(layer) {
+		return
+	}
+
+	candidates := make([]candidate, len(n.links[layer]))
+	for i, nb := range n.links[layer] {
+		candidates[i] = candidate{id: nb, dist: distance(n.vector, g.nodes[nb].vector)}
+	}
+	candidates = g.live(candidates)
+	sortCandidates(candidates)
+	n.links[layer] = g.selectNeighbors(n.vector, candidates, g.maxLinks(layer))
+}
+
+// selectNeighbors picks up to m of the candidates, sorted by distance, using
+// the paper's heuristic: a candidate is skipped if it is closer to an already
+// selected neighbour than to the base, which spreads links across clusters.
+// Skipped candidates top the list up to m so small graphs stay connected.
+func (g *Graph) selectNeighbors(base []float32, candidates []candidate, m int) []uint32 {
+	selected := make([]uint32, 0, m)
+	var skipped []uint32
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if distance(g.nodes[c.id].vector, g.nodes[s].vector) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+	for _, id := range skipped {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// searchLayer finds the ef nodes closest to q on one layer, starting from
+// the entry points, and returns them sorted by distance
+func (g *Graph) searchLayer(q []float32, entry []candidate, ef, layer int) []candidate {
+	visited := g.visitedSet()
+	defer visitedPool.Put(visited)
+
+	var pending, best candidateHeap
+	for _, c := range entry {
+		if visited.visit(c.id) {
+			pending.push(c, closer)
+			best.push(c, further)
+		}
+	}
+	for len(best) > ef {
+		best.pop(further)
+	}
+
+	for len(pending) > 0 {
+		c := pending.pop(closer)
+		if len(best) >= ef && c.dist > best[0].dist {
+			break
+		}
+		for _, nb := range g.nodes[c.id].links[layer] {
+			if !visited.visit(nb) {
+				continue
+			}
+			d := distance(q, g.nodes[nb].vector)
+			if len(best) < ef || d < best[0].dist {
+				pending.push(candidate{id: nb, dist: d}, closer)
+				best.push(candidate{id: nb, dist: d}, further)
+				if len(best) > ef {
+					best.pop(further)
+				}
+			}
+		}
+	}
+
+	found := []candidate(best)
+	sortCandidates(found)
+	return found
+}
+
+// visitedSet marks nodes seen by one search. Sets are pooled and cleared
+// by bumping a generation counter instead of zeroing them.
+type visitedSet struct {
+	marks      []uint32
+	generation uint32
+}
+
+var visitedPool = sync.Pool{New: func() any { return &visitedSet{} }}
+
+func (g *Graph) visitedSet() *visitedSet {
+	v := visitedPool.Get().(*visitedSet)
+	if len(v.marks) < len(g.nodes) {
+		v.marks = make([]uint32, len(g.nodes)+len(g.nodes)/4)
+		v.generation = 0
+	}
+	v.generation++
+	if v.generation == 0 {
+		clear(v.marks)
+		v.generation = 1
+	}
+	return v
+}
+
+// visit marks id and reports whether it was unmarked
+func (v *visitedSet) visit(id uint32) bool {
+	if v.marks[id] == v.generation {
+		return false
+	}
+	v.marks[id] = v.generation
+	return true
+}
+
+func (g *Graph) allocate(n *node) uint32 {
+	if len(g.free) > 0 {
+		id := g.free[len(g.free)-1]
+		g.free = g.free[:len(g.free)-1]
+		g.nodes[id] = n
+		return id
+	}
+	g.nodes = append(g.nodes, n)
+	return uint32(len(g.nodes) - 1)
+}
+
+// randomLevel draws a level with P(level >= l) = M^-l
+func (g *Graph) randomLevel() int {
+	level := int(-math.Log(1-g.rng.Float64()) * g.levelMult)
+	return min(level, maxLevel)
+}
+
+func (g *Graph) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * g.cfg.M
+	}
+	return g.cfg.M
+}
+
+type candidate struct {
+	id   uint32
+	dist float32
+}
+
+func sortCandidates(c []candidate) {
+	slices.SortFunc(c, func(a, b candidate) int { return cmp.Compare(a.dist, b.dist) })
+}
+
+// candidateHeap is a binary heap ordered by before, which puts the closest
+// candidate on top for the search frontier and the furthest on top for the
+// result set, where it is the one evicted. It avoids container/heap's
+// interface conversions in the innermost loop.
+type candidateHeap []candidate
+
+func closer(a, b candidate) bool  { return a.dist < b.dist }
+func further(a, b candidate) bool { return a.dist > b.dist }
+
+func (h *candidateHeap) push(c candidate, before func(a, b candidate) bool) {
+	*h = append(*h, c)
+	s := *h
+	for i := len(s) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !before(s[i], s[parent]) {
+			break
+		}
+		s[i], s[parent] = s[parent], s[i]
+		i = parent
+	}
+}
+
+func (h *candidateHeap) pop(before func(a, b candidate) bool) candidate {
+	s := *h
+	top := s[0]
+	last := len(s) - 1
+	s[0] = s[last]
+	s = s[:last]
+	for i := 0; ; {
+		child := 2*i + 1
+		if child >= len(s) {
+			break
+		}
+		if child+1 < len(s) && before(s[child+1], s[child]) {
+			child++
+		}
+		if !before(s[child], s[i]) {
+			break
+		}
+		s[i], s[child] = s[child], s[i]
+		i = child
+	}
+	*h = s
+	return top
+}
+
+// distance is the cosine distance between normalized vectors
+func distance(a, b []float32) float32 {
+	b = b[:len(a)]
+	var d0, d1, d2, d3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		d0 += a[i] * b[i]
+		d1 += a[i+1] * b[i+1]
+		d2 += a[i+2] * b[i+2]
+		d3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		d0 += a[i] * b[i]
+	}
+	return 1 - (d0 + d1 + d2 + d3)
+}
+
+// Normalize returns a unit-length copy of v; zero vectors stay zero
+func Normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	scale := 1 / math.Sqrt(norm)
+	for i, x := range v {
+		out[i] = float32(float64(x) * scale)
+	}
+	return out
+}
+
+func indexOf(ids []uint32, id uint32) int {
+	for i, x := range ids {
+		if x == id {
+			return i
+		}
+	}
+	return -1
+}
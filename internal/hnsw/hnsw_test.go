@@ -0,0 +1,253 @@
+package hnsw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"testing"
+)
+
+func randomVectors(n, dim int, seed uint64) [][]float32 {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+// bruteForce returns the keys of the k vectors most similar to q
+func bruteForce(vectors map[string][]float32, q []float32, k int) []string {
+	type scored struct {
+		key  string
+		dist float32
+	}
+	var all []scored
+	nq := Normalize(q)
+	for key, v := range vectors {
+		all = append(all, scored{key, distance(nq, Normalize(v))})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].dist < all[j].dist })
+	keys := make([]string, 0, k)
+	for _, s := range all[:min(k, len(all))] {
+		keys = append(keys, s.key)
+	}
+	return keys
+}
+
+func recall(g *Graph, vectors map[string][]float32, queries [][]float32, k int) float64 {
+	hits := 0
+	for _, q := range queries {
+		want := make(map[string]bool)
+		for _, key := range bruteForce(vectors, q, k) {
+			want[key] = true
+		}
+		for _, r := range g.Search(q, k) {
+			if want[r.Key] {
+				hits++
+			}
+		}
+	}
+	return float64(hits) / float64(len(queries)*k)
+}
+
+func buildGraph(t *testing.T, n, dim int) (*Graph, map[string][]float32) {
+	t.Helper()
+	g, err := New(dim, DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := make(map[string][]float32)
+	for i, v := range randomVectors(n, dim, 1) {
+		key := fmt.Sprintf("v%d", i)
+		vectors[key] = v
+		if err := g.Insert(key, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g, vectors
+}
+
+func TestSearchRecall(t *testing.T) {
+	g, vectors := buildGraph(t, 2000, 32)
+	queries := randomVectors(50, 32, 2)
+
+	if r := recall(g, vectors, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 = %.2f, want at least 0.9", r)
+	}
+
+	// A stored vector finds itself first
+	results := g.Search(vectors["v42"], 1)
+	if len(results) != 1 || results[0].Key != "v42" || results[0].Score < 0.999 {
+		t.Errorf("self search = %+v", results)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	g, vectors := buildGraph(t, 1000, 16)
+	for i := 0; i < 1000; i += 2 {
+		key := fmt.Sprintf("v%d", i)
+		if !g.Delete(key) {
+			t.Fatalf("Delete(%s) = false", key)
+		}
+		delete(vectors, key)
+	}
+	if g.Delete("v0") {
+		t.Error("deleting a missing key reported success")
+	}
+	if g.Len() != 500 {
+		t.Fatalf("Len = %d, want 500", g.Len())
+	}
+
+	queries := randomVectors(30, 16, 3)
+	for _, q := range queries {
+		for _, r := range g.Search(q, 10) {
+			if _, ok := vectors[r.Key]; !ok {
+				t.Fatalf("search returned deleted key %s", r.Key)
+			}
+		}
+	}
+	if r := recall(g, vectors, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 after deletes = %.2f, want at least 0.9", r)
+	}
+
+	// Purges leave no links to freed slots, and the deletes since the last
+	// purge stay under a fifth of the graph
+	for _, n := range g.nodes {
+		if n == nil {
+			continue
+		}
+		for _, links := range n.links {
+			for _, nb := range links {
+				if g.nodes[nb] == nil {
+					t.Fatalf("node %s links to freed slot %d", n.key, nb)
+				}
+			}
+		}
+	}
+	if g.deleted*4 > g.Len() {
+		t.Errorf("%d deletes pending for %d vectors", g.deleted, g.Len())
+	}
+
+	// Deleted slots are reused
+	if err := g.Insert("again", vectors["v1"]); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.nodes) != 1000 {
+		t.Errorf("insert after delete grew the graph to %d slots", len(g.nodes))
+	}
+}
+
+func TestInsertReplacesKey(t *testing.T) {
+	g, _ := New(2, DefaultConfig)
+	g.Insert("a", []float32{1, 0})
+	g.Insert("b", []float32{0, 1})
+	g.Insert("a", []float32{0, 1})
+
+	if g.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", g.Len())
+	}
+	if results := g.Search([]float32{1, 0}, 2); results[0].Score > 0.01 {
+		t.Errorf("old vector for a is still searchable: %+v", results)
+	}
+	if err := g.Insert("c", []float32{1, 2, 3}); err == nil {
+		t.Error("vector with the wrong dimension was accepted")
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	g, _ := buildGraph(t, 300, 8)
+	g.Delete("v7")
+
+	var buf bytes.Buffer
+	if _, err := g.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	loaded, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != g.Len() {
+		t.Fatalf("loaded %d vectors, want %d", loaded.Len(), g.Len())
+	}
+	for _, q := range randomVectors(10, 8, 4) {
+		want, got := g.Search(q, 5), loaded.Search(q, 5)
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			t.Fatalf("loaded graph returned %v, want %v", got, want)
+		}
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)/2] ^= 1
+	if _, err := Read(bytes.NewReader(corrupt)); err == nil {
+		t.Error("corrupted index was accepted")
+	}
+
+	// A well-formed file can still link upper layers to nodes not on them
+	top, bottom := g.nodes[g.entry], -1
+	for id, n := range g.nodes {
+		if n != nil && len(n.links) == 1 {
+			bottom = id
+			break
+		}
+	}
+	top.links[g.top] = append(top.links[g.top], uint32(bottom))
+	buf.Reset()
+	if _, err := g.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("index linking to a node above its level was accepted")
+	}
+}
+
+func TestReadRejectsLargeHeader(t *testing.T) {
+	g, _ := buildGraph(t, 10, 8)
+	var buf bytes.Buffer
+	if _, err := g.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dim follows the magic and flags, and Slots the parameters and seed
+	for _, offset := range []int{12, 36} {
+		data := append([]byte{}, buf.Bytes()...)
+		binary.LittleEndian.PutUint32(data[offset:], math.MaxUint32)
+		if _, err := Read(bytes.NewReader(data)); err == nil {
+			t.Errorf("header with field at %d set to %d was accepted", offset, uint32(math.MaxUint32))
+		}
+	}
+}
+
+func TestWriteReadLinks(t *testing.T) {
+	g, vectors := buildGraph(t, 300, 8)
+
+	var buf bytes.Buffer
+	if _, err := g.WriteLinksTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("Read accepted an index without vectors")
+	}
+
+	loaded, err := ReadLinks(bytes.NewReader(buf.Bytes()), func(key string) ([]float32, bool) {
+		v, ok := vectors[key]
+		return Normalize(v), ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range randomVectors(10, 8, 4) {
+		want, got := g.Search(q, 5), loaded.Search(q, 5)
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			t.Fatalf("loaded graph returned %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package hnsw
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand/v2"
+)
+
+// magic identifies the serialized graph format and its version
+const magic = "PXHNSW02"
+
+// flagVectors marks files that include the node vectors
+const flagVectors = 1
+
+// WriteTo serializes the graph: a header with the parameters, then every
+// node slot with its key, vector and links, then a CRC-32 of everything
+// before it. Deletes are purged first, and the freed slots are kept so node
+// IDs stay valid.
+func (g *Graph) WriteTo(w io.Writer) (int64, error) {
+	return g.write(w, true)
+}
+
+// WriteLinksTo serializes the graph without its vectors, for callers that
+// store them elsewhere and pass them back to ReadLinks
+func (g *Graph) WriteLinksTo(w io.Writer) (int64, error) {
+	return g.write(w, false)
+}
+
+func (g *Graph) write(w io.Writer, vectors bool) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.deleted > 0 {
+		g.purge()
+	}
+
+	counter := &countingWriter{w: w}
+	buf := bufio.NewWriter(counter)
+	sum := crc32.NewIEEE()
+	out := io.MultiWriter(buf, sum)
+	le := binary.LittleEndian
+
+	var flags uint32
+	if vectors {
+		flags |= flagVectors
+	}
+	header := []any{
+		[]byte(magic), flags,
+		uint32(g.dim), uint32(g.cfg.M), uint32(g.cfg.EfConstruction), uint32(g.cfg.EfSearch), g.cfg.Seed,
+		uint32(len(g.nodes)), int32(g.entry), uint32(g.top),
+	}
+	for _, field := range header {
+		if err := binary.Write(out, le, field); err != nil {
+			return counter.n, fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+
+	for _, n := range g.nodes {
+		if err := writeNode(out, n, vectors); err != nil {
+			return counter.n, fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+
+	if err := binary.Write(buf, le, sum.Sum32()); err != nil {
+		return counter.n, fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return counter.n, fmt.Errorf("failed to write index: %w", err)
+	}
+	return counter.n, nil
+}
+
+func writeNode(w io.Writer, n *node, vectors bool) error {
+	le := binary.LittleEndian
+	if n == nil {
+		return binary.Write(w, le, uint8(0))
+	}
+	fields := []any{uint8(1), uint32(len(n.key)), []byte(n.key), uint8(len(n.links) - 1)}
+	if vectors {
+		fields = append(fields, n.vector)
+	}
+	for _, field := range fields {
+		if err := binary.Write(w, le, field); err != nil {
+			return err
+		}
+	}
+	for _, links := range n.links {
+		if err := binary.Write(w, le, uint32(len(links))); err != nil {
+			return err
+		}
+		if err := binary.Write(w, le, links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read loads a graph written by WriteTo
+func Read(r io.Reader) (*Graph, error) {
+	return read(r, nil)
+}
+
+// ReadLinks loads a graph written by WriteLinksTo, taking each node's vector
+// from vector. The vectors are used as they are, without copying, and must
+// be unit length as returned by Normalize.
+func ReadLinks(r io.Reader, vector func(key string) ([]float32, bool)) (*Graph, error) {
+	return read(r, vector)
+}
+
+func read(r io.Reader, vector func(key string) ([]float32, bool)) (*Graph, error) {
+	sum := crc32.NewIEEE()
+	in := io.TeeReader(bufio.NewReader(r), sum)
+	le := binary.LittleEndian
+
+	var head struct {
+		Magic                            [8]byte
+		Flags                            uint32
+		Dim, M, EfConstruction, EfSearch uint32
+		Seed                             uint64
+		Slots                            uint32
+		Entry                            int32
+		Top                              uint32
+	}
+	if err := binary.Read(in, le, &head); err != nil {
+		return nil, fmt.Errorf("failed to read index header: %w", err)
+	}
+	if string(head.Magic[:]) != magic {
+		return nil, fmt.Errorf("not an HNSW index or unsupported version")
+	}
+	if head.Slots > math.MaxInt32 {
+		return nil, fmt.Errorf("index has too many nodes: %d", head.Slots)
+	}
+	hasVectors := head.Flags&flagVectors != 0
+	if !hasVectors && vector == nil {
+		return nil, fmt.Errorf("index was saved without vectors, use ReadLinks")
+	}
+
+	// New bounds Dim and M, and so what each node can allocate before the
+	// checksum is reached
+	g, err := New(int(head.Dim), Config{
+		M:              int(head.M),
+		EfConstruction: int(head.EfConstruction),
+		EfSearch:       int(head.EfSearch),
+		Seed:           head.Seed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Continue level assignment from a different point than a fresh graph
+	g.rng = rand.New(rand.NewPCG(head.Seed, uint64(head.Slots)))
+
+	g.nodes = make([]*node, 0, min(head.Slots, 1<<20))
+	for id := uint32(0); id < head.Slots; id++ {
+		n, err := readNode(in, g, head.Slots, hasVectors)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index node %d: %w", id, err)
+		}
+		if n != nil && !hasVectors {
+			v, ok := vector(n.key)
+			if !ok || len(v) != g.dim {
+				return nil, fmt.Errorf("no %d-dimensional vector for index node %q", g.dim, n.key)
+			}
+			n.vector = v
+		}
+		g.nodes = append(g.nodes, n)
+		if n == nil {
+			g.free = append(g.free, id)
+		} else {
+			g.keys[n.key] = id
+		}
+	}
+
+	expected := sum.Sum32()
+	var stored uint32
+	if err := binary.Read(in, le, &stored); err != nil {
+		return nil, fmt.Errorf("failed to read index checksum: %w", err)
+	}
+	if stored != expected {
+		return nil, fmt.Errorf("index checksum mismatch, file is corrupted")
+	}
+
+	if head.Entry >= int32(len(g.nodes)) || (head.Entry >= 0 && g.nodes[head.Entry] == nil) {
+		return nil, fmt.Errorf("index entry point %d is invalid", head.Entry)
+	}
+	if head.Entry >= 0 && len(g.nodes[head.Entry].links)-1 != int(head.Top) {
+		return nil, fmt.Errorf("index entry point level does not match header")
+	}
+	g.entry, g.top = int(head.Entry), int(head.Top)
+	for _, n := range g.nodes {
+		if n == nil {
+			continue
+		}
+		for layer, links := range n.links {
+			for _, nb := range links {
+				if g.nodes[nb] == nil {
+					return nil, fmt.Errorf("index links to missing node %d", nb)
+				}
+				// Searches follow links on the same layer of the neighbour
+				if len(g.nodes[nb].links) <= layer {
+					return nil, fmt.Errorf("index links to node %d on layer %d, which it is not on", nb, layer)
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+func readNode(r io.Reader, g *Graph, slots uint32, vectors bool) (*node, error) {
+	le := binary.LittleEndian
+	var present uint8
+	if err := binary.Read(r, le, &present); err != nil {
+		return nil, err
+	}
+	if present == 0 {
+		return nil, nil
+	}
+
+	var keyLen uint32
+	if err := binary.Read(r, le, &keyLen); err != nil {
+		return nil, err
+	}
+	if keyLen > 1<<16 {
+		return nil, fmt.Errorf("key length %d too large", keyLen)
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, err
+	}
+
+	var level uint8
+	if err := binary.Read(r, le, &level); err != nil {
+		return nil, err
+	}
+	if level > maxLevel {
+		return nil, fmt.Errorf("level %d too large", level)
+	}
+
+	n := &node{key: string(key), links: make([][]uint32, int(level)+1)}
+	if vectors {
+		n.vector = make([]float32, g.dim)
+		if err := binary.Read(r, le, n.vector); err != nil {
+			return nil, err
+		}
+	}
+	for layer := range n.links {
+		var count uint32
+		if err := binary.Read(r, le, &count); err != nil {
+			return nil, err
+		}
+		if count > uint32(g.maxLinks(layer)) {
+			return nil, fmt.Errorf("link count %d too large", count)
+		}
+		n.links[layer] = make([]uint32, count)
+		if err := binary.Read(r, le, n.links[layer]); err != nil {
+			return nil, err
+		}
+		for _, nb := range n.links[layer] {
+			if nb >= slots {
+				return nil, fmt.Errorf("link to node %d out of range", nb)
+			}
+		}
+	}
+	return n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,646 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+// An index file is a fixed header, a vector block in frame order, and the
+// metadata. All integers are little-endian. The vector block holds
+// Count*Dim unit-length float32 or float16 values, or for quantized formats
+// the PQ codebook followed by the codes described in quantize.go. It starts
+// at a 64-byte boundary, so when the file is memory-mapped on a
+// little-endian machine float32 embeddings and codes are used in place
+// without being read. The metadata is a table of Count fixed-width frame
+// records, the text fields of each frame, and the JSON of the index without
+// its frames. Frames are decoded one at a time when they are asked for, so
+// loading an index does not depend on how many it has. Version 1 files
+// hold the JSON of the index with its frames instead, and are read whole.
+const (
+	indexMagic   = "PXINDEX\x00"
+	indexVersion = 2
+	headerSize   = 64
+)
+
+// frameRecordSize is the size of a frame record: the frame number, chunk
+// index, offset and content length of the frame, and the offset and length
+// of its text fields after the table, as uint64s
+const frameRecordSize = 48
+
+// frameText holds the fields of a frame that vary in length, stored as JSON
+type frameText struct {
+	Hash        string `json:"hash"`
+	SourceFile  string `json:"source_file"`
+	ContentHash string `json:"content_hash"`
+	Preview     string `json:"preview"`
+}
+
+type fileHeader struct {
+	Magic        [8]byte
+	Version      uint16
+	Format       uint8
+	_            uint8
+	Dim          uint32
+	Count        uint64
+	VectorOffset uint64
+	MetaOffset   uint64
+	MetaLen      uint64
+	MetaCRC      uint32
+	Subspaces    uint32  // PQ only
+	Tag          [8]byte // Identifies the contents, for the .hnsw and .vectors files to match
+}
+
+// The .vectors file of a quantized index is this header followed by the
+// exact float32 vectors, used to re-rank search candidates
+const exactMagic = "PXVECS\x00\x00"
+
+type exactHeader struct {
+	Magic [8]byte
+	Tag   [8]byte // Tag of the index file the vectors belong to
+	Count uint64
+	Dim   uint32
+	_     [36]byte
+}
+
+// errJSONIndex is returned for indexes saved as JSON by earlier versions
+var errJSONIndex = errors.New("index is in the JSON format")
+
+var nativeLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// exactPath returns where the exact vectors of a quantized index are stored
+func exactPath(indexPath string) string {
+	return strings.TrimSuffix(indexPath, ".index") + ".vectors"
+}
+
+// writeIndexFile writes index to path, replacing any existing file
+// atomically, and returns the tag of the new contents. Quantized indexes
+// get their codes in index.quant and, if ExactVectors is set, a .vectors
+// file.
+func writeIndexFile(path string, index *MemoryIndex) ([8]byte, error) {
+	var tag [8]byte
+	format := index.VectorFormat
+	if format > VectorPQ {
+		return tag, fmt.Errorf("unknown vector format %d", format)
+	}
+	vectors, exact, err := indexVectors(index)
+	if err != nil {
+		return tag, err
+	}
+	var quant *quantizer
+	if format.quantized() && len(vectors) > 0 {
+		quant = newQuantizer(format, index.VectorDim, index.PQSubspaces, vectors)
+	}
+
+	// Metadata is the frame records, their text and the index without frames
+	count := index.Len()
+	table := make([]byte, count*frameRecordSize)
+	var text []byte
+	for i := 0; i < count; i++ {
+		frame := index.Frame(i)
+		fields, err := json.Marshal(frameText{Hash: frame.Hash, SourceFile: frame.SourceFile, ContentHash: frame.ContentHash, Preview: frame.Preview})
+		if err != nil {
+			return tag, fmt.Errorf("failed to marshal frame %d: %w", frame.FrameNumber, err)
+		}
+		record := table[i*frameRecordSize:]
+		for j, v := range []int{frame.FrameNumber, frame.ChunkIndex, frame.Offset, frame.ContentLen, len(text), len(fields)} {
+			binary.LittleEndian.PutUint64(record[j*8:], uint64(v))
+		}
+		text = append(text, fields...)
+	}
+	meta := *index
+	meta.Frames = nil
+	metaJSON, err := json.Marshal(&meta)
+	if err != nil {
+		return tag, fmt.Errorf("failed to marshal index: %w", err)
+	}
+	metaData := append(append(table, text...), metaJSON...)
+
+	var blockSize uint64
+	switch {
+	case quant != nil:
+		blockSize = uint64(len(quant.codebook)*4 + len(quant.codes))
+	case format == VectorFloat16:
+		blockSize = uint64(len(vectors)) * uint64(index.VectorDim) * 2
+	default:
+		blockSize = uint64(len(vectors)) * uint64(index.VectorDim) * 4
+	}
+	header := fileHeader{
+		Version:      indexVersion,
+		Format:       uint8(format),
+		Dim:          uint32(index.VectorDim),
+		Count:        uint64(count),
+		VectorOffset: headerSize,
+		MetaOffset:   headerSize + blockSize,
+		MetaLen:      uint64(len(metaData)),
+		MetaCRC:      crc32.ChecksumIEEE(metaData),
+	}
+	copy(header.Magic[:], indexMagic)
+	if quant != nil {
+		header.Subspaces = uint32(quant.subspaces)
+	}
+
+	header.Tag, err = writeAtomic(path, func(w io.Writer) error {
+		if quant != nil {
+			if err := binary.Write(w, binary.LittleEndian, quant.codebook); err != nil {
+				return err
+			}
+			_, err := w.Write(quant.codes)
+			return err
+		}
+		return writeVectors(w, vectors, format)
+	}, metaData, func(tag [8]byte) any {
+		header.Tag = tag
+		return &header
+	})
+	if err != nil {
+		return tag, fmt.Errorf("failed to write index: %w", err)
+	}
+	index.quant = quant
+
+	// Exact vectors are only useful next to codes, and only if they are exact
+	if quant != nil && index.ExactVectors && exact {
+		exactHead := exactHeader{Tag: header.Tag, Count: header.Count, Dim: header.Dim}
+		copy(exactHead.Magic[:], exactMagic)
+		_, err := writeAtomic(exactPath(path), func(w io.Writer) error {
+			return writeVectors(w, vectors, VectorFloat32)
+		}, nil, func([8]byte) any { return &exactHead })
+		if err != nil {
+			return tag, fmt.Errorf("failed to write exact vectors: %w", err)
+		}
+	} else {
+		os.Remove(exactPath(path))
+	}
+	return header.Tag, nil
+}
+
+// indexVectors returns the unit-length embedding of every frame. Frames of
+// a quantized index loaded without exact vectors are decoded from their
+// codes, in which case exact is false.
+func indexVectors(index *MemoryIndex) (vectors [][]float32, exact bool, err error) {
+	vectors = make([][]float32, index.Len())
+	exact = true
+	for i := range vectors {
+		embedding := index.exact(i)
+		if embedding == nil && index.quant != nil && i < index.quant.count() {
+			vectors[i] = normalized(index.quant.decode(i))
+			exact = false
+			continue
+		}
+		if len(embedding) != index.VectorDim {
+			return nil, false, fmt.Errorf("frame %d has a %d-dimensional embedding, index has %d", index.Frame(i).FrameNumber, len(embedding), index.VectorDim)
+		}
+		vectors[i] = normalized(embedding)
+	}
+	return vectors, exact, nil
+}
+
+// writeAtomic writes a file of a 64-byte header, the block written by body
+// and trailer, replacing path atomically. The header is written last, from
+// the tag of everything after it, which is returned.
+func writeAtomic(path string, body func(io.Writer) error, trailer []byte, header func(tag [8]byte) any) ([8]byte, error) {
+	var tag [8]byte
+	temp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return tag, err
+	}
+	defer os.Remove(temp.Name())
+
+	buf := bufio.NewWriter(temp)
+	sum := sha256.New()
+	buf.Write(make([]byte, headerSize))
+	if err := body(io.MultiWriter(buf, sum)); err != nil {
+		temp.Close()
+		return tag, err
+	}
+	buf.Write(trailer)
+	sum.Write(trailer)
+	if err := buf.Flush(); err != nil {
+		temp.Close()
+		return tag, err
+	}
+
+	copy(tag[:], sum.Sum(nil))
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		temp.Close()
+		return tag, err
+	}
+	if err := binary.Write(temp, binary.LittleEndian, header(tag)); err != nil {
+		temp.Close()
+		return tag, err
+	}
+	if err := temp.Close(); err != nil {
+		return tag, err
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return tag, err
+	}
+	return tag, os.Rename(temp.Name(), path)
+}
+
+// writeVectors writes vectors as float32 or float16 rows
+func writeVectors(w io.Writer, vectors [][]float32, format VectorFormat) error {
+	var row []byte
+	for _, v := range vectors {
+		row = row[:0]
+		for _, x := range v {
+			if format == VectorFloat16 {
+				row = binary.LittleEndian.AppendUint16(row, toFloat16(x))
+			} else {
+				row = binary.LittleEndian.AppendUint32(row, math.Float32bits(x))
+			}
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIndexFile memory-maps an index file written by writeIndexFile. The
+// embeddings or codes of the returned index point into the mapping when the
+// format allows it; MemoryIndex.Close releases it.
+func readIndexFile(path string) (*MemoryIndex, [8]byte, error) {
+	var tag [8]byte
+	data, err := openMapped(path)
+	if err != nil {
+		return nil, tag, err
+	}
+
+	index, err := parseIndex(data)
+	if err != nil {
+		unmapFile(data)
+		return nil, tag, fmt.Errorf("failed to parse index: %w", err)
+	}
+	copy(tag[:], data[headerSize-len(tag):headerSize])
+	if index.mapped == nil {
+		unmapFile(data) // The embeddings were copied out
+	}
+
+	// Without its exact vectors a quantized index is ranked by its codes alone
+	if index.quant != nil && index.ExactVectors {
+		if exact, err := openMapped(exactPath(path)); err == nil {
+			if vectors, ok := parseExact(exact, tag, index.Len(), index.VectorDim); ok {
+				index.vectors = vectors
+				index.mappedExact = exact
+				if !aliases(exact, vectors) {
+					index.mappedExact = nil
+					unmapFile(exact)
+				}
+			} else {
+				unmapFile(exact)
+			}
+		}
+	}
+	return index, tag, nil
+}
+
+// openMapped maps a whole file written by writeAtomic
+func openMapped(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("index not found: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	first := make([]byte, 1)
+	if _, err := file.ReadAt(first, 0); err == nil && first[0] == '{' {
+		return nil, errJSONIndex
+	}
+	if info.Size() < headerSize || info.Size() > math.MaxInt {
+		return nil, fmt.Errorf("invalid index file size %d", info.Size())
+	}
+	data, err := mapFile(file, int(info.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to map index: %w", err)
+	}
+	return data, nil
+}
+
+func parseIndex(data []byte) (*MemoryIndex, error) {
+	var header fileHeader
+	if err := binary.Read(bytes.NewReader(data[:headerSize]), binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Magic[:]) != indexMagic {
+		return nil, fmt.Errorf("not a Pixelog index")
+	}
+	if header.Version != 1 && header.Version != indexVersion {
+		return nil, fmt.Errorf("unsupported index version %d", header.Version)
+	}
+	format := VectorFormat(header.Format)
+	if format > VectorPQ {
+		return nil, fmt.Errorf("unknown vector format %d", header.Format)
+	}
+
+	size := uint64(len(data))
+	dim, count, subspaces := uint64(header.Dim), header.Count, uint64(header.Subspaces)
+	if dim > size || count > size || (dim != 0 && count > size/dim) ||
+		header.VectorOffset < headerSize || header.VectorOffset%headerSize != 0 || header.VectorOffset > size {
+		return nil, fmt.Errorf("invalid vector block")
+	}
+	if format == VectorPQ && count > 0 && (subspaces == 0 || subspaces > dim || dim%subspaces != 0) {
+		return nil, fmt.Errorf("invalid PQ subspaces %d for %d dimensions", subspaces, dim)
+	}
+	var blockSize, codebookSize uint64
+	switch format {
+	case VectorFloat32:
+		blockSize = count * dim * 4
+	case VectorFloat16:
+		blockSize = count * dim * 2
+	case VectorInt8:
+		blockSize = count * (dim + 4)
+	case VectorPQ:
+		if count > 0 {
+			codebookSize = pqCentroids * dim * 4
+		}
+		blockSize = codebookSize + count*subspaces
+	}
+	if blockSize > size-header.VectorOffset || header.VectorOffset+blockSize > header.MetaOffset ||
+		header.MetaOffset > size || header.MetaLen > size-header.MetaOffset {
+		return nil, fmt.Errorf("invalid section offsets")
+	}
+
+	metaData := data[header.MetaOffset : header.MetaOffset+header.MetaLen]
+	if crc32.ChecksumIEEE(metaData) != header.MetaCRC {
+		return nil, fmt.Errorf("metadata checksum mismatch, file is corrupted")
+	}
+	var index MemoryIndex
+	if header.Version == 1 {
+		if err := json.Unmarshal(metaData, &index); err != nil {
+			return nil, err
+		}
+	} else {
+		if count > uint64(len(metaData))/frameRecordSize {
+			return nil, fmt.Errorf("invalid frame table")
+		}
+		table := metaData[:count*frameRecordSize]
+		textLen, err := checkFrameRecords(table, uint64(len(metaData))-uint64(len(table)))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(metaData[uint64(len(table))+textLen:], &index); err != nil {
+			return nil, err
+		}
+		index.Frames = nil
+		index.frameTable = table
+		index.frameText = metaData[len(table) : uint64(len(table))+textLen]
+		index.mapped = data // The frames are read from the mapping
+	}
+	if uint64(index.Len()) != count || uint64(index.VectorDim) != dim {
+		return nil, fmt.Errorf("metadata does not match vector block")
+	}
+	index.VectorFormat = format
+	if count == 0 || dim == 0 {
+		return &index, nil
+	}
+
+	block := data[header.VectorOffset : header.VectorOffset+blockSize]
+	if format.quantized() {
+		// Codes stay in the mapping; the codebook is small enough to copy
+		index.quant = &quantizer{format: format, dim: int(dim), subspaces: int(subspaces), codes: block[codebookSize:]}
+		if format == VectorPQ {
+			index.quant.codebook = make([]float32, codebookSize/4)
+			binary.Read(bytes.NewReader(block[:codebookSize]), binary.LittleEndian, index.quant.codebook)
+		}
+		index.mapped = data
+		return &index, nil
+	}
+
+	// float16 vectors are copied out as float32, so they save disk space
+	// but not memory
+	if format == VectorFloat32 {
+		index.vectors = float32s(block)
+	} else {
+		index.vectors = make([]float32, count*dim)
+		for i := range index.vectors {
+			index.vectors[i] = fromFloat16(binary.LittleEndian.Uint16(block[i*2:]))
+		}
+	}
+	if aliases(data, index.vectors) {
+		index.mapped = data
+	}
+	return &index, nil
+}
+
+// checkFrameRecords checks that the text of each frame record follows the
+// previous one within textMax bytes, and that its numbers fit in an int,
+// and returns the length of the text
+func checkFrameRecords(table []byte, textMax uint64) (uint64, error) {
+	var next uint64
+	for i := 0; i < len(table); i += frameRecordSize {
+		for j := 0; j < frameRecordSize; j += 8 {
+			if binary.LittleEndian.Uint64(table[i+j:]) > math.MaxInt {
+				return 0, fmt.Errorf("invalid frame record %d", i/frameRecordSize)
+			}
+		}
+		textOffset, textLen := binary.LittleEndian.Uint64(table[i+32:]), binary.LittleEndian.Uint64(table[i+40:])
+		if textOffset != next || textLen > textMax-next {
+			return 0, fmt.Errorf("invalid frame record %d", i/frameRecordSize)
+		}
+		next += textLen
+	}
+	return next, nil
+}
+
+// Len returns the number of indexed passages
+func (index *MemoryIndex) Len() int {
+	if index.frameTable != nil {
+		return len(index.frameTable) / frameRecordSize
+	}
+	return len(index.Frames)
+}
+
+// Frame returns the passage at position pos. Those of a loaded index are
+// decoded from the index file each time.
+func (index *MemoryIndex) Frame(pos int) FrameIndex {
+	if index.frameTable == nil {
+		return index.Frames[pos]
+	}
+	record := index.frameTable[pos*frameRecordSize : (pos+1)*frameRecordSize]
+	field := func(i int) int {
+		return int(binary.LittleEndian.Uint64(record[i*8:]))
+	}
+	// The records and the checksum of the text were checked on load, so
+	// only a bug in writeIndexFile could leave the text undecodable
+	var text frameText
+	json.Unmarshal(index.frameText[field(4):field(4)+field(5)], &text)
+	return FrameIndex{
+		FrameNumber: field(0),
+		ChunkIndex:  field(1),
+		Hash:        text.Hash,
+		SourceFile:  text.SourceFile,
+		Offset:      field(2),
+		ContentHash: text.ContentHash,
+		ContentLen:  field(3),
+		Embedding:   index.exact(pos),
+		Preview:     text.Preview,
+	}
+}
+
+// exact returns the exact embedding of the frame at position pos, or nil
+// for a quantized index loaded without its exact vectors
+func (index *MemoryIndex) exact(pos int) []float32 {
+	if pos < len(index.Frames) && index.Frames[pos].Embedding != nil {
+		return index.Frames[pos].Embedding
+	}
+	if index.vectors != nil {
+		dim := index.VectorDim
+		return index.vectors[pos*dim : (pos+1)*dim : (pos+1)*dim]
+	}
+	return nil
+}
+
+// parseExact returns the vectors of a .vectors file if it belongs to the
+// index with the given tag
+func parseExact(data []byte, tag [8]byte, count, dim int) ([]float32, bool) {
+	var header exactHeader
+	if err := binary.Read(bytes.NewReader(data[:headerSize]), binary.LittleEndian, &header); err != nil {
+		return nil, false
+	}
+	if string(header.Magic[:]) != exactMagic || header.Tag != tag ||
+		header.Count != uint64(count) || header.Dim != uint32(dim) ||
+		uint64(len(data)-headerSize) != uint64(count)*uint64(dim)*4 {
+		return nil, false
+	}
+	return float32s(data[headerSize:]), true
+}
+
+// float32s returns little-endian float32 data as a slice, in place when the
+// machine allows it
+func float32s(block []byte) []float32 {
+	if nativeLittleEndian && uintptr(unsafe.Pointer(&block[0]))%4 == 0 {
+		// The file holds exactly the bytes of a []float32, use them in place
+		return unsafe.Slice((*float32)(unsafe.Pointer(&block[0])), len(block)/4)
+	}
+	vectors := make([]float32, len(block)/4)
+	for i := range vectors {
+		vectors[i] = math.Float32frombits(binary.LittleEndian.Uint32(block[i*4:]))
+	}
+	return vectors
+}
+
+// aliases reports whether vectors points into data
+func aliases(data []byte, vectors []float32) bool {
+	if len(data) == 0 || len(vectors) == 0 {
+		return false
+	}
+	start := uintptr(unsafe.Pointer(&data[0]))
+	p := uintptr(unsafe.Pointer(&vectors[0]))
+	return p >= start && p < start+uintptr(len(data))
+}
+
+// Close releases the memory-mapped index files. The embeddings must not be
+// used afterwards.
+func (m *MemoryIndex) Close() error {
+	if m.mapped == nil && m.mappedExact == nil {
+		return nil
+	}
+	m.frameTable, m.frameText, m.vectors = nil, nil, nil
+	m.graph = nil
+	m.quant = nil
+	var err error
+	for _, data := range [][]byte{m.mapped, m.mappedExact} {
+		if data != nil {
+			if unmapErr := unmapFile(data); unmapErr != nil {
+				err = unmapErr
+			}
+		}
+	}
+	m.mapped, m.mappedExact = nil, nil
+	return err
+}
+
+// normalized returns v scaled to unit length, or v itself if it already is
+func normalized(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 || math.Abs(norm-1) < 1e-6 {
+		return v
+	}
+	scale := 1 / math.Sqrt(norm)
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) * scale)
+	}
+	return out
+}
+
+// toFloat16 converts to IEEE 754 half precision, rounding to nearest even
+func toFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	biased := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case biased == 0xff: // Infinity and NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case biased == 0 && mant == 0:
+		return sign
+	}
+
+	exp := biased - 127 + 15
+	if exp >= 0x1f {
+		return sign | 0x7c00
+	}
+	if exp <= 0 {
+		// Subnormal in half precision
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h := mant >> shift
+		rem, half := mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > half || (rem == half && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+
+	h := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && h&1 == 1) {
+		h++ // May carry into the exponent, which is still correct
+	}
+	return sign | uint16(h)
+}
+
+// fromFloat16 converts from IEEE 754 half precision
+func fromFloat16(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | mant<<13)
+}
@@ -0,0 +1,331 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func testIndex(n, dim int, format VectorFormat) *MemoryIndex {
+	rng := rand.New(rand.NewPCG(1, 2))
+	index := &MemoryIndex{MemoryID: "notes", VectorDim: dim, VectorFormat: format, Version: 1}
+	for i := 0; i < n; i++ {
+		embedding := make([]float32, dim)
+		for j := range embedding {
+			embedding[j] = float32(rng.NormFloat64())
+		}
+		index.Frames = append(index.Frames, FrameIndex{
+			FrameNumber: i + 3,
+			ChunkIndex:  i,
+			SourceFile:  "notes.txt",
+			Embedding:   embedding,
+			Preview:     "passage",
+		})
+	}
+	index.TotalFrames = n
+	return index
+}
+
+func TestSaveLoadIndex(t *testing.T) {
+	for _, format := range []VectorFormat{VectorFloat32, VectorFloat16} {
+		t.Run(format.String(), func(t *testing.T) {
+			idx := &Indexer{indexDir: t.TempDir()}
+			saved := testIndex(200, 16, format)
+			if err := idx.SaveIndex(saved); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := idx.LoadIndex("notes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer loaded.Close()
+
+			if loaded.VectorFormat != format || loaded.Len() != 200 || loaded.Frame(5).FrameNumber != 8 || loaded.Frame(5).Preview != "passage" {
+				t.Fatalf("loaded %s index with %d frames", loaded.VectorFormat, loaded.Len())
+			}
+			tolerance := 1e-6
+			if format == VectorFloat16 {
+				tolerance = 1e-3
+			}
+			for i := 0; i < loaded.Len(); i++ {
+				want := normalized(saved.Frames[i].Embedding)
+				for j, x := range loaded.Vector(i) {
+					if math.Abs(float64(x-want[j])) > tolerance {
+						t.Fatalf("frame %d dimension %d = %v, want %v", i, j, x, want[j])
+					}
+				}
+			}
+
+			// The saved graph is reused, and finds a stored vector first
+			if loaded.graph == nil {
+				t.Fatal("graph was not loaded")
+			}
+			if got := loaded.graph.Search(saved.Frames[42].Embedding, 1); len(got) != 1 || got[0].Key != "42" {
+				t.Errorf("search for frame 42 returned %v", got)
+			}
+		})
+	}
+}
+
+func TestLoadIndexRejectsCorruption(t *testing.T) {
+	idx := &Indexer{indexDir: t.TempDir()}
+	if err := idx.SaveIndex(testIndex(10, 4, VectorFloat32)); err != nil {
+		t.Fatal(err)
+	}
+	path := idx.indexPath("notes")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-5] ^= 1 // Inside the metadata
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.LoadIndex("notes"); err == nil {
+		t.Error("corrupted index was loaded")
+	}
+}
+
+func TestSaveIndexConcurrently(t *testing.T) {
+	idx := &Indexer{indexDir: t.TempDir()}
+	if err := idx.SaveIndex(testIndex(20, 8, VectorFloat32)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed save leaves the previous index
+	if err := idx.SaveIndex(testIndex(30, 8, VectorFormat(99))); err == nil {
+		t.Fatal("index with an unknown vector format was saved")
+	}
+	loaded, err := idx.LoadIndex("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 20 {
+		t.Fatalf("loaded %d frames after a failed save", loaded.Len())
+	}
+	loaded.Close()
+
+	// Whichever save comes last, its graph goes with its index file
+	var wg sync.WaitGroup
+	for n := 21; n <= 28; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			if err := idx.SaveIndex(testIndex(n, 8, VectorFloat32)); err != nil {
+				t.Error(err)
+			}
+		}(n)
+	}
+	wg.Wait()
+	path := idx.indexPath("notes")
+	saved, tag, err := readIndexFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+	if _, err := loadGraph(graphPath(path), tag, saved); err != nil {
+		t.Errorf("graph of the %d frame index: %v", saved.Len(), err)
+	}
+}
+
+// encodeIndex lays out an index file by hand, with the metadata given as is
+func encodeIndex(t *testing.T, header fileHeader, block, meta []byte) []byte {
+	t.Helper()
+	copy(header.Magic[:], indexMagic)
+	header.MetaLen = uint64(len(meta))
+	header.MetaCRC = crc32.ChecksumIEEE(meta)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(block)
+	buf.Write(meta)
+	return buf.Bytes()
+}
+
+func TestParseVersion1Index(t *testing.T) {
+	// Version 1 files hold the frames in the JSON metadata
+	saved := testIndex(3, 4, VectorFloat32)
+	vectors, _, err := indexVectors(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block bytes.Buffer
+	if err := writeVectors(&block, vectors, VectorFloat32); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := fileHeader{Version: 1, Dim: 4, Count: 3, VectorOffset: headerSize, MetaOffset: headerSize + uint64(block.Len())}
+	index, err := parseIndex(encodeIndex(t, header, block.Bytes(), meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Len() != 3 || index.Frame(2).FrameNumber != 5 || len(index.Vector(2)) != 4 {
+		t.Errorf("parsed %d frames, last %+v", index.Len(), index.Frame(2))
+	}
+}
+
+func TestParseIndexRejectsBadOffsets(t *testing.T) {
+	cases := map[string]fileHeader{
+		"vector offset past the end": {Version: indexVersion, Dim: 4, Count: 1, VectorOffset: math.MaxUint64 - 63, MetaOffset: headerSize},
+		"vector block past the end":  {Version: indexVersion, Dim: 4, Count: 1, VectorOffset: headerSize * 2, MetaOffset: headerSize},
+		"frame table past the end":   {Version: indexVersion, Count: 1000, VectorOffset: headerSize, MetaOffset: headerSize},
+	}
+	for name, header := range cases {
+		if _, err := parseIndex(encodeIndex(t, header, nil, []byte("{}"))); err == nil {
+			t.Errorf("%s: index was parsed", name)
+		}
+	}
+}
+
+func TestLoadJSONIndex(t *testing.T) {
+	idx := &Indexer{indexDir: t.TempDir()}
+	data, err := json.Marshal(testIndex(10, 4, VectorFloat32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(idx.indexDir, "notes.index")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := idx.LoadIndex("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	if loaded.Len() != 10 {
+		t.Fatalf("loaded %d frames", loaded.Len())
+	}
+
+	// The index was converted on load
+	converted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(converted[:len(indexMagic)]) != indexMagic {
+		t.Error("JSON index was not converted to the binary format")
+	}
+}
+
+func TestFloat16(t *testing.T) {
+	cases := map[float32]uint16{
+		0:          0x0000,
+		1:          0x3c00,
+		-2:         0xc000,
+		0.5:        0x3800,
+		65504:      0x7bff,
+		1e6:        0x7c00, // Overflows to infinity
+		5.9605e-08: 0x0001, // Smallest subnormal
+		0.33333334: 0x3555,
+	}
+	for f, want := range cases {
+		if got := toFloat16(f); got != want {
+			t.Errorf("toFloat16(%v) = %#04x, want %#04x", f, got, want)
+		}
+	}
+	for h := 0; h < 0x7c00; h++ {
+		if got := toFloat16(fromFloat16(uint16(h))); got != uint16(h) {
+			t.Fatalf("round trip of %#04x gave %#04x", h, got)
+		}
+	}
+}
+
+func TestQuantizedIndex(t *testing.T) {
+	for _, format := range []VectorFormat{VectorInt8, VectorPQ} {
+		t.Run(format.String(), func(t *testing.T) {
+			idx := &Indexer{indexDir: t.TempDir()}
+			saved := testIndex(500, 32, format)
+			saved.ExactVectors = true
+			if err := idx.SaveIndex(saved); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := idx.LoadIndex("notes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer loaded.Close()
+			if loaded.quant == nil || loaded.exact(0) == nil {
+				t.Fatal("codes or exact vectors were not loaded")
+			}
+
+			// Re-ranking with the exact vectors finds a stored vector first
+			results := quantizedSearch(loaded, saved.Frames[42].Embedding, 3, 50)
+			if len(results) != 3 || results[0].FrameNumber != 45 || results[0].Score < 0.999 {
+				t.Fatalf("search for frame 42 returned %+v", results)
+			}
+
+			// Without them the codes alone still rank it near the top
+			if err := os.Remove(exactPath(idx.indexPath("notes"))); err != nil {
+				t.Fatal(err)
+			}
+			codesOnly, err := idx.LoadIndex("notes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer codesOnly.Close()
+			if codesOnly.exact(0) != nil {
+				t.Fatal("exact vectors loaded from a removed file")
+			}
+			if codesOnly.graph == nil {
+				t.Fatal("graph was not loaded over the decoded vectors")
+			}
+			found := false
+			for _, r := range quantizedSearch(codesOnly, saved.Frames[42].Embedding, 5, 5) {
+				found = found || r.FrameNumber == 45
+			}
+			if !found {
+				t.Error("codes alone did not rank frame 42 in the top 5")
+			}
+
+			// An index without exact vectors can still be saved again
+			if err := idx.SaveIndex(codesOnly); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// BenchmarkQuantizedSearch compares walking the graph of a quantized index
+// with scoring every code
+func BenchmarkQuantizedSearch(b *testing.B) {
+	for _, format := range []VectorFormat{VectorInt8, VectorPQ} {
+		idx := &Indexer{indexDir: b.TempDir()}
+		saved := testIndex(20000, 128, format)
+		if err := idx.SaveIndex(saved); err != nil {
+			b.Fatal(err)
+		}
+		loaded, err := idx.LoadIndex("notes")
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer loaded.Close()
+		query := saved.Frames[42].Embedding
+
+		graph := loaded.graph
+		b.Run(format.String()+"/graph", func(b *testing.B) {
+			loaded.graph = graph
+			for i := 0; i < b.N; i++ {
+				quantizedSearch(loaded, query, 10, defaultRerank)
+			}
+		})
+		b.Run(format.String()+"/scan", func(b *testing.B) {
+			loaded.graph = nil
+			for i := 0; i < b.N; i++ {
+				quantizedSearch(loaded, query, 10, defaultRerank)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters: bm25K1 limits how much repeating a term adds, bm25B how
+// much longer passages are penalised
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// lexicalIndex is a BM25 inverted index over the text of an index's frames,
+// stored in a .terms file next to the index
+type lexicalIndex struct {
+	Lengths  []int                `json:"lengths"`  // Tokens per frame, by position in MemoryIndex.Frames
+	Postings map[string][]posting `json:"postings"` // Frames containing each token, in frame order
+}
+
+// posting counts a token's occurrences in one frame
+type posting struct {
+	Frame int `json:"f"`
+	Count int `json:"n"`
+}
+
+// newLexicalIndex indexes one text per frame, in the order of Frames
+func newLexicalIndex(texts []string) *lexicalIndex {
+	lex := &lexicalIndex{
+		Lengths:  make([]int, len(texts)),
+		Postings: make(map[string][]posting),
+	}
+	for frame, text := range texts {
+		tokens := tokenize(text)
+		lex.Lengths[frame] = len(tokens)
+		counts := make(map[string]int)
+		for _, token := range tokens {
+			counts[token]++
+		}
+		for token, n := range counts {
+			lex.Postings[token] = append(lex.Postings[token], posting{frame, n})
+		}
+	}
+	return lex
+}
+
+// search returns up to topK frames scored by BM25, best first
+func (lex *lexicalIndex) search(query string, topK int) []hit {
+	if len(lex.Lengths) == 0 || topK <= 0 {
+		return nil
+	}
+	total := 0
+	for _, n := range lex.Lengths {
+		total += n
+	}
+	avgLen := math.Max(float64(total)/float64(len(lex.Lengths)), 1)
+	docs := float64(len(lex.Lengths))
+
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, token := range tokenize(query) {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		postings := lex.Postings[token]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (docs-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.Count)
+			norm := 1 - bm25B + bm25B*float64(lex.Lengths[p.Frame])/avgLen
+			scores[p.Frame] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	hits := make([]hit, 0, len(scores))
+	for frame, score := range scores {
+		hits = append(hits, hit{frame, float32(score)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].pos < hits[j].pos
+	})
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	return hits
+}
+
+// isConnector reports whether r joins words into one identifier, as in
+// PROJ-1234, snake_case, v1.2.3, path/to/file or issue#42
+func isConnector(r rune) bool {
+	return strings.ContainsRune("-_./:#", r)
+}
+
+// tokenize lowercases text and splits it into words of letters and digits.
+// Words joined by connectors are also kept whole, so an exact identifier
+// outscores passages that merely contain its parts.
+func tokenize(text string) []string {
+	var tokens []string
+	span := func(s string) {
+		s = strings.TrimFunc(s, isConnector)
+		parts := strings.FieldsFunc(s, isConnector)
+		tokens = append(tokens, parts...)
+		if len(parts) > 1 {
+			tokens = append(tokens, s)
+		}
+	}
+
+	text = strings.ToLower(text)
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || isConnector(r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			span(text[start:i])
+			start = -1
+		}
+	}
+	if start >= 0 {
+		span(text[start:])
+	}
+	return tokens
+}
+
+// termsPath returns where the lexical index of an index is stored
+func termsPath(indexPath string) string {
+	return strings.TrimSuffix(indexPath, ".index") + ".terms"
+}
+
+// saveTerms writes the lexical index after the tag of the index file whose
+// frames it covers
+func saveTerms(path string, tag [8]byte, lex *lexicalIndex) error {
+	data, err := json.Marshal(lex)
+	if err != nil {
+		return fmt.Errorf("failed to encode term index: %w", err)
+	}
+	if err := writeTagged(path, tag, data); err != nil {
+		return fmt.Errorf("failed to write term index: %w", err)
+	}
+	return nil
+}
+
+// loadTerms reads the lexical index saved with the given tag, failing if it
+// belongs to different contents
+func loadTerms(path string, tag [8]byte, frames int) (*lexicalIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var stored [8]byte
+	if _, err := io.ReadFull(file, stored[:]); err != nil {
+		return nil, err
+	}
+	if stored != tag {
+		return nil, fmt.Errorf("term index %s is out of date", path)
+	}
+	var lex lexicalIndex
+	if err := json.NewDecoder(file).Decode(&lex); err != nil {
+		return nil, fmt.Errorf("failed to parse term index: %w", err)
+	}
+	if len(lex.Lengths) != frames {
+		return nil, fmt.Errorf("term index %s covers %d frames, index has %d", path, len(lex.Lengths), frames)
+	}
+	for _, postings := range lex.Postings {
+		for _, p := range postings {
+			if p.Frame < 0 || p.Frame >= frames {
+				return nil, fmt.Errorf("term index %s is corrupt", path)
+			}
+		}
+	}
+	return &lex, nil
+}
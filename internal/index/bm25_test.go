@@ -0,0 +1,128 @@
+package index
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/embedding"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("See PROJ-1234, then v1.2 (done).")
+	want := []string{"see", "proj", "1234", "proj-1234", "then", "v1", "2", "v1.2", "done"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestLexicalSearch(t *testing.T) {
+	texts := []string{
+		"Project planning notes for the next release",
+		"Ticket PROJ-1234 tracks the login crash on release builds",
+		"The project has 1234 open tickets across teams",
+		"Release checklist and project milestones",
+	}
+	idx := &Indexer{indexDir: t.TempDir()}
+	saved := testIndex(len(texts), 8, VectorFloat32)
+	saved.lexical = newLexicalIndex(texts)
+	if err := idx.SaveIndex(saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := idx.LoadIndex("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	if loaded.lexical == nil {
+		t.Fatal("term index was not loaded")
+	}
+
+	// The exact identifier outranks a passage containing both of its parts
+	results, err := idx.SearchWith(context.Background(), loaded, "PROJ-1234", 2, SearchLexical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ChunkIndex != 1 || results[1].ChunkIndex != 2 {
+		t.Fatalf("lexical search returned %+v", results)
+	}
+
+	// Without an embedder hybrid search matches words only
+	hybrid, err := idx.SearchWith(context.Background(), loaded, "PROJ-1234", 2, SearchHybrid)
+	if err != nil || len(hybrid) == 0 || hybrid[0].ChunkIndex != 1 {
+		t.Fatalf("hybrid search returned %+v, %v", hybrid, err)
+	}
+
+	// A term index from other index contents is ignored
+	saved.Frames = saved.Frames[:3]
+	saved.lexical = nil
+	if err := idx.SaveIndex(saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(termsPath(idx.indexPath("notes"))); !os.IsNotExist(err) {
+		t.Errorf("stale term index was kept: %v", err)
+	}
+	if _, err := idx.SearchWith(context.Background(), loaded, "release", 2, SearchLexical); err != nil {
+		t.Errorf("already loaded index lost its term index: %v", err)
+	}
+}
+
+func TestFuseRankings(t *testing.T) {
+	ranking := func(positions ...int) []SearchResult {
+		var results []SearchResult
+		for _, pos := range positions {
+			results = append(results, SearchResult{FrameNumber: pos, Score: 1, pos: pos})
+		}
+		return results
+	}
+
+	// Frame 2 is second in both rankings, so it beats either winner alone
+	fused := fuseRankings(3, ranking(1, 2, 3), ranking(4, 2, 5))
+	var got []int
+	for _, r := range fused {
+		got = append(got, r.FrameNumber)
+	}
+	if want := []int{2, 1, 4}; !slices.Equal(got, want) {
+		t.Errorf("fused frames %v, want %v", got, want)
+	}
+}
+
+func TestSearchWithRecordedModel(t *testing.T) {
+	texts := []string{
+		"Rotate the encryption keys with pixe rekey",
+		"Meeting notes about the quarterly budget",
+		"Frames are decoded from QR codes in the video",
+	}
+	local := embedding.NewHashingEmbedder(64)
+	saved := &MemoryIndex{MemoryID: "notes", VectorDim: 64, EmbeddingModel: local.Model()}
+	for i, text := range texts {
+		vector, err := local.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved.Frames = append(saved.Frames, FrameIndex{FrameNumber: i, Embedding: vector, Preview: text})
+	}
+	saved.lexical = newLexicalIndex(texts)
+
+	// Built by one indexer, searched by another without an embedder of its
+	// own, as the CLI and the API server do
+	dir := t.TempDir()
+	if err := (&Indexer{indexDir: dir, embedder: local}).SaveIndex(saved); err != nil {
+		t.Fatal(err)
+	}
+	idx := &Indexer{indexDir: dir}
+	loaded, err := idx.LoadIndex("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+
+	results, err := idx.SearchWith(context.Background(), loaded, "how do I rotate encryption keys", 1, SearchSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].FrameNumber != 0 {
+		t.Errorf("semantic search returned %+v", results)
+	}
+}
@@ -0,0 +1,197 @@
+package index
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/video"
+)
+
+const (
+	// windowSize is how much text one index entry starts in, in bytes.
+	// Chunks longer than this get several entries for the same frame.
+	windowSize = 2000
+	// windowOverlap extends each window into the following text, so a
+	// sentence split across two frames is still embedded whole
+	windowOverlap = 200
+)
+
+// passage is a span of decoded text to embed, attributed to the frame that
+// holds its first byte
+type passage struct {
+	Frame      int
+	ChunkIndex int
+	SourceFile string
+	FileHash   string
+	Offset     int // Byte offset of Text in the decoded file
+	Text       string
+}
+
+// piece is the decoded text of one chunk
+type piece struct {
+	frame  int
+	index  int
+	offset int
+	text   string
+}
+
+// skippedFile reports a file whose chunks could not be indexed
+type skippedFile struct {
+	Name   string
+	Reason string
+}
+
+// chunkPassages splits the text files of a frame scan into overlapping
+// passages, each pointing at the video frame and chunk it starts in.
+// Encrypted and binary files, and base64 files with missing chunks, are
+// skipped.
+func chunkPassages(decoded []video.DecodedChunk) ([]passage, []skippedFile) {
+	type file struct {
+		chunks map[int]qr.Chunk
+		frames map[int]int
+	}
+	files := make(map[string]*file)
+	var order []string
+	for _, d := range decoded {
+		if d.Chunk.Kind != "" {
+			continue // Parity, manifest and other non-data frames
+		}
+		f, ok := files[d.Chunk.Hash]
+		if !ok {
+			f = &file{chunks: make(map[int]qr.Chunk), frames: make(map[int]int)}
+			files[d.Chunk.Hash] = f
+			order = append(order, d.Chunk.Hash)
+		}
+		// A chunk repeated in several frames is found at its first one
+		if _, seen := f.chunks[d.Chunk.Index]; !seen {
+			f.chunks[d.Chunk.Index] = d.Chunk
+			f.frames[d.Chunk.Index] = d.Frame
+		}
+	}
+
+	var passages []passage
+	var skipped []skippedFile
+	for _, hash := range order {
+		f := files[hash]
+		indices := make([]int, 0, len(f.chunks))
+		for i := range f.chunks {
+			indices = append(indices, i)
+		}
+		sort.Ints(indices)
+		first := f.chunks[indices[0]]
+
+		if first.Encrypted {
+			skipped = append(skipped, skippedFile{first.SourceFile, "encrypted"})
+			continue
+		}
+		pieces, reason := filePieces(f.chunks, f.frames, indices, first)
+		if reason != "" {
+			skipped = append(skipped, skippedFile{first.SourceFile, reason})
+			continue
+		}
+
+		for i, p := range pieces {
+			// Text the last window may run on into, if the next chunk follows directly
+			var next string
+			if i+1 < len(pieces) && pieces[i+1].index == p.index+1 {
+				next = pieces[i+1].text
+			}
+			for start := 0; start < len(p.text); {
+				end := runeBoundary(p.text, start+windowSize)
+				text := p.text[start:runeBoundary(p.text, end+windowOverlap)]
+				if end == len(p.text) {
+					text += next[:runeBoundary(next, windowOverlap)]
+				}
+				if strings.TrimSpace(text) != "" {
+					passages = append(passages, passage{
+						Frame:      p.frame,
+						ChunkIndex: p.index,
+						SourceFile: first.SourceFile,
+						FileHash:   hash,
+						Offset:     p.offset + start,
+						Text:       text,
+					})
+				}
+				start = end
+			}
+		}
+	}
+	return passages, skipped
+}
+
+// filePieces decodes a file's chunks into valid UTF-8 text per chunk. It
+// returns a reason instead when the file is not text or cannot be decoded.
+func filePieces(chunks map[int]qr.Chunk, frames map[int]int, indices []int, first qr.Chunk) ([]piece, string) {
+	complete := len(indices) == first.Total && indices[len(indices)-1] == first.Total-1
+
+	if !complete {
+		if !first.RawText() {
+			return nil, "missing chunks"
+		}
+		// Text chunks stand on their own; drop runes cut at the edges
+		stride := 0
+		for _, i := range indices {
+			if i < first.Total-1 {
+				stride = len(chunks[i].Data)
+				break
+			}
+		}
+		pieces := make([]piece, 0, len(indices))
+		for _, i := range indices {
+			pieces = append(pieces, piece{
+				frame:  frames[i],
+				index:  i,
+				offset: i * stride,
+				text:   strings.ToValidUTF8(chunks[i].Data, ""),
+			})
+		}
+		return pieces, ""
+	}
+
+	// Decode the whole file and cut it where each chunk's data starts
+	var encoded strings.Builder
+	starts := make([]int, len(indices))
+	for n, i := range indices {
+		starts[n] = encoded.Len()
+		encoded.WriteString(chunks[i].Data)
+	}
+	data := []byte(encoded.String())
+	if !first.RawText() {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(encoded.String()); err != nil {
+			return nil, "undecodable data"
+		}
+		for n := range starts {
+			starts[n] = starts[n] / 4 * 3
+		}
+	}
+	if !utf8.Valid(data) {
+		return nil, "not text"
+	}
+
+	text := string(data)
+	pieces := make([]piece, 0, len(indices))
+	for n, i := range indices {
+		start := runeBoundary(text, starts[n])
+		end := len(text)
+		if n+1 < len(starts) {
+			end = runeBoundary(text, starts[n+1])
+		}
+		pieces = append(pieces, piece{frame: frames[i], index: i, offset: start, text: text[start:end]})
+	}
+	return pieces, ""
+}
+
+// runeBoundary moves i forward to the start of a rune, capped at len(s)
+func runeBoundary(s string, i int) int {
+	if i >= len(s) {
+		return len(s)
+	}
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
+}
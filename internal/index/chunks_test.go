@@ -0,0 +1,83 @@
+package index
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/qr/qrtest"
+	"github.com/ArqonAi/Pixelog/internal/video"
+)
+
+// split chunks data the way the converter does, placing chunk i in frame
+// 10+i so frame and chunk numbers differ
+func split(name, mimeType, data string, size int) []video.DecodedChunk {
+	var decoded []video.DecodedChunk
+	for i, chunk := range qrtest.Split(data, size, qr.Chunk{SourceFile: name, MimeType: mimeType, Hash: name}) {
+		decoded = append(decoded, video.DecodedChunk{Frame: 10 + i, Chunk: chunk})
+	}
+	return decoded
+}
+
+func TestChunkPassages(t *testing.T) {
+	// Multi-byte runes straddle the chunk boundaries
+	text := strings.Repeat("héllo wörld ", 300)
+	decoded := split("notes.txt", "text/plain", text, 1000)
+	decoded = append(decoded, split("doc.md", "application/markdown", base64.StdEncoding.EncodeToString([]byte(text)), 1000)...)
+	decoded = append(decoded, split("image.png", "image/png", base64.StdEncoding.EncodeToString([]byte{0x89, 'P', 'N', 'G', 0xff, 0xfe}), 4)...)
+
+	passages, skipped := chunkPassages(decoded)
+	if len(skipped) != 1 || skipped[0].Name != "image.png" {
+		t.Errorf("skipped = %v, want only image.png", skipped)
+	}
+
+	byFile := make(map[string][]passage)
+	for _, p := range passages {
+		byFile[p.SourceFile] = append(byFile[p.SourceFile], p)
+	}
+	for _, name := range []string{"notes.txt", "doc.md"} {
+		got := byFile[name]
+		if len(got) == 0 {
+			t.Fatalf("no passages for %s", name)
+		}
+		for i, p := range got {
+			if p.Frame != 10+p.ChunkIndex {
+				t.Errorf("%s passage %d: frame %d for chunk %d", name, i, p.Frame, p.ChunkIndex)
+			}
+			if !strings.HasPrefix(text[p.Offset:], p.Text) {
+				t.Errorf("%s passage %d does not match the file at offset %d", name, i, p.Offset)
+			}
+			// Every passage but the last runs on into the next chunk
+			if i+1 < len(got) && len(p.Text) <= got[i+1].Offset-p.Offset {
+				t.Errorf("%s passage %d does not overlap the next", name, i)
+			}
+		}
+		if last := got[len(got)-1]; last.Offset+len(last.Text) != len(text) {
+			t.Errorf("%s passages end at %d, want %d", name, last.Offset+len(last.Text), len(text))
+		}
+	}
+}
+
+func TestChunkPassagesMissingChunk(t *testing.T) {
+	text := strings.Repeat("abcdefghij", 100)
+	decoded := split("notes.txt", "text/plain", text, 300)
+	decoded = append(decoded[:1], decoded[2:]...) // Lose chunk 1
+
+	passages, skipped := chunkPassages(decoded)
+	if len(skipped) != 0 {
+		t.Fatalf("skipped = %v", skipped)
+	}
+	for _, p := range passages {
+		if p.ChunkIndex == 1 {
+			t.Errorf("passage attributed to missing chunk")
+		}
+		if !strings.HasPrefix(text[p.Offset:], p.Text) {
+			t.Errorf("passage for chunk %d does not match the file at offset %d", p.ChunkIndex, p.Offset)
+		}
+	}
+	// The text before the gap must not run on across it
+	if len(passages[0].Text) != 300 {
+		t.Errorf("first passage is %d bytes, want 300", len(passages[0].Text))
+	}
+}
@@ -1,73 +1,161 @@
 package index
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	
+	"github.com/ArqonAi/Pixelog/internal/embedding"
+	"github.com/ArqonAi/Pixelog/internal/hnsw"
 	"github.com/ArqonAi/Pixelog/internal/video"
 )
 
 type Indexer struct {
 	indexDir     string
 	embedder     Embedder
-	videoMaker   *video.Maker
+	vectorFormat VectorFormat
+	pqSubspaces  int
+	dropExact    bool
+	rerank       int
+	batch        embedding.BatchOptions
+	allowPartial bool
+	progress     func(done, total int)
+	warn         func(warning string)
+
+	providers embedding.Options   // Credentials to embed queries for indexes built with another model
+	saving    sync.Mutex          // Held by SaveIndex, so an index file and its .terms and .hnsw files come from one save
+	mu        sync.Mutex
+	queryWith map[string]Embedder // Providers created from providers, by model
 }
 
-// Embedder interface for generating vector embeddings
-type Embedder interface {
-	Embed(text string) ([]float32, error)
-	Dim() int
+// DefaultDir is where the CLI and the API server keep indexes, so an
+// archive indexed by either can be searched by the other
+const DefaultDir = "./indexes"
+
+// MemoryID names the index of a .pixe file: its file name without the
+// extension, wherever the file is
+func MemoryID(pixeFile string) string {
+	return strings.TrimSuffix(filepath.Base(pixeFile), ".pixe")
 }
 
+// defaultRerank is how many candidates of a quantized index are re-ranked
+// with exact vectors when SetRerank was not called
+const defaultRerank = 100
+
+// Embedder generates vector embeddings, see embedding.New
+type Embedder = embedding.Provider
+
 // NewIndexer creates an indexer
-// embedder can be nil for loading/searching existing indexes
+// embedder can be nil for loading/searching existing indexes, which unlike
+// building them does not need ffmpeg either
 func NewIndexer(indexDir string, embedder Embedder) (*Indexer, error) {
 	if err := os.MkdirAll(indexDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create index directory: %w", err)
 	}
-	
-	maker, err := video.New()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create video maker: %w", err)
-	}
-	
+
 	return &Indexer{
-		indexDir:   indexDir,
-		embedder:   embedder,
-		videoMaker: maker,
+		indexDir: indexDir,
+		embedder: embedder,
 	}, nil
 }
 
-// BuildIndex creates a vector index for a .pixe file
-func (idx *Indexer) BuildIndex(memoryID, pixeFile string) (*MemoryIndex, error) {
+// SetProviders gives the credentials to embed queries for indexes built
+// with a model other than the indexer's embedder, or without one
+func (idx *Indexer) SetProviders(opts embedding.Options) {
+	idx.providers = opts
+}
+
+// SetVectorFormat chooses how BuildIndex stores embeddings. Formats other
+// than float32 make the files smaller but not a loaded index: searches use
+// float32 vectors, decoded from the file if need be.
+func (idx *Indexer) SetVectorFormat(format VectorFormat) {
+	idx.vectorFormat = format
+}
+
+// SetQuantization tunes the int8 and PQ formats. subspaces is the number of
+// PQ codes per vector, 0 for one per 8 dimensions: more is larger and more
+// accurate. keepExact stores the float32 vectors in a .vectors file next to
+// the index so the best candidates can be re-ranked exactly.
+func (idx *Indexer) SetQuantization(subspaces int, keepExact bool) {
+	idx.pqSubspaces = subspaces
+	idx.dropExact = !keepExact
+}
+
+// SetRerank sets how many candidates a search of a quantized index scores
+// exactly before returning the best; more trades speed for accuracy
+func (idx *Indexer) SetRerank(candidates int) {
+	idx.rerank = candidates
+}
+
+// SetBatching tunes how BuildIndex sends passages to the embedder
+func (idx *Indexer) SetBatching(opts embedding.BatchOptions) {
+	idx.batch = opts
+}
+
+// SetAllowPartial makes BuildIndex save an index when some passages could
+// not be embedded, listing their frames in MissingFrames, instead of
+// failing
+func (idx *Indexer) SetAllowPartial(allow bool) {
+	idx.allowPartial = allow
+}
+
+// SetProgress has BuildIndex report how many passages are embedded so far
+func (idx *Indexer) SetProgress(progress func(done, total int)) {
+	idx.progress = progress
+}
+
+// SetWarnings has BuildIndex report problems that do not stop it, such as
+// files it cannot index. Without it they are dropped.
+func (idx *Indexer) SetWarnings(warn func(warning string)) {
+	idx.warn = warn
+}
+
+func (idx *Indexer) warnf(format string, args ...interface{}) {
+	if idx.warn != nil {
+		idx.warn(fmt.Sprintf(format, args...))
+	}
+}
+
+// BuildIndex creates a vector index for a .pixe file. Every decoded chunk
+// is embedded in overlapping windows, each recording the video frame and
+// chunk it starts in so search results can be fetched with
+// video.Maker.ExtractSingleFrame.
+func (idx *Indexer) BuildIndex(ctx context.Context, memoryID, pixeFile string) (*MemoryIndex, error) {
 	if idx.embedder == nil {
 		return nil, fmt.Errorf("embedder required for building index - provide API key")
 	}
 	
-	fmt.Printf("Building index for %s...\n", memoryID)
-	
-	// Extract all frames (one-time cost)
-	tempDir, err := os.MkdirTemp("", "pixelog-index-*")
+	maker, err := video.New()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create video maker: %w", err)
 	}
-	defer os.RemoveAll(tempDir)
-	
-	err = idx.videoMaker.ExtractData(pixeFile, tempDir)
+
+	// Decode all frames (one-time cost)
+	scan, err := maker.DecodeChunks(pixeFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract frames: %w", err)
 	}
+	if err := scan.Unseal(nil); err != nil {
+		return nil, fmt.Errorf("failed to read frames: %w", err)
+	}
 	
-	// Read all extracted files and build frame index
-	extractedFiles, err := filepath.Glob(filepath.Join(tempDir, "*"))
-	if err != nil {
-		return nil, err
+	passages, skipped := chunkPassages(scan.Chunks)
+	for _, file := range skipped {
+		idx.warnf("not indexing %s: %s", file.Name, file.Reason)
+	}
+	if len(passages) == 0 {
+		return nil, fmt.Errorf("no text found to index in %s", pixeFile)
 	}
 	
 	index := &MemoryIndex{
@@ -77,70 +165,359 @@ func (idx *Indexer) BuildIndex(memoryID, pixeFile string) (*MemoryIndex, error)
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 		Version:     1,
+		VectorFormat: idx.vectorFormat,
+		PQSubspaces:  idx.pqSubspaces,
+		ExactVectors: !idx.dropExact,
+		EmbeddingModel: idx.embedder.Model(),
 	}
 	
-	frameNum := 0
-	for _, file := range extractedFiles {
-		content, err := os.ReadFile(file)
-		if err != nil {
-			continue
+	texts := make([]string, len(passages))
+	for i, p := range passages {
+		texts[i] = p.Text
+	}
+	var progress func(done int)
+	if idx.progress != nil {
+		progress = func(done int) { idx.progress(done, len(passages)) }
+	}
+	embeddings, err := embedding.EmbedAll(ctx, idx.embedder, texts, idx.batch, progress)
+	failed := map[int]error{}
+	var batchErr *embedding.BatchError
+	if errors.As(err, &batchErr) {
+		for _, f := range batchErr.Failures {
+			failed[f.Index] = f.Err
 		}
-		
-		text := string(content)
-		if len(text) == 0 {
-			continue
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to build index: %w", err)
+	}
+
+	// The model decides the dimension, Dim is only a guess from its name
+	for i, vector := range embeddings {
+		if failed[i] == nil {
+			index.VectorDim = len(vector)
+			break
 		}
-		
-		// Generate embedding
-		embedding, err := idx.embedder.Embed(text)
-		if err != nil {
-			fmt.Printf("Warning: failed to embed frame %d: %v\n", frameNum, err)
+	}
+	for i, vector := range embeddings {
+		if failed[i] == nil && len(vector) != index.VectorDim {
+			failed[i] = fmt.Errorf("embedding has %d dimensions, expected %d", len(vector), index.VectorDim)
+		}
+	}
+	if len(failed) > 0 {
+		index.MissingFrames = missingFrames(passages, failed)
+		report := fmt.Sprintf("%d of %d passages failed to embed, frames %s", len(failed), len(passages), formatFrames(index.MissingFrames))
+		if !idx.allowPartial || len(failed) == len(passages) {
+			return nil, fmt.Errorf("%s: %w", report, firstFailure(failed))
+		}
+		idx.warnf("%s; they are left out of the index and will not be found by search", report)
+	}
+
+	frames := make(map[int]bool)
+	var indexed []string
+	for i, p := range passages {
+		if failed[i] != nil {
 			continue
 		}
-		
+
 		// Create frame index entry
 		frameIdx := FrameIndex{
-			FrameNumber:  frameNum,
-			ChunkIndex:   frameNum, // TODO: Get from chunk metadata
-			SourceFile:   filepath.Base(file),
-			ContentHash:  fmt.Sprintf("%x", sha256.Sum256(content)),
-			ContentLen:   len(content),
-			Embedding:    embedding,
-			Preview:      truncate(text, 200),
+			FrameNumber:  p.Frame,
+			ChunkIndex:   p.ChunkIndex,
+			Hash:         p.FileHash,
+			SourceFile:   p.SourceFile,
+			Offset:       p.Offset,
+			ContentHash:  embedding.TextHash(p.Text),
+			ContentLen:   len(p.Text),
+			Embedding:    embeddings[i],
+			Preview:      truncate(p.Text, 200),
 		}
 		
 		index.Frames = append(index.Frames, frameIdx)
-		index.TotalFrames++
-		frameNum++
+		indexed = append(indexed, p.Text)
+		frames[p.Frame] = true
 	}
+	index.TotalFrames = len(frames)
+	index.lexical = newLexicalIndex(indexed)
 	
 	// Save index to disk
 	if err := idx.SaveIndex(index); err != nil {
 		return nil, fmt.Errorf("failed to save index: %w", err)
 	}
 	
-	fmt.Printf("Index built: %d frames, %d dimensions\n", index.TotalFrames, index.VectorDim)
 	return index, nil
 }
 
-// Search performs vector similarity search
-func (idx *Indexer) Search(index *MemoryIndex, query string, topK int) ([]SearchResult, error) {
+// missingFrames lists the frames of the failed passages, in order
+func missingFrames(passages []passage, failed map[int]error) []int {
+	var frames []int
+	for i := range failed {
+		frames = append(frames, passages[i].Frame)
+	}
+	slices.Sort(frames)
+	return slices.Compact(frames)
+}
+
+// formatFrames lists frame numbers for a message, the first ten only
+func formatFrames(frames []int) string {
+	var parts []string
+	for _, frame := range frames[:min(len(frames), 10)] {
+		parts = append(parts, strconv.Itoa(frame))
+	}
+	if len(frames) > 10 {
+		parts = append(parts, fmt.Sprintf("and %d more", len(frames)-10))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// firstFailure is the error of the earliest failed passage
+func firstFailure(failed map[int]error) error {
+	first := -1
+	for i := range failed {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	return failed[first]
+}
+
+// Search performs vector similarity search through the index's HNSW graph
+func (idx *Indexer) Search(ctx context.Context, index *MemoryIndex, query string, topK int) ([]SearchResult, error) {
+	return idx.SearchWith(ctx, index, query, topK, SearchSemantic)
+}
+
+// SearchWith ranks frames by embedding similarity, by BM25 over the indexed
+// text, or by both fused with reciprocal rank fusion. Queries are embedded
+// with the model the index was built with. Hybrid search uses whichever
+// ranking is available when there is no provider for that model or the
+// index has no term index.
+func (idx *Indexer) SearchWith(ctx context.Context, index *MemoryIndex, query string, topK int, mode SearchMode) ([]SearchResult, error) {
+	switch mode {
+	case SearchSemantic:
+		return idx.semanticSearch(ctx, index, query, topK)
+	case SearchLexical:
+		if index.lexical == nil {
+			return nil, fmt.Errorf("index has no term index for lexical search - rebuild it with pixe index")
+		}
+		return lexicalSearch(index, query, topK), nil
+	}
+
+	if index.lexical == nil {
+		return idx.semanticSearch(ctx, index, query, topK)
+	}
+	if _, err := idx.queryEmbedder(index); err != nil {
+		return lexicalSearch(index, query, topK), nil
+	}
+	depth := max(topK, fusionDepth)
+	semantic, err := idx.semanticSearch(ctx, index, query, depth)
+	if err != nil {
+		return nil, err
+	}
+	return fuseRankings(topK, semantic, lexicalSearch(index, query, depth)), nil
+}
+
+const (
+	fusionDepth = 50 // Results taken from each ranking before fusing
+	rrfK        = 60 // Damps the lead of top ranks in reciprocal rank fusion
+)
+
+// fuseRankings scores each frame by the sum of 1/(rrfK+rank) over the
+// rankings it appears in, so frames found by both come first
+func fuseRankings(topK int, rankings ...[]SearchResult) []SearchResult {
+	fused := make(map[int]*SearchResult)
+	var order []int
+	for _, ranking := range rankings {
+		for rank, r := range ranking {
+			f, ok := fused[r.pos]
+			if !ok {
+				r.Score = 0
+				f = &r
+				fused[r.pos] = f
+				order = append(order, r.pos)
+			}
+			f.Score += 1 / float32(rrfK+rank+1)
+		}
+	}
+
+	results := make([]SearchResult, len(order))
+	for i, pos := range order {
+		results[i] = *fused[pos]
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// lexicalSearch ranks frames by BM25 score
+func lexicalSearch(index *MemoryIndex, query string, topK int) []SearchResult {
+	var results []SearchResult
+	for _, h := range index.lexical.search(query, topK) {
+		results = append(results, index.result(h.pos, h.score))
+	}
+	return results
+}
+
+// semanticSearch ranks frames by cosine similarity to the query embedding
+func (idx *Indexer) semanticSearch(ctx context.Context, index *MemoryIndex, query string, topK int) ([]SearchResult, error) {
+	embedder, err := idx.queryEmbedder(index)
+	if err != nil {
+		return nil, err
+	}
+
 	// Embed the query
-	queryEmbed, err := idx.embedder.Embed(query)
+	queryEmbed, err := embedder.Embed(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to embed query: %w", err)
 	}
-	
-	// Calculate cosine similarity for all frames
-	type scored struct {
-		frame FrameIndex
+	return idx.SearchVector(index, queryEmbed, topK)
+}
+
+// SearchVector ranks frames by cosine similarity to a vector from the model
+// the index was built with, such as another frame's, see MemoryIndex.Vector
+func (idx *Indexer) SearchVector(index *MemoryIndex, queryEmbed []float32, topK int) ([]SearchResult, error) {
+	var err error
+	if index.graph == nil {
+		if index.graph, err = buildGraph(index); err != nil {
+			return nil, err
+		}
+	}
+	if index.quant != nil {
+		rerank := idx.rerank
+		if rerank <= 0 {
+			rerank = defaultRerank
+		}
+		return quantizedSearch(index, queryEmbed, topK, rerank), nil
+	}
+	if index.graph == nil {
+		return bruteForceSearch(index, queryEmbed, topK), nil
+	}
+
+	var results []SearchResult
+	for _, match := range index.graph.Search(queryEmbed, topK) {
+		i, _ := strconv.Atoi(match.Key)
+		results = append(results, index.result(i, match.Score))
+	}
+	return results, nil
+}
+
+// queryEmbedder returns a provider for the model the index was built with:
+// the indexer's embedder if it is that model, otherwise one created from
+// the credentials given to SetProviders. Indexes from before models were
+// recorded are searched with the indexer's embedder.
+func (idx *Indexer) queryEmbedder(index *MemoryIndex) (Embedder, error) {
+	if idx.embedder != nil && (index.EmbeddingModel == "" || idx.embedder.Model() == index.EmbeddingModel) {
+		return idx.embedder, nil
+	}
+	if index.EmbeddingModel == "" {
+		return nil, fmt.Errorf("embedder required for search - provide API key")
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if embedder, ok := idx.queryWith[index.EmbeddingModel]; ok {
+		return embedder, nil
+	}
+	embedder, err := embedding.ForModel(index.EmbeddingModel, idx.providers)
+	if err != nil {
+		return nil, fmt.Errorf("cannot embed queries for an index built with %s: %w", index.EmbeddingModel, err)
+	}
+	if idx.queryWith == nil {
+		idx.queryWith = make(map[string]Embedder)
+	}
+	idx.queryWith[index.EmbeddingModel] = embedder
+	return embedder, nil
+}
+
+// hit is a frame matched by one ranking, by position in the index
+type hit struct {
+	pos   int
+	score float32
+}
+
+// result describes the frame at position pos of the index
+func (index *MemoryIndex) result(pos int, score float32) SearchResult {
+	frame := index.Frame(pos)
+	return SearchResult{
+		FrameNumber: frame.FrameNumber,
+		Score:       score,
+		SourceFile:  frame.SourceFile,
+		Offset:      frame.Offset,
+		Preview:     frame.Preview,
+		ChunkIndex:  frame.ChunkIndex,
+		pos:         pos,
+	}
+}
+
+// quantizedSearch takes the best candidates from the index's HNSW graph, or
+// from scoring every code if it has none, then ranks them by exact cosine
+// similarity if the exact vectors are loaded and by their codes otherwise.
+// The graph holds decoded float32 vectors, so a loaded quantized index uses
+// as much memory as an unquantized one; quantization only shrinks the files.
+func quantizedSearch(index *MemoryIndex, queryEmbed []float32, topK, rerank int) []SearchResult {
+	if len(queryEmbed) != index.VectorDim || topK <= 0 {
+		return nil
+	}
+	query := normalized(queryEmbed)
+	score := index.quant.scorer(query)
+
+	type candidate struct {
+		frame int
 		score float32
 	}
-	
-	scores := make([]scored, 0, len(index.Frames))
-	for _, frame := range index.Frames {
-		similarity := cosineSimilarity(queryEmbed, frame.Embedding)
-		scores = append(scores, scored{frame: frame, score: similarity})
+	keep := max(rerank, topK)
+	var candidates []candidate
+	if index.graph != nil {
+		for _, match := range index.graph.Search(query, keep) {
+			i, _ := strconv.Atoi(match.Key)
+			candidates = append(candidates, candidate{frame: i})
+		}
+	} else {
+		// Keep the best candidates sorted, best first
+		candidates = make([]candidate, 0, keep+1)
+		for i := 0; i < index.Len(); i++ {
+			s := score(i)
+			if len(candidates) == keep && s <= candidates[keep-1].score {
+				continue
+			}
+			at := sort.Search(len(candidates), func(j int) bool { return candidates[j].score < s })
+			candidates = slices.Insert(candidates, at, candidate{i, s})
+			if len(candidates) > keep {
+				candidates = candidates[:keep]
+			}
+		}
+	}
+
+	for i, c := range candidates {
+		if exact := index.exact(c.frame); exact != nil {
+			candidates[i].score = embedding.Cosine(query, exact)
+		} else if index.graph != nil {
+			candidates[i].score = score(c.frame)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > topK {
+		candidates = candidates[:topK]
+	}
+
+	results := make([]SearchResult, len(candidates))
+	for i, c := range candidates {
+		results[i] = index.result(c.frame, c.score)
+	}
+	return results
+}
+
+// bruteForceSearch scores every frame, for indexes without vectors to build
+// a graph from
+func bruteForceSearch(index *MemoryIndex, queryEmbed []float32, topK int) []SearchResult {
+	// Calculate cosine similarity for all frames
+	scores := make([]hit, 0, index.Len())
+	for i := 0; i < index.Len(); i++ {
+		similarity := embedding.Cosine(queryEmbed, index.exact(i))
+		scores = append(scores, hit{pos: i, score: similarity})
 	}
 	
 	// Sort by score descending
@@ -155,22 +532,49 @@ func (idx *Indexer) Search(index *MemoryIndex, query string, topK int) ([]Search
 	
 	results := make([]SearchResult, topK)
 	for i := 0; i < topK; i++ {
-		results[i] = SearchResult{
-			FrameNumber: scores[i].frame.FrameNumber,
-			Score:       scores[i].score,
-			SourceFile:  scores[i].frame.SourceFile,
-			Preview:     scores[i].frame.Preview,
-			ChunkIndex:  scores[i].frame.ChunkIndex,
-		}
+		results[i] = index.result(scores[i].pos, scores[i].score)
 	}
 	
-	return results, nil
+	return results
 }
 
-// LoadIndex loads an index from disk
+// LoadIndex memory-maps an index from disk and loads its HNSW graph. A
+// missing or outdated graph is rebuilt from the stored embeddings, and
+// indexes saved as JSON by earlier versions are converted. Close the index
+// when done with it.
 func (idx *Indexer) LoadIndex(memoryID string) (*MemoryIndex, error) {
-	indexPath := filepath.Join(idx.indexDir, memoryID+".index")
-	data, err := os.ReadFile(indexPath)
+	indexPath := idx.indexPath(memoryID)
+	index, tag, err := readIndexFile(indexPath)
+	if errors.Is(err, errJSONIndex) {
+		return idx.convertJSONIndex(memoryID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Without a term index only semantic search works, see SearchWith
+	index.lexical, _ = loadTerms(termsPath(indexPath), tag, index.Len())
+
+	index.graph, err = loadGraph(graphPath(indexPath), tag, index)
+	if err != nil {
+		if index.graph, err = buildGraph(index); err != nil {
+			index.Close()
+			return nil, err
+		}
+		// Best effort, the graph is rebuilt again next time if this fails
+		if index.graph != nil {
+			idx.saving.Lock()
+			saveGraph(graphPath(indexPath), tag, index.graph)
+			idx.saving.Unlock()
+		}
+	}
+	
+	return index, nil
+}
+
+// convertJSONIndex loads an index saved as JSON and rewrites it in the
+// binary format
+func (idx *Indexer) convertJSONIndex(memoryID string) (*MemoryIndex, error) {
+	data, err := os.ReadFile(idx.indexPath(memoryID))
 	if err != nil {
 		return nil, fmt.Errorf("index not found: %w", err)
 	}
@@ -179,48 +583,147 @@ func (idx *Indexer) LoadIndex(memoryID string) (*MemoryIndex, error) {
 	if err := json.Unmarshal(data, &index); err != nil {
 		return nil, fmt.Errorf("failed to parse index: %w", err)
 	}
-	
-	return &index, nil
+	if err := idx.SaveIndex(&index); err != nil {
+		return nil, fmt.Errorf("failed to convert index: %w", err)
+	}
+	return idx.LoadIndex(memoryID)
 }
 
-// SaveIndex saves an index to disk
+// SaveIndex saves an index to disk, with its HNSW graph in a .hnsw file
+// next to it. Each file is replaced atomically, so a failed save leaves the
+// previous index loadable, and concurrent saves are serialized.
 func (idx *Indexer) SaveIndex(index *MemoryIndex) error {
-	indexPath := filepath.Join(idx.indexDir, index.MemoryID+".index")
-	data, err := json.MarshalIndent(index, "", "  ")
+	idx.saving.Lock()
+	defer idx.saving.Unlock()
+	indexPath := idx.indexPath(index.MemoryID)
+	tag, err := writeIndexFile(indexPath, index)
 	if err != nil {
-		return fmt.Errorf("failed to marshal index: %w", err)
+		return err
 	}
-	
-	if err := os.WriteFile(indexPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write index: %w", err)
+	if index.lexical != nil && len(index.lexical.Lengths) == index.Len() {
+		if err := saveTerms(termsPath(indexPath), tag, index.lexical); err != nil {
+			return err
+		}
+	} else {
+		index.lexical = nil
+		os.Remove(termsPath(indexPath))
+	}
+	// Frames may have changed since the graph was built
+	if index.graph == nil || index.graph.Len() != index.Len() {
+		if index.graph, err = buildGraph(index); err != nil {
+			return err
+		}
+	}
+	if index.graph == nil {
+		os.Remove(graphPath(indexPath))
+		return nil
+	}
+	return saveGraph(graphPath(indexPath), tag, index.graph)
+}
+
+func (idx *Indexer) indexPath(memoryID string) string {
+	return filepath.Join(idx.indexDir, memoryID+".index")
+}
+
+// graphPath returns where the HNSW graph of an index is stored
+func graphPath(indexPath string) string {
+	return strings.TrimSuffix(indexPath, ".index") + ".hnsw"
+}
+
+// buildGraph inserts every frame vector into a new HNSW graph, keyed by the
+// frame's position in the index. Indexes without vectors get no graph.
+func buildGraph(index *MemoryIndex) (*hnsw.Graph, error) {
+	if index.VectorDim <= 0 || index.Len() == 0 {
+		return nil, nil
+	}
+	graph, err := hnsw.New(index.VectorDim, hnsw.DefaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vector index: %w", err)
+	}
+	for i := 0; i < index.Len(); i++ {
+		if err := graph.Insert(strconv.Itoa(i), index.Vector(i)); err != nil {
+			return nil, fmt.Errorf("failed to index frame %d: %w", index.Frame(i).FrameNumber, err)
+		}
+	}
+	return graph, nil
+}
+
+// saveGraph writes the graph links after the tag of the index file whose
+// vectors they connect
+func saveGraph(path string, tag [8]byte, graph *hnsw.Graph) error {
+	var buf bytes.Buffer
+	if _, err := graph.WriteLinksTo(&buf); err != nil {
+		return err
+	}
+	if err := writeTagged(path, tag, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write vector index: %w", err)
 	}
-	
 	return nil
 }
 
-// cosineSimilarity calculates cosine similarity between two vectors
-func cosineSimilarity(a, b []float32) float32 {
-	if len(a) != len(b) {
-		return 0
+// writeTagged replaces a file next to an index atomically with the index
+// file's tag followed by data
+func writeTagged(path string, tag [8]byte, data []byte) error {
+	// A temporary file of its own, in case another process saves the same index
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tagged-*")
+	if err != nil {
+		return err
 	}
-	
-	var dotProduct, normA, normB float32
-	for i := range a {
-		dotProduct += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(append(tag[:], data...)); err != nil {
+		temp.Close()
+		return err
 	}
-	
-	if normA == 0 || normB == 0 {
-		return 0
+	if err := temp.Close(); err != nil {
+		return err
 	}
-	
-	return dotProduct / (float32(math.Sqrt(float64(normA))) * float32(math.Sqrt(float64(normB))))
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// loadGraph reads the graph links saved with the given tag and attaches them
+// to the index embeddings, failing if they belong to different contents
+func loadGraph(path string, tag [8]byte, index *MemoryIndex) (*hnsw.Graph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var stored [8]byte
+	if _, err := io.ReadFull(file, stored[:]); err != nil {
+		return nil, err
+	}
+	if stored != tag {
+		return nil, fmt.Errorf("vector index %s is out of date", path)
+	}
+	return hnsw.ReadLinks(file, func(key string) ([]float32, bool) {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= index.Len() {
+			return nil, false
+		}
+		return index.Vector(i), true
+	})
+}
+
+// Vector returns the vector of the frame at position pos: its embedding,
+// or the unit vector decoded from its code for a quantized index loaded
+// without exact vectors
+func (index *MemoryIndex) Vector(pos int) []float32 {
+	if exact := index.exact(pos); exact != nil {
+		return exact
+	}
+	if index.quant != nil && pos < index.quant.count() {
+		return normalized(index.quant.decode(pos))
+	}
+	return nil
 }
 
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
 	}
-	return s[:maxLen] + "..."
+	return s[:runeBoundary(s, maxLen)] + "..."
 }
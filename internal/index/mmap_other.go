@@ -0,0 +1,22 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package index
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the file into memory. Windows cannot rename over a mapped
+// file, which SaveIndex does, so only Unix systems map index files.
+func mapFile(file *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
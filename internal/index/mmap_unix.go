@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package index
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the first size bytes of file read-only. The mapping stays
+// valid after the file is closed or replaced by a rename.
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return unix.Mmap(int(file.Fd()), 0, size, unix.PROT_READ, unix.MAP_SHARED)
+}
+
+func unmapFile(data []byte) error {
+	return unix.Munmap(data)
+}
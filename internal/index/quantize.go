@@ -0,0 +1,273 @@
+package index
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+)
+
+// Quantized indexes store compact codes instead of float vectors. A search
+// scores every code against the exact query (asymmetric distance), then
+// re-ranks the best candidates with the exact vectors kept in a .vectors
+// file next to the index, when there is one.
+
+const (
+	pqCentroids      = 256  // Codes are one byte per subspace
+	pqTrainingSample = 4096 // Vectors the codebooks are trained on
+	pqIterations     = 8    // k-means rounds per subspace
+)
+
+// quantizer holds the codes of an int8 or PQ index
+type quantizer struct {
+	format    VectorFormat
+	dim       int
+	subspaces int       // PQ only
+	codebook  []float32 // PQ only: subspaces x pqCentroids centroids of dim/subspaces
+	codes     []byte    // One row per frame, see rowSize
+}
+
+// rowSize is the bytes per frame: a float32 scale and a byte per dimension
+// for int8, a byte per subspace for PQ
+func (q *quantizer) rowSize() int {
+	if q.format == VectorPQ {
+		return q.subspaces
+	}
+	return 4 + q.dim
+}
+
+func (q *quantizer) count() int {
+	return len(q.codes) / q.rowSize()
+}
+
+func (q *quantizer) row(i int) []byte {
+	size := q.rowSize()
+	return q.codes[i*size : (i+1)*size]
+}
+
+// pqSubspaces picks the largest divisor of dim not above want, which
+// defaults to dim/8, so every subspace has the same width
+func pqSubspaces(dim, want int) int {
+	if want <= 0 {
+		want = dim / 8
+	}
+	want = min(max(want, 1), dim)
+	for dim%want != 0 {
+		want--
+	}
+	return want
+}
+
+// newQuantizer encodes unit-length vectors, training PQ codebooks on them
+func newQuantizer(format VectorFormat, dim, subspaces int, vectors [][]float32) *quantizer {
+	q := &quantizer{format: format, dim: dim}
+	if format == VectorPQ {
+		q.subspaces = pqSubspaces(dim, subspaces)
+		q.codebook = trainCodebook(dim, q.subspaces, vectors)
+	}
+
+	q.codes = make([]byte, len(vectors)*q.rowSize())
+	var norms []float32
+	if format == VectorPQ {
+		norms = centroidNorms(q.codebook, q.dim/q.subspaces)
+	}
+	parallel(len(vectors), func(i int) {
+		if format == VectorPQ {
+			q.encodePQ(q.row(i), vectors[i], norms)
+		} else {
+			encodeInt8(q.row(i), vectors[i])
+		}
+	})
+	return q
+}
+
+// parallel calls fn for 0 to n-1 across all CPUs
+func parallel(n int, fn func(i int)) {
+	workers := min(runtime.NumCPU(), n)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// encodeInt8 scales v so its largest component maps to 127
+func encodeInt8(row []byte, v []float32) {
+	var peak float32
+	for _, x := range v {
+		peak = max(peak, float32(math.Abs(float64(x))))
+	}
+	binary.LittleEndian.PutUint32(row, math.Float32bits(peak))
+	for j, x := range v {
+		if peak > 0 {
+			row[4+j] = byte(int8(math.Round(float64(x / peak * 127))))
+		}
+	}
+}
+
+// encodePQ encodes each subspace of v as its nearest centroid
+func (q *quantizer) encodePQ(row []byte, v []float32, norms []float32) {
+	width := q.dim / q.subspaces
+	for s := range row {
+		block := s * pqCentroids
+		row[s] = byte(nearest(v[s*width:(s+1)*width], q.codebook[block*width:(block+pqCentroids)*width], norms[block:block+pqCentroids]))
+	}
+}
+
+// trainCodebook runs k-means in every subspace over a sample of vectors
+func trainCodebook(dim, subspaces int, vectors [][]float32) []float32 {
+	rng := rand.New(rand.NewPCG(uint64(dim), uint64(subspaces)))
+	sample := vectors
+	if len(sample) > pqTrainingSample {
+		sample = make([][]float32, pqTrainingSample)
+		for i, j := range rng.Perm(len(vectors))[:pqTrainingSample] {
+			sample[i] = vectors[j]
+		}
+	}
+
+	width := dim / subspaces
+	codebook := make([]float32, subspaces*pqCentroids*width)
+	seeds := make([]uint64, subspaces)
+	for s := range seeds {
+		seeds[s] = rng.Uint64()
+	}
+	parallel(subspaces, func(s int) {
+		points := make([][]float32, len(sample))
+		for i, v := range sample {
+			points[i] = v[s*width : (s+1)*width]
+		}
+		rng := rand.New(rand.NewPCG(seeds[s], uint64(s)))
+		copy(codebook[s*pqCentroids*width:], kmeans(points, width, rng))
+	})
+	return codebook
+}
+
+// kmeans returns pqCentroids centroids of the points. With fewer points than
+// centroids the spare centroids repeat points and are never the only match.
+func kmeans(points [][]float32, width int, rng *rand.Rand) []float32 {
+	centroids := make([]float32, pqCentroids*width)
+	if len(points) == 0 {
+		return centroids
+	}
+	order := rng.Perm(len(points))
+	for c := 0; c < pqCentroids; c++ {
+		copy(centroids[c*width:], points[order[c%len(points)]])
+	}
+
+	sums := make([]float64, pqCentroids*width)
+	counts := make([]int, pqCentroids)
+	for round := 0; round < pqIterations; round++ {
+		clear(sums)
+		clear(counts)
+		norms := centroidNorms(centroids, width)
+		for _, p := range points {
+			c := nearest(p, centroids, norms)
+			counts[c]++
+			for j, x := range p {
+				sums[c*width+j] += float64(x)
+			}
+		}
+		for c, n := range counts {
+			if n == 0 {
+				continue // Keep empty clusters where they are
+			}
+			for j := 0; j < width; j++ {
+				centroids[c*width+j] = float32(sums[c*width+j] / float64(n))
+			}
+		}
+	}
+	return centroids
+}
+
+// centroidNorms returns the squared length of every centroid
+func centroidNorms(centroids []float32, width int) []float32 {
+	norms := make([]float32, len(centroids)/width)
+	for c := range norms {
+		for _, x := range centroids[c*width : (c+1)*width] {
+			norms[c] += x * x
+		}
+	}
+	return norms
+}
+
+// nearest returns the index of the centroid closest to v. Squared distance
+// is |v|^2 - 2 v.c + |c|^2, and |v|^2 is the same for every centroid.
+func nearest(v, centroids, norms []float32) int {
+	width := len(v)
+	best, bestDist := 0, float32(math.Inf(1))
+	for c, norm := range norms {
+		centroid := centroids[c*width : (c+1)*width]
+		var dot float32
+		for j, x := range v {
+			dot += x * centroid[j]
+		}
+		if dist := norm - 2*dot; dist < bestDist {
+			best, bestDist = c, dist
+		}
+	}
+	return best
+}
+
+// scorer returns a function estimating the cosine similarity between a
+// unit-length query and frame i from its code
+func (q *quantizer) scorer(query []float32) func(i int) float32 {
+	if q.format == VectorPQ {
+		// Dot products of each query subspace with every centroid, so scoring
+		// a frame is one table lookup per subspace
+		width := q.dim / q.subspaces
+		table := make([]float32, q.subspaces*pqCentroids)
+		for s := 0; s < q.subspaces; s++ {
+			sub := query[s*width : (s+1)*width]
+			for c := 0; c < pqCentroids; c++ {
+				centroid := q.codebook[(s*pqCentroids+c)*width:]
+				var dot float32
+				for j, x := range sub {
+					dot += x * centroid[j]
+				}
+				table[s*pqCentroids+c] = dot
+			}
+		}
+		return func(i int) float32 {
+			var score float32
+			for s, c := range q.row(i) {
+				score += table[s*pqCentroids+int(c)]
+			}
+			return score
+		}
+	}
+
+	return func(i int) float32 {
+		row := q.row(i)
+		scale := math.Float32frombits(binary.LittleEndian.Uint32(row)) / 127
+		var dot float32
+		for j, c := range row[4:] {
+			dot += query[j] * float32(int8(c))
+		}
+		return dot * scale
+	}
+}
+
+// decode reconstructs the approximate vector of frame i
+func (q *quantizer) decode(i int) []float32 {
+	v := make([]float32, q.dim)
+	row := q.row(i)
+	if q.format == VectorPQ {
+		width := q.dim / q.subspaces
+		for s, c := range row {
+			copy(v[s*width:], q.codebook[(s*pqCentroids+int(c))*width:(s*pqCentroids+int(c)+1)*width])
+		}
+		return v
+	}
+	scale := math.Float32frombits(binary.LittleEndian.Uint32(row)) / 127
+	for j, c := range row[4:] {
+		v[j] = float32(int8(c)) * scale
+	}
+	return v
+}
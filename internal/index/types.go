@@ -1,17 +1,76 @@
 package index
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/ArqonAi/Pixelog/internal/hnsw"
+)
 
 // MemoryIndex stores vector embeddings and metadata for fast retrieval
 type MemoryIndex struct {
 	MemoryID     string                  `json:"memory_id"`
 	PixeFile     string                  `json:"pixe_file"`
-	TotalFrames  int                     `json:"total_frames"`
+	TotalFrames  int                     `json:"total_frames"`   // Distinct video frames covered by Frames
 	VectorDim    int                     `json:"vector_dim"`     // 384 for minilm, 1536 for OpenAI
-	Frames       []FrameIndex            `json:"frames"`
+	EmbeddingModel string                `json:"embedding_model,omitempty"` // Model of the embedder that built the index, if it reports one
+	Frames       []FrameIndex            `json:"frames"` // Passages of an index being built; read those of a loaded index with Len and Frame
 	CreatedAt    time.Time               `json:"created_at"`
 	UpdatedAt    time.Time               `json:"updated_at"`
 	Version      int                     `json:"version"`        // For delta encoding
+	VectorFormat VectorFormat            `json:"vector_format"`  // How embeddings are stored on disk
+	PQSubspaces  int                     `json:"pq_subspaces,omitempty"` // Product quantisation subspaces, 0 for dim/8
+	ExactVectors bool                    `json:"exact_vectors,omitempty"` // Keep float32 vectors of quantized indexes for re-ranking
+	MissingFrames []int                  `json:"missing_frames,omitempty"` // Frames with passages that failed to embed, see Indexer.SetAllowPartial
+
+	graph       *hnsw.Graph // HNSW graph over Frames, stored in a .hnsw file next to the index
+	quant       *quantizer  // Codes of int8 and PQ indexes, searched instead of the graph
+	mapped      []byte      // Memory-mapped index file the embeddings or codes point into
+	mappedExact []byte      // Memory-mapped .vectors file of a quantized index
+	frameTable  []byte      // Fixed-width frame records of a loaded index in the mapping, see Frame
+	frameText   []byte      // Text fields of those frames as JSON, decoded by Frame
+	vectors     []float32   // Exact unit embeddings of a loaded index by position, VectorDim each
+	lexical     *lexicalIndex // BM25 index over the frame text, stored in a .terms file
+}
+
+// VectorFormat is how embeddings are stored in a binary index file
+type VectorFormat uint8
+
+const (
+	VectorFloat32 VectorFormat = iota // 4 bytes per dimension, exact
+	VectorFloat16                     // 2 bytes per dimension, about 3 significant digits, decoded to float32 when loaded
+	VectorInt8                        // 1 byte per dimension plus a scale, 4x smaller
+	VectorPQ                          // 1 byte per subspace of 8 dimensions by default, 32x smaller
+)
+
+// ParseVectorFormat parses a format name as given on the command line
+func ParseVectorFormat(name string) (VectorFormat, error) {
+	for f := VectorFloat32; f <= VectorPQ; f++ {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown vector format %q (use float32, float16, int8 or pq)", name)
+}
+
+func (f VectorFormat) String() string {
+	switch f {
+	case VectorFloat32:
+		return "float32"
+	case VectorFloat16:
+		return "float16"
+	case VectorInt8:
+		return "int8"
+	case VectorPQ:
+		return "pq"
+	default:
+		return fmt.Sprintf("VectorFormat(%d)", uint8(f))
+	}
+}
+
+// quantized reports whether the format stores codes rather than floats
+func (f VectorFormat) quantized() bool {
+	return f == VectorInt8 || f == VectorPQ
 }
 
 // FrameIndex contains metadata and embedding for a single frame
@@ -20,19 +79,55 @@ type FrameIndex struct {
 	ChunkIndex   int       `json:"chunk_index"`   // Chunk index in file
 	Hash         string    `json:"hash"`          // File hash (for grouping)
 	SourceFile   string    `json:"source_file"`   // Original filename
+	Offset       int       `json:"offset"`        // Byte offset of the embedded text in the file
 	ContentHash  string    `json:"content_hash"`  // Hash of decoded content
 	ContentLen   int       `json:"content_len"`   // Content length in bytes
-	Embedding    []float32 `json:"embedding"`     // Vector embedding
+	Embedding    []float32 `json:"embedding,omitempty"` // Vector embedding, unit length and read-only once loaded
 	Preview      string    `json:"preview"`       // First 200 chars for debugging
 }
 
-// SearchResult represents a frame matched by vector search
+// SearchResult represents a frame matched by search
 type SearchResult struct {
 	FrameNumber  int       `json:"frame_number"`
-	Score        float32   `json:"score"`         // Cosine similarity
+	Score        float32   `json:"score"`         // Cosine similarity, BM25 score or fused rank score, by SearchMode
 	SourceFile   string    `json:"source_file"`
+	Offset       int       `json:"offset"`        // Byte offset of the matched text in the file
 	Preview      string    `json:"preview"`
 	ChunkIndex   int       `json:"chunk_index"`
+
+	pos int // Position in MemoryIndex.Frames, identifies the match when fusing rankings
+}
+
+// SearchMode chooses how Indexer.SearchWith ranks frames
+type SearchMode uint8
+
+const (
+	SearchHybrid   SearchMode = iota // Semantic and lexical rankings fused
+	SearchSemantic                   // Cosine similarity of embeddings
+	SearchLexical                    // BM25 over the indexed text, finds exact identifiers
+)
+
+// ParseSearchMode parses a mode name as given on the command line or in a request
+func ParseSearchMode(name string) (SearchMode, error) {
+	for m := SearchHybrid; m <= SearchLexical; m++ {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown search mode %q (use hybrid, semantic or lexical)", name)
+}
+
+func (m SearchMode) String() string {
+	switch m {
+	case SearchHybrid:
+		return "hybrid"
+	case SearchSemantic:
+		return "semantic"
+	case SearchLexical:
+		return "lexical"
+	default:
+		return fmt.Sprintf("SearchMode(%d)", uint8(m))
+	}
 }
 
 // DeltaVersion represents an incremental change to a memory
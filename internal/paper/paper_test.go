@@ -0,0 +1,114 @@
+package paper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/qr/qrtest"
+)
+
+func testChunks(data []byte, size int) []qr.Chunk {
+	return qrtest.Split(base64.StdEncoding.EncodeToString(data), size, qr.Chunk{
+		ID:         "abcd",
+		SourceFile: "notes (draft).bin",
+		MimeType:   "application/octet-stream",
+		Hash:       "abcdef0123456789",
+	})
+}
+
+func TestPrintWritesValidXref(t *testing.T) {
+	chunks := testChunks(bytes.Repeat([]byte("paper "), 200), 400)
+	chunks = append(chunks, qr.BuildParity(chunks, 2)...)
+
+	var buf bytes.Buffer
+	if err := Print(chunks, &buf, Options{Title: "notes.pixe", Columns: 2, Rows: 2}); err != nil {
+		t.Fatalf("print failed: %v", err)
+	}
+	pdf := buf.Bytes()
+
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("missing startxref trailer")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i+1, pdf[offset:offset+12])
+		}
+	}
+
+	// 4 data + 2 parity codes at 4 per page, after one manifest page
+	if pages := bytes.Count(pdf, []byte("/Type /Page ")); pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+	if got := escapeText("notes (draft)\\é"); got != `notes \(draft\)\\?` {
+		t.Errorf("unexpected escaped text %q", got)
+	}
+}
+
+func TestScanRecoversFromPageImages(t *testing.T) {
+	data := bytes.Repeat([]byte("scan me back "), 60)
+	chunks := testChunks(data, 260)
+
+	// Draw the codes onto two "scanned" pages, in reverse page order
+	dir := t.TempDir()
+	const scale = 3
+	for p := 0; p < 2; p++ {
+		canvas := image.NewGray(image.Rect(0, 0, 900, 1200))
+		draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+		for slot, chunk := range chunks[p*2 : min(p*2+2, len(chunks))] {
+			matrix, err := qr.EncodeMatrix(chunk)
+			if err != nil {
+				t.Fatalf("failed to encode chunk: %v", err)
+			}
+			ox, oy := 40+slot*430, 100
+			for y := 0; y < matrix.GetHeight()*scale; y++ {
+				for x := 0; x < matrix.GetWidth()*scale; x++ {
+					if matrix.Get(x/scale, y/scale) {
+						canvas.Pix[(oy+y)*canvas.Stride+ox+x] = 0
+					}
+				}
+			}
+		}
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("page%d.png", 2-p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(file, canvas); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+
+	out := t.TempDir()
+	report, err := Scan(dir, out, nil)
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if !report.Complete() || len(report.Files) != 1 {
+		t.Fatalf("expected one complete file, got %+v", report.Files)
+	}
+	got, err := os.ReadFile(report.Files[0].OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("scanned file does not match original")
+	}
+}
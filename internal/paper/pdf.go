@@ -0,0 +1,189 @@
+package paper
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+)
+
+// document is a minimal PDF 1.4 writer supporting what paper archives need:
+// pages, Helvetica text and 1-bit images. Object 1 is the catalog, object 2
+// the page tree and object 3 the font.
+type document struct {
+	width   float64
+	height  float64
+	objects [][]byte
+	pages   []int
+}
+
+// page collects the content stream and image resources of one page
+type page struct {
+	content bytes.Buffer
+	images  map[string]int
+}
+
+func newDocument(width, height float64) *document {
+	d := &document{width: width, height: height}
+	d.objects = make([][]byte, 3)
+	d.objects[2] = []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	return d
+}
+
+func newPage() *page {
+	return &page{images: make(map[string]int)}
+}
+
+// add stores an object body and returns its object number
+func (d *document) add(body []byte) int {
+	d.objects = append(d.objects, body)
+	return len(d.objects)
+}
+
+// addStream stores a Flate-compressed stream object with extra dictionary entries
+func (d *document) addStream(dict string, data []byte) (int, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return 0, fmt.Errorf("failed to compress stream: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to compress stream: %w", err)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<< %s /Filter /FlateDecode /Length %d >>\nstream\n", dict, compressed.Len())
+	body.Write(compressed.Bytes())
+	body.WriteString("\nendstream")
+	return d.add(body.Bytes()), nil
+}
+
+// addMatrix stores a QR bit matrix as a 1-bit grayscale image, one pixel per module
+func (d *document) addMatrix(matrix *gozxing.BitMatrix) (int, error) {
+	w, h := matrix.GetWidth(), matrix.GetHeight()
+	rowBytes := (w + 7) / 8
+	data := make([]byte, rowBytes*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// In DeviceGray 1 is white; set modules stay 0 (black)
+			if !matrix.Get(x, y) {
+				data[y*rowBytes+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 1 /Interpolate false", w, h)
+	return d.addStream(dict, data)
+}
+
+// addPage appends a finished page to the document
+func (d *document) addPage(p *page) error {
+	content, err := d.addStream("", p.content.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var resources strings.Builder
+	resources.WriteString("<< /Font << /F1 3 0 R >>")
+	if len(p.images) > 0 {
+		resources.WriteString(" /XObject <<")
+		names := make([]string, 0, len(p.images))
+		for name := range p.images {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&resources, " /%s %d 0 R", name, p.images[name])
+		}
+		resources.WriteString(" >>")
+	}
+	resources.WriteString(" >>")
+
+	obj := d.add([]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+		d.width, d.height, resources.String(), content)))
+	d.pages = append(d.pages, obj)
+	return nil
+}
+
+// writeTo serializes the document with a cross-reference table
+func (d *document) writeTo(w io.Writer) error {
+	d.objects[0] = []byte("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids strings.Builder
+	for i, obj := range d.pages {
+		if i > 0 {
+			kids.WriteByte(' ')
+		}
+		fmt.Fprintf(&kids, "%d 0 R", obj)
+	}
+	d.objects[1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(d.pages)))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objects))
+	for i, body := range d.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(body)
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, xref)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+// text draws a single line of Helvetica text with its baseline at (x, y)
+func (p *page) text(x, y, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F1 %.1f Tf %.2f %.2f Td (%s) Tj ET\n", size, x, y, escapeText(s))
+}
+
+// textRight draws text whose right edge ends at x
+func (p *page) textRight(x, y, size float64, s string) {
+	p.text(x-textWidth(s, size), y, size, s)
+}
+
+// line strokes a thin rule from (x1, y1) to (x2, y2)
+func (p *page) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// image places an image object scaled to the given box
+func (p *page) image(obj int, x, y, w, h float64) {
+	name := fmt.Sprintf("Im%d", obj)
+	p.images[name] = obj
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", w, h, x, y, name)
+}
+
+// escapeText makes a string safe for a PDF literal, replacing characters
+// outside printable ASCII since only the standard font encoding is used
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// textWidth approximates Helvetica string width, enough for right alignment
+func textWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * 0.52
+}
@@ -0,0 +1,294 @@
+package paper
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+// PaperSize is a page size in PDF points (1/72 inch)
+type PaperSize struct {
+	Name   string
+	Width  float64
+	Height float64
+}
+
+var (
+	A4     = PaperSize{Name: "a4", Width: 595.28, Height: 841.89}
+	Letter = PaperSize{Name: "letter", Width: 612, Height: 792}
+)
+
+// PaperSizeByName looks up a supported paper size
+func PaperSizeByName(name string) (PaperSize, error) {
+	switch strings.ToLower(name) {
+	case "a4":
+		return A4, nil
+	case "letter":
+		return Letter, nil
+	default:
+		return PaperSize{}, fmt.Errorf("unsupported paper size: %s (use a4 or letter)", name)
+	}
+}
+
+// Options controls the printed layout
+type Options struct {
+	Title     string    // Shown in every page header, usually the archive name
+	Paper     PaperSize // Defaults to A4
+	Columns   int       // QR codes per row, defaults to 2
+	Rows      int       // QR rows per page, defaults to 3
+	PrintedAt time.Time // Defaults to now
+}
+
+const (
+	margin       = 36.0 // Half an inch keeps clear of printer dead zones
+	headerHeight = 34.0
+	footerHeight = 20.0
+	captionSize  = 7.0
+)
+
+func (o Options) withDefaults() Options {
+	if o.Paper.Width == 0 {
+		o.Paper = A4
+	}
+	if o.Columns <= 0 {
+		o.Columns = 2
+	}
+	if o.Rows <= 0 {
+		o.Rows = 3
+	}
+	if o.PrintedAt.IsZero() {
+		o.PrintedAt = time.Now()
+	}
+	return o
+}
+
+// fileSummary describes one file of the archive on the manifest page
+type fileSummary struct {
+	name      string
+	mimeType  string
+	hash      string
+	total     int
+	parity    int
+	encrypted bool
+	sealed    bool // Frames of a sealed archive, whose files are hidden
+	firstPage int
+	lastPage  int
+}
+
+// Print lays the chunks out as QR grids on printable pages, preceded by a
+// manifest page listing every file and how to scan the pages back. Chunks
+// are grouped by file, data before parity, in index order.
+func Print(chunks []qr.Chunk, w io.Writer, opts Options) error {
+	if len(chunks) == 0 {
+		return fmt.Errorf("no chunks to print")
+	}
+	opts = opts.withDefaults()
+
+	ordered := make([]qr.Chunk, len(chunks))
+	copy(ordered, chunks)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.SourceFile != b.SourceFile {
+			return a.SourceFile < b.SourceFile
+		}
+		if a.Hash != b.Hash {
+			return a.Hash < b.Hash
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Index < b.Index
+	})
+
+	perPage := opts.Columns * opts.Rows
+	gridPages := (len(ordered) + perPage - 1) / perPage
+	files := summarize(ordered, perPage)
+
+	doc := newDocument(opts.Paper.Width, opts.Paper.Height)
+
+	// Manifest pages come first; their count does not depend on page numbers,
+	// so lay the manifest out once to size it and again with real numbers
+	linesPerPage := int((opts.Paper.Height - 2*margin - headerHeight - footerHeight) / 12)
+	manifestPages := (len(manifestLines(files, len(ordered), gridPages, 0, opts)) + linesPerPage - 1) / linesPerPage
+	manifest := manifestLines(files, len(ordered), gridPages, manifestPages, opts)
+	totalPages := manifestPages + gridPages
+
+	for p := 0; p < manifestPages; p++ {
+		pg := newPage()
+		drawFrame(pg, opts, p+1, totalPages)
+		y := opts.Paper.Height - margin - headerHeight - 12
+		end := min((p+1)*linesPerPage, len(manifest))
+		for _, line := range manifest[p*linesPerPage : end] {
+			pg.text(margin, y, line.size, line.text)
+			y -= 12
+		}
+		if err := doc.addPage(pg); err != nil {
+			return err
+		}
+	}
+
+	cellW := (opts.Paper.Width - 2*margin) / float64(opts.Columns)
+	cellH := (opts.Paper.Height - 2*margin - headerHeight - footerHeight) / float64(opts.Rows)
+	side := min(cellW, cellH-2*captionSize-6) - 8
+	top := opts.Paper.Height - margin - headerHeight
+
+	for p := 0; p < gridPages; p++ {
+		pg := newPage()
+		drawFrame(pg, opts, manifestPages+p+1, totalPages)
+
+		end := min((p+1)*perPage, len(ordered))
+		for slot, chunk := range ordered[p*perPage : end] {
+			col, row := slot%opts.Columns, slot/opts.Columns
+			x := margin + float64(col)*cellW + (cellW-side)/2
+			y := top - float64(row)*cellH - side - 4
+
+			matrix, err := qr.EncodeMatrix(chunk)
+			if err != nil {
+				return fmt.Errorf("failed to encode chunk %s: %w", chunk.ID, err)
+			}
+			img, err := doc.addMatrix(matrix)
+			if err != nil {
+				return err
+			}
+			pg.image(img, x, y, side, side)
+			pg.text(x+4, y-captionSize-1, captionSize, chunkCaption(chunk))
+		}
+
+		if err := doc.addPage(pg); err != nil {
+			return err
+		}
+	}
+
+	return doc.writeTo(w)
+}
+
+// drawFrame adds the page header and footer
+func drawFrame(pg *page, opts Options, number, total int) {
+	width, height := opts.Paper.Width, opts.Paper.Height
+	title := "Pixelog paper archive"
+	if opts.Title != "" {
+		title += ": " + truncate(opts.Title, 60)
+	}
+	pg.text(margin, height-margin-12, 11, title)
+	pg.textRight(width-margin, height-margin-12, 9, fmt.Sprintf("Page %d of %d", number, total))
+	pg.text(margin, height-margin-24, 7, "Printed "+opts.PrintedAt.UTC().Format("2006-01-02 15:04 MST"))
+	pg.line(margin, height-margin-headerHeight+4, width-margin, height-margin-headerHeight+4)
+
+	pg.line(margin, margin+footerHeight-6, width-margin, margin+footerHeight-6)
+	pg.text(margin, margin, 7, "Scan every page at 300 dpi or more, then run: pixe scan <folder of page images>")
+}
+
+func chunkCaption(chunk qr.Chunk) string {
+	name := truncate(chunk.SourceFile, 40)
+	switch chunk.Kind {
+	case qr.KindManifest:
+		return fmt.Sprintf("archive manifest %d/%d", chunk.Index+1, chunk.Total)
+	case qr.KindParity:
+		groups := qr.ParityGroups(chunk.Total, chunk.ParityGroup)
+		return fmt.Sprintf("%s  parity %d/%d", name, chunk.Index+1, groups)
+	case qr.KindSealed:
+		return fmt.Sprintf("sealed %s  %d/%d", chunk.ID, chunk.Index+1, chunk.Total)
+	}
+	return fmt.Sprintf("%s  chunk %d/%d", name, chunk.Index+1, chunk.Total)
+}
+
+// summarize groups ordered chunks by file and records the grid pages they
+// occupy, counted from the first grid page
+func summarize(ordered []qr.Chunk, perPage int) []*fileSummary {
+	var files []*fileSummary
+	byHash := make(map[string]*fileSummary)
+	for i, chunk := range ordered {
+		pageNumber := i/perPage + 1
+		if chunk.Kind == qr.KindManifest {
+			continue
+		}
+		key := chunk.Hash
+		if chunk.Kind == qr.KindSealed {
+			key = chunk.ID
+		}
+		f, ok := byHash[key]
+		if !ok {
+			f = &fileSummary{
+				name:      chunk.SourceFile,
+				mimeType:  chunk.MimeType,
+				hash:      chunk.Hash,
+				total:     chunk.Total,
+				encrypted: chunk.Encrypted,
+				sealed:    chunk.Kind == qr.KindSealed,
+				firstPage: pageNumber,
+			}
+			if f.sealed {
+				f.name = chunk.ID
+			}
+			byHash[key] = f
+			files = append(files, f)
+		}
+		if chunk.Kind == qr.KindParity {
+			f.parity++
+		}
+		f.lastPage = pageNumber
+	}
+	return files
+}
+
+type manifestLine struct {
+	size float64
+	text string
+}
+
+// manifestLines builds the manifest text; grid page numbers are shifted by
+// the number of manifest pages in front of them
+func manifestLines(files []*fileSummary, chunks, gridPages, manifestPages int, opts Options) []manifestLine {
+	lines := []manifestLine{
+		{14, "Manifest"},
+		{9, ""},
+		{9, fmt.Sprintf("%d files, %d QR codes on %d pages (%d x %d per page)", len(files), chunks, gridPages, opts.Columns, opts.Rows)},
+		{9, ""},
+	}
+
+	for _, f := range files {
+		if f.sealed {
+			lines = append(lines,
+				manifestLine{10, "Sealed archive " + f.name},
+				manifestLine{8, fmt.Sprintf("    %d encrypted frames; file names and sizes need the password", f.total)},
+				manifestLine{8, fmt.Sprintf("    QR pages %d-%d", f.firstPage+manifestPages, f.lastPage+manifestPages)},
+				manifestLine{8, "    Scan with: pixe scan <folder> -o <output dir> --password <password>"},
+				manifestLine{9, ""},
+			)
+			continue
+		}
+		encrypted := "no"
+		if f.encrypted {
+			encrypted = "yes"
+		}
+		lines = append(lines,
+			manifestLine{10, truncate(f.name, 80)},
+			manifestLine{8, fmt.Sprintf("    type %s, %d chunks, %d parity, encrypted %s", f.mimeType, f.total, f.parity, encrypted)},
+			manifestLine{8, "    sha256 " + f.hash},
+			manifestLine{8, fmt.Sprintf("    QR pages %d-%d", f.firstPage+manifestPages, f.lastPage+manifestPages)},
+			manifestLine{9, ""},
+		)
+	}
+
+	lines = append(lines,
+		manifestLine{10, "Recovery"},
+		manifestLine{8, "1. Scan or photograph every QR page (the manifest pages are not needed)."},
+		manifestLine{8, "2. Put the page images (PNG or JPEG) in one folder."},
+		manifestLine{8, "3. Run: pixe scan <folder> -o <output dir>"},
+		manifestLine{8, "Pages may be scanned in any order. Missing codes are reported by chunk number,"},
+		manifestLine{8, "and files printed with parity survive one lost code per parity group."},
+	)
+	return lines
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
@@ -0,0 +1,58 @@
+package paper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/video"
+)
+
+// pageExtensions are the scanned image formats that can be decoded
+var pageExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+}
+
+// PageImages lists the scanned page images in a directory, sorted by name
+func PageImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan directory: %w", err)
+	}
+
+	var pages []string
+	for _, entry := range entries {
+		if entry.IsDir() || !pageExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		pages = append(pages, filepath.Join(dir, entry.Name()))
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no PNG or JPEG page images found in %s", dir)
+	}
+
+	sort.Strings(pages)
+	return pages, nil
+}
+
+// Scan decodes every QR code on a folder of scanned pages and saves the
+// files it can rebuild into outputDir. Pages may be in any order; pages
+// without any code are listed by position in FailedFrames, and files with
+// lost codes are kept with zero-filled gaps. Sealed archives need a sealer.
+func Scan(dir, outputDir string, sealer qr.Sealer) (*video.ExtractReport, error) {
+	pages, err := PageImages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	scan := video.ScanImages(pages, 0)
+	if err := scan.Unseal(sealer); err != nil {
+		return nil, err
+	}
+	return video.RecoverScan(dir, scan, outputDir)
+}
@@ -0,0 +1,338 @@
+package qr
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	multiqr "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// enhanceStage is one preprocessing step tried when a frame fails to decode
+type enhanceStage struct {
+	name  string
+	apply func(*image.Gray) *image.Gray
+}
+
+// skip reports whether the stage is pointless for this frame
+func (s enhanceStage) skip(g *image.Gray) bool {
+	b := g.Bounds()
+	return strings.HasPrefix(s.name, "upscale") && (b.Dx() > maxUpscaleSide || b.Dy() > maxUpscaleSide)
+}
+
+// enhanceStages run in order, cheapest and most likely first. Each stage
+// starts from the plain grayscale frame so artifacts do not compound.
+var enhanceStages = []enhanceStage{
+	{"grayscale", func(g *image.Gray) *image.Gray { return g }},
+	{"adaptive-threshold", func(g *image.Gray) *image.Gray { return adaptiveThreshold(g, 25, 7) }},
+	{"sharpen", sharpen},
+	{"deblock", deblock},
+	{"deblock-sharpen-threshold", func(g *image.Gray) *image.Gray {
+		return adaptiveThreshold(sharpen(deblock(g)), 25, 7)
+	}},
+	{"upscale", func(g *image.Gray) *image.Gray { return upscale(g, 2) }},
+	{"upscale-threshold", func(g *image.Gray) *image.Gray { return adaptiveThreshold(upscale(deblock(g), 2), 41, 7) }},
+}
+
+// rotationAngles are tried last for tilted captures the detector misses
+var rotationAngles = []float64{-5, 5, -12, 12, -20, 20}
+
+// maxUpscaleSide stops upscaling frames that are already large
+const maxUpscaleSide = 1600
+
+// DecodeImage decodes a chunk from an image, retrying with image enhancement
+// when the clean pure-barcode fast path fails
+func DecodeImage(img image.Image) (*Chunk, error) {
+	text, err := DecodeText(img)
+	if err != nil {
+		return nil, err
+	}
+	return parseChunk(text)
+}
+
+// DecodeText returns the raw QR payload of an image. It first assumes a clean
+// synthetic frame, then falls back to detection with perspective correction
+// on a series of enhanced variants (thresholding, sharpening, de-blocking,
+// upscaling) and finally on rotated copies.
+func DecodeText(img image.Image) (string, error) {
+	if text, err := decodeBitmap(img, true); err == nil {
+		return text, nil
+	}
+
+	gray := toGray(img)
+	var lastErr error
+	for _, stage := range enhanceStages {
+		if stage.skip(gray) {
+			continue
+		}
+		text, err := decodeBitmap(stage.apply(gray), false)
+		if err == nil {
+			return text, nil
+		}
+		lastErr = err
+	}
+
+	base := deblock(gray)
+	for _, angle := range rotationAngles {
+		text, err := decodeBitmap(rotate(base, angle), false)
+		if err == nil {
+			return text, nil
+		}
+		lastErr = err
+	}
+
+	return "", fmt.Errorf("failed to decode QR code: %w", lastErr)
+}
+
+// DecodeAll finds every chunk symbol anywhere in an image, such as a camera
+// capture of a screen. Symbols whose payload is not a chunk are skipped.
+func DecodeAll(img image.Image) ([]Chunk, error) {
+	texts, err := DecodeAllText(img)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for _, text := range texts {
+		chunk, err := parseChunk(text)
+		if err != nil {
+			continue
+		}
+		chunks = append(chunks, *chunk)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("no chunk QR codes found")
+	}
+	return chunks, nil
+}
+
+// DecodeAllText returns the payloads of all QR symbols in an image, without
+// assuming a pure barcode. Enhancement stages are tried until one of them
+// yields at least one symbol.
+func DecodeAllText(img image.Image) ([]string, error) {
+	gray := toGray(img)
+	var lastErr error
+	for _, stage := range enhanceStages {
+		if stage.skip(gray) {
+			continue
+		}
+		texts, err := decodeMultiple(stage.apply(gray))
+		if err == nil && len(texts) > 0 {
+			return texts, nil
+		}
+		lastErr = err
+	}
+
+	// A single tilted symbol can still be found by the rotation fallback
+	text, err := DecodeText(img)
+	if err == nil {
+		return []string{text}, nil
+	}
+	if lastErr == nil {
+		lastErr = err
+	}
+	return nil, fmt.Errorf("failed to find QR codes: %w", lastErr)
+}
+
+func decodeMultiple(img image.Image) ([]string, error) {
+	source := gozxing.NewLuminanceSourceFromImage(img)
+	bmp, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bitmap: %w", err)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	results, err := multiqr.NewQRCodeMultiReader().DecodeMultiple(bmp, hints)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var texts []string
+	for _, result := range results {
+		text := result.GetText()
+		if !seen[text] {
+			seen[text] = true
+			texts = append(texts, text)
+		}
+	}
+	return texts, nil
+}
+
+// decodeBitmap runs the gozxing reader. Pure mode assumes an axis-aligned
+// symbol filling the image; otherwise the finder-pattern detector is used,
+// which also corrects rotation and perspective.
+func decodeBitmap(img image.Image, pure bool) (string, error) {
+	source := gozxing.NewLuminanceSourceFromImage(img)
+	bmp, err := gozxing.NewBinaryBitmap(gozxing.NewHybridBinarizer(source))
+	if err != nil {
+		return "", fmt.Errorf("failed to create bitmap: %w", err)
+	}
+
+	hints := make(map[gozxing.DecodeHintType]interface{})
+	if pure {
+		hints[gozxing.DecodeHintType_PURE_BARCODE] = true
+	} else {
+		hints[gozxing.DecodeHintType_TRY_HARDER] = true
+	}
+
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		return "", err
+	}
+	return result.GetText(), nil
+}
+
+func toGray(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok && g.Rect.Min == (image.Point{}) {
+		return g
+	}
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, b.Min, draw.Src)
+	return gray
+}
+
+// adaptiveThreshold binarizes each pixel against the mean of its window,
+// which copes with uneven lighting from screens and phone cameras
+func adaptiveThreshold(g *image.Gray, window, c int) *image.Gray {
+	b := g.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// Summed-area table for O(1) window means
+	integral := make([]int64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row int64
+		for x := 0; x < w; x++ {
+			row += int64(g.Pix[y*g.Stride+x])
+			integral[(y+1)*(w+1)+x+1] = integral[y*(w+1)+x+1] + row
+		}
+	}
+
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	half := window / 2
+	for y := 0; y < h; y++ {
+		y0, y1 := max(y-half, 0), min(y+half+1, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(x-half, 0), min(x+half+1, w)
+			sum := integral[y1*(w+1)+x1] - integral[y0*(w+1)+x1] - integral[y1*(w+1)+x0] + integral[y0*(w+1)+x0]
+			mean := sum / int64((x1-x0)*(y1-y0))
+			if int64(g.Pix[y*g.Stride+x]) < mean-int64(c) {
+				out.Pix[y*out.Stride+x] = 0
+			} else {
+				out.Pix[y*out.Stride+x] = 255
+			}
+		}
+	}
+	return out
+}
+
+// sharpen applies a 3x3 unsharp kernel to restore module edges blurred by
+// scaling and compression
+func sharpen(g *image.Gray) *image.Gray {
+	b := g.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	at := func(x, y int) int {
+		x = min(max(x, 0), w-1)
+		y = min(max(y, 0), h-1)
+		return int(g.Pix[y*g.Stride+x])
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := 5*at(x, y) - at(x-1, y) - at(x+1, y) - at(x, y-1) - at(x, y+1)
+			out.Pix[y*out.Stride+x] = uint8(min(max(v, 0), 255))
+		}
+	}
+	return out
+}
+
+// deblock removes H.264 macroblock edges and ringing with a 3x3 median filter
+func deblock(g *image.Gray) *image.Gray {
+	b := g.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	var window [9]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			n := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					sx := min(max(x+dx, 0), w-1)
+					sy := min(max(y+dy, 0), h-1)
+					window[n] = int(g.Pix[sy*g.Stride+sx])
+					n++
+				}
+			}
+			sort.Ints(window[:])
+			out.Pix[y*out.Stride+x] = uint8(window[4])
+		}
+	}
+	return out
+}
+
+// upscale enlarges the image with bilinear interpolation so small or
+// downsampled symbols have enough pixels per module
+func upscale(g *image.Gray, factor int) *image.Gray {
+	b := g.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := image.NewGray(image.Rect(0, 0, w*factor, h*factor))
+	for y := 0; y < h*factor; y++ {
+		for x := 0; x < w*factor; x++ {
+			sx := (float64(x)+0.5)/float64(factor) - 0.5
+			sy := (float64(y)+0.5)/float64(factor) - 0.5
+			out.Pix[y*out.Stride+x] = bilinear(g, sx, sy, 255)
+		}
+	}
+	return out
+}
+
+// rotate turns the image by degrees around its centre, filling with white
+func rotate(g *image.Gray, degrees float64) *image.Gray {
+	b := g.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rad := degrees * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	// Grow the canvas so corners are not clipped
+	nw := int(math.Ceil(math.Abs(float64(w)*cos) + math.Abs(float64(h)*sin)))
+	nh := int(math.Ceil(math.Abs(float64(w)*sin) + math.Abs(float64(h)*cos)))
+	out := image.NewGray(image.Rect(0, 0, nw, nh))
+
+	cx, cy := float64(w)/2, float64(h)/2
+	ncx, ncy := float64(nw)/2, float64(nh)/2
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			dx, dy := float64(x)-ncx, float64(y)-ncy
+			sx := cos*dx + sin*dy + cx
+			sy := -sin*dx + cos*dy + cy
+			out.Pix[y*out.Stride+x] = bilinear(g, sx, sy, 255)
+		}
+	}
+	return out
+}
+
+func bilinear(g *image.Gray, x, y float64, fill uint8) uint8 {
+	b := g.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if x < -0.5 || y < -0.5 || x > float64(w)-0.5 || y > float64(h)-0.5 {
+		return fill
+	}
+	x = math.Min(math.Max(x, 0), float64(w-1))
+	y = math.Min(math.Max(y, 0), float64(h-1))
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	p := func(px, py int) float64 { return float64(g.Pix[py*g.Stride+px]) }
+	top := p(x0, y0)*(1-fx) + p(x1, y0)*fx
+	bottom := p(x0, y1)*(1-fx) + p(x1, y1)*fx
+	return uint8(top*(1-fy) + bottom*fy + 0.5)
+}
@@ -0,0 +1,96 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+func encodeTestSymbol(t *testing.T, text string, size int) *image.Gray {
+	t.Helper()
+	matrix, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, size, size, nil)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	gray := image.NewGray(matrix.Bounds())
+	draw.Draw(gray, gray.Bounds(), matrix, image.Point{}, draw.Src)
+	return gray
+}
+
+func TestDecodeTextDegradedFrame(t *testing.T) {
+	text := strings.Repeat("pixelog-", 40)
+	symbol := encodeTestSymbol(t, text, 360)
+
+	// Simulate a tilted, low-quality re-encode on a larger canvas
+	canvas := image.NewGray(image.Rect(0, 0, 520, 480))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	tilted := rotate(symbol, 9)
+	draw.Draw(canvas, tilted.Bounds().Add(image.Pt(20, 10)), tilted, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: 35}); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	degraded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+
+	if _, err := decodeBitmap(degraded, true); err == nil {
+		t.Skip("pure-barcode decoding already succeeds on this frame")
+	}
+
+	got, err := DecodeText(degraded)
+	if err != nil {
+		t.Fatalf("enhanced decoding failed: %v", err)
+	}
+	if got != text {
+		t.Errorf("decoded text mismatch")
+	}
+}
+
+func TestDecodeAllFindsSeveralSymbols(t *testing.T) {
+	// Two chunk symbols side by side, as when a capture spans a frame change
+	canvas := image.NewGray(image.Rect(0, 0, 760, 400))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, text := range []string{
+		`{"id":"a_0","index":0,"total":2,"data":"aGVsbG8g","hash":"a"}`,
+		`{"id":"a_1","index":1,"total":2,"data":"d29ybGQ=","hash":"a"}`,
+	} {
+		symbol := encodeTestSymbol(t, text, 340)
+		draw.Draw(canvas, symbol.Bounds().Add(image.Pt(20+i*380, 30)), symbol, image.Point{}, draw.Src)
+	}
+
+	chunks, err := DecodeAll(canvas)
+	if err != nil {
+		t.Fatalf("failed to decode symbols: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	if chunks[0].Index == chunks[1].Index {
+		t.Errorf("expected distinct chunk indices, got %d twice", chunks[0].Index)
+	}
+}
+
+func TestGenerateTextRoundTrip(t *testing.T) {
+	generator, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "pixelog-share:1:0123456789abcdef:0011223344556677:3:5:2:" + strings.Repeat("QUJD", 11)
+	path, err := generator.GenerateText(text, "share-2.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeTextFile(path)
+	if err != nil || decoded != text {
+		t.Fatalf("decoded %q, %v", decoded, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"image/png"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/makiuchi-d/gozxing"
@@ -19,15 +20,27 @@ type Generator struct {
 }
 
 type Chunk struct {
-	ID         string    `json:"id"`
-	Index      int       `json:"index"`
-	Total      int       `json:"total"`
-	Data       string    `json:"data"`
-	SourceFile string    `json:"source_file"`
-	MimeType   string    `json:"mime_type"`
-	Hash       string    `json:"hash"`
-	Encrypted  bool      `json:"encrypted"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind,omitempty"` // "" for file data, see KindParity
+	Index       int       `json:"index"`
+	Total       int       `json:"total"`
+	ParityGroup int       `json:"parity_group,omitempty"` // Group size, parity chunks only
+	Data        string    `json:"data"`
+	SourceFile  string    `json:"source_file"`
+	MimeType    string    `json:"mime_type"`
+	Hash        string    `json:"hash"`
+	Encrypted   bool      `json:"encrypted"`
+	Cipher      string    `json:"cipher,omitempty"` // Chunked encryption header, see crypto.FileCipher
+	CreatedAt   time.Time `json:"created_at"`
+	Leaf        int       `json:"leaf,omitempty"`  // Position in the archive Merkle tree
+	Proof       string    `json:"proof,omitempty"` // Base64 Merkle inclusion proof, see merkle.go
+}
+
+// RawText reports whether the chunk data is the file's text as-is rather
+// than base64. Encrypted payloads are always base64 since ciphertext is not
+// valid UTF-8 and would not survive JSON encoding.
+func (c *Chunk) RawText() bool {
+	return strings.HasPrefix(c.MimeType, "text/") && !c.Encrypted
 }
 
 func New(outputDir string) (*Generator, error) {
@@ -110,6 +123,49 @@ func (g *Generator) GenerateFrame(chunk Chunk, frameNumber int) (string, error)
 	return framePath, nil
 }
 
+// GenerateText writes a standalone QR code holding text, such as a key
+// share, to name in the output directory. It uses the highest error
+// correction level since such codes are small and often printed.
+func (g *Generator) GenerateText(text, name string) (string, error) {
+	writer := qrcode.NewQRCodeWriter()
+	hints := make(map[gozxing.EncodeHintType]interface{})
+	hints[gozxing.EncodeHintType_ERROR_CORRECTION] = "H"
+	bitMatrix, err := writer.Encode(text, gozxing.BarcodeFormat_QR_CODE, 512, 512, hints)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	path := filepath.Join(g.outputDir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, bitMatrix); err != nil {
+		return "", fmt.Errorf("failed to save QR image %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// EncodeMatrix encodes a chunk as a QR symbol with one pixel per module,
+// including the quiet zone, for callers that scale it themselves
+func EncodeMatrix(chunk Chunk) (*gozxing.BitMatrix, error) {
+	chunkData, err := json.Marshal(chunk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize chunk: %w", err)
+	}
+
+	writer := qrcode.NewQRCodeWriter()
+	hints := make(map[gozxing.EncodeHintType]interface{})
+	hints[gozxing.EncodeHintType_ERROR_CORRECTION] = "M"
+	bitMatrix, err := writer.Encode(string(chunkData), gozxing.BarcodeFormat_QR_CODE, 0, 0, hints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return bitMatrix, nil
+}
+
 func DecodeFrame(imagePath string) (*Chunk, error) {
 	// Use gozxing for pure Go QR decoding
 	file, err := os.Open(imagePath)
@@ -123,21 +179,30 @@ func DecodeFrame(imagePath string) (*Chunk, error) {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	// Clean frames decode on the pure-barcode fast path; degraded ones
+	// (re-encoded uploads, screen recordings) go through enhancement
+	return DecodeImage(img)
+}
+
+// DecodeTextFile returns the raw QR payload of an image file, such as a
+// photographed or scanned key share
+func DecodeTextFile(imagePath string) (string, error) {
+	file, err := os.Open(imagePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create bitmap: %w", err)
+		return "", fmt.Errorf("failed to open image: %w", err)
 	}
+	defer file.Close()
 
-	reader := qrcode.NewQRCodeReader()
-	hints := make(map[gozxing.DecodeHintType]interface{})
-	hints[gozxing.DecodeHintType_PURE_BARCODE] = true
-	result, err := reader.Decode(bmp, hints)
+	img, _, err := image.Decode(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode QR code: %w", err)
+		return "", fmt.Errorf("failed to decode image: %w", err)
 	}
+	return DecodeText(img)
+}
 
+func parseChunk(text string) (*Chunk, error) {
 	var chunk Chunk
-	if err := json.Unmarshal([]byte(result.GetText()), &chunk); err != nil {
+	if err := json.Unmarshal([]byte(text), &chunk); err != nil {
 		return nil, fmt.Errorf("failed to parse QR data: %w", err)
 	}
 
@@ -0,0 +1,346 @@
+package qr
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KindManifest marks a chunk carrying part of the archive manifest
+const KindManifest = "manifest"
+
+// ManifestVersion is the current manifest format version
+const ManifestVersion = 1
+
+// Manifest lists every file stored in an archive. It is written as its own
+// chunks at the start of the video so readers can check what should be there.
+type Manifest struct {
+	Version   int            `json:"version"`
+	ArchiveID string         `json:"archive_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []ManifestFile `json:"files"`
+
+	// MerkleRoot is the hex root of the tree over all data and parity
+	// chunks, which carry their own inclusion proofs
+	MerkleRoot   string `json:"merkle_root,omitempty"`
+	MerkleLeaves int    `json:"merkle_leaves,omitempty"`
+
+	// Recipients hold the archive data key wrapped for each password and
+	// public key that can open the archive
+	Recipients []Recipient `json:"recipients,omitempty"`
+
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// Recipient is the archive data key wrapped for one password or public key
+type Recipient struct {
+	Type       string `json:"type"`                // "password" or "x25519"
+	KeyID      string `json:"key_id,omitempty"`    // Fingerprint of the recipient public key
+	Ephemeral  string `json:"ephemeral,omitempty"` // Base64 ephemeral public key of the key agreement
+	Salt       string `json:"salt,omitempty"`      // Base64 KDF parameters and salt of a password entry
+	WrappedKey string `json:"wrapped_key"`         // Base64 encrypted data key
+}
+
+// Signature is an Ed25519 signature over the manifest without its signature
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"` // Base64, identifies the signer but is not a trust anchor
+	Value     string `json:"value"`
+}
+
+// ManifestFile describes one stored file. Hash and Size refer to the stored
+// bytes, i.e. the ciphertext for encrypted files.
+type ManifestFile struct {
+	Name      string `json:"name"`
+	MimeType  string `json:"mime_type"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+	Chunks    int    `json:"chunks"`
+	Parity    int    `json:"parity,omitempty"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+
+	// ChunkHashes and ParityHashes hold ChunkDigest values by chunk index,
+	// so every frame can be checked on its own against a signed manifest
+	ChunkHashes  []string `json:"chunk_hashes,omitempty"`
+	ParityHashes []string `json:"parity_hashes,omitempty"`
+}
+
+// ChunkDigest is the SHA-256 of a chunk's data, as listed in the manifest
+func ChunkDigest(chunk Chunk) string {
+	sum := sha256.Sum256([]byte(chunk.Data))
+	return fmt.Sprintf("%x", sum)
+}
+
+// Expected returns the manifest digest for a data or parity chunk of this
+// file, or false if the manifest has no digest for that index
+func (f ManifestFile) Expected(chunk Chunk) (string, bool) {
+	hashes := f.ChunkHashes
+	if chunk.Kind == KindParity {
+		hashes = f.ParityHashes
+	}
+	if chunk.Index < 0 || chunk.Index >= len(hashes) {
+		return "", false
+	}
+	return hashes[chunk.Index], true
+}
+
+// NewManifest describes the files in a complete, ordered list of chunks.
+// The archive ID is derived from the file hashes so identical content
+// always yields the same ID.
+func NewManifest(chunks []Chunk, createdAt time.Time) *Manifest {
+	manifest := &Manifest{Version: ManifestVersion, CreatedAt: createdAt}
+	byHash := make(map[string]int)
+	encodedLen := make(map[string]int)
+
+	for _, chunk := range chunks {
+		if chunk.Kind == KindManifest {
+			continue
+		}
+		i, ok := byHash[chunk.Hash]
+		if !ok {
+			i = len(manifest.Files)
+			byHash[chunk.Hash] = i
+			manifest.Files = append(manifest.Files, ManifestFile{
+				Name:        chunk.SourceFile,
+				MimeType:    chunk.MimeType,
+				Hash:        chunk.Hash,
+				Chunks:      chunk.Total,
+				Encrypted:   chunk.Encrypted,
+				ChunkHashes: make([]string, chunk.Total),
+			})
+		}
+		f := &manifest.Files[i]
+		if chunk.Kind == KindParity {
+			f.Parity++
+			if chunk.Index >= len(f.ParityHashes) {
+				f.ParityHashes = append(f.ParityHashes, make([]string, chunk.Index+1-len(f.ParityHashes))...)
+			}
+			f.ParityHashes[chunk.Index] = ChunkDigest(chunk)
+			continue
+		}
+		if chunk.Index >= 0 && chunk.Index < len(f.ChunkHashes) {
+			f.ChunkHashes[chunk.Index] = ChunkDigest(chunk)
+		}
+		encodedLen[chunk.Hash] += len(chunk.Data)
+		if chunk.Index == chunk.Total-1 {
+			manifest.Files[i].Size = payloadSize(chunk, encodedLen[chunk.Hash])
+		}
+	}
+
+	hashes := make([]string, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		hashes = append(hashes, f.Hash)
+	}
+	sort.Strings(hashes)
+	sum := sha256.Sum256([]byte(strings.Join(hashes, "\n")))
+	manifest.ArchiveID = fmt.Sprintf("%x", sum[:8])
+
+	return manifest
+}
+
+// payloadSize computes the decoded size of a file from its encoded length,
+// using the last chunk to account for base64 padding
+func payloadSize(last Chunk, encodedLen int) int64 {
+	if last.RawText() {
+		return int64(encodedLen)
+	}
+	padding := len(last.Data) - len(strings.TrimRight(last.Data, "="))
+	return int64(encodedLen/4*3 - padding)
+}
+
+// CheckChunk authenticates a single data or parity chunk against the
+// manifest using its listed digest and, if present, its Merkle proof
+func (m *Manifest) CheckChunk(chunk Chunk) error {
+	if entry, ok := m.File(chunk.Hash); ok {
+		if want, ok := entry.Expected(chunk); ok && want != ChunkDigest(chunk) {
+			return fmt.Errorf("chunk %d does not match the manifest chunk hash", chunk.Index)
+		}
+	} else if m.MerkleRoot == "" {
+		return fmt.Errorf("chunk belongs to a file not listed in the manifest")
+	}
+	if m.MerkleRoot != "" {
+		if err := VerifyMerkleProof(chunk, m.MerkleRoot, m.MerkleLeaves); err != nil {
+			return fmt.Errorf("chunk %d: %w", chunk.Index, err)
+		}
+	}
+	return nil
+}
+
+// signedBytes is the canonical encoding covered by the signature: the
+// manifest JSON with the signature itself left out
+func (m *Manifest) signedBytes() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = nil
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	return data, nil
+}
+
+// Sign attaches an Ed25519 signature covering every file and chunk hash
+func (m *Manifest) Sign(priv ed25519.PrivateKey, keyID string) error {
+	data, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	pub := priv.Public().(ed25519.PublicKey)
+	m.Signature = &Signature{
+		Algorithm: "ed25519",
+		KeyID:     keyID,
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)),
+	}
+	return nil
+}
+
+// VerifySignature checks the signature against a trusted public key. With a
+// nil key the embedded public key is used, which only proves the manifest
+// was not altered after signing, not who signed it.
+func (m *Manifest) VerifySignature(pub ed25519.PublicKey) error {
+	if m.Signature == nil {
+		return fmt.Errorf("manifest is not signed")
+	}
+	if m.Signature.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm %q", m.Signature.Algorithm)
+	}
+
+	embedded, err := base64.StdEncoding.DecodeString(m.Signature.PublicKey)
+	if err != nil || len(embedded) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid embedded public key")
+	}
+	if pub == nil {
+		pub = embedded
+	} else if !pub.Equal(ed25519.PublicKey(embedded)) {
+		return fmt.Errorf("archive was signed by key %s, not the given key", m.Signature.KeyID)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(m.Signature.Value)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	data, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return fmt.Errorf("signature does not match manifest contents")
+	}
+	return nil
+}
+
+// File looks up a file entry by hash
+func (m *Manifest) File(hash string) (ManifestFile, bool) {
+	for _, f := range m.Files {
+		if f.Hash == hash {
+			return f, true
+		}
+	}
+	return ManifestFile{}, false
+}
+
+// Chunks splits the manifest into chunks of at most chunkSize data
+// characters. The JSON is base64 encoded so its size is predictable.
+func (m *Manifest) Chunks(chunkSize int) ([]Chunk, error) {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(raw)
+	sum := sha256.Sum256(raw)
+	hash := fmt.Sprintf("%x", sum)
+
+	chunkSize -= chunkSize % 4
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size too small for manifest")
+	}
+	total := (len(encoded) + chunkSize - 1) / chunkSize
+
+	var chunks []Chunk
+	for i := 0; i < len(encoded); i += chunkSize {
+		end := min(i+chunkSize, len(encoded))
+		chunks = append(chunks, Chunk{
+			ID:        fmt.Sprintf("manifest_%s_%d", m.ArchiveID, len(chunks)),
+			Kind:      KindManifest,
+			Index:     len(chunks),
+			Total:     total,
+			Data:      encoded[i:end],
+			MimeType:  "application/json",
+			Hash:      hash,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	return chunks, nil
+}
+
+// PaddedChunks splits the manifest over exactly frames chunks of at most
+// chunkSize characters, so a rewritten manifest leaves the frame numbers of
+// the chunks after it unchanged. A manifest that has outgrown frames is
+// split as by Chunks instead, into more chunks.
+func (m *Manifest) PaddedChunks(chunkSize, frames int) ([]Chunk, error) {
+	chunks, err := m.Chunks(chunkSize)
+	if err != nil || len(chunks) >= frames {
+		return chunks, err
+	}
+
+	var encoded strings.Builder
+	for _, chunk := range chunks {
+		encoded.WriteString(chunk.Data)
+	}
+	data := encoded.String()
+	size := (len(data)/4 + frames - 1) / frames * 4
+
+	padded := make([]Chunk, frames)
+	for i := range padded {
+		start, end := min(i*size, len(data)), min((i+1)*size, len(data))
+		padded[i] = chunks[0]
+		padded[i].ID = fmt.Sprintf("manifest_%s_%d", m.ArchiveID, i)
+		padded[i].Index = i
+		padded[i].Total = frames
+		padded[i].Data = data[start:end]
+	}
+	return padded, nil
+}
+
+// ParseManifest rebuilds a manifest from its chunks keyed by index and
+// checks it against the hash they carry
+func ParseManifest(chunks map[int]Chunk) (*Manifest, error) {
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("no manifest chunks")
+	}
+
+	var first Chunk
+	for _, chunk := range chunks {
+		first = chunk
+		break
+	}
+
+	var encoded strings.Builder
+	for i := 0; i < first.Total; i++ {
+		chunk, ok := chunks[i]
+		if !ok {
+			return nil, fmt.Errorf("manifest chunk %d of %d missing", i, first.Total)
+		}
+		encoded.WriteString(chunk.Data)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if sum := sha256.Sum256(raw); fmt.Sprintf("%x", sum) != first.Hash {
+		return nil, fmt.Errorf("manifest hash mismatch")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &manifest, nil
+}
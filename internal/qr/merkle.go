@@ -0,0 +1,168 @@
+package qr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+)
+
+// The archive Merkle tree follows RFC 9162: leaves and interior nodes are
+// hashed with distinct prefixes and an unbalanced tree splits at the largest
+// power of two, so proofs need only the leaf index and tree size.
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash hashes a data or parity chunk as a Merkle leaf. It binds the
+// file, kind and position of the chunk, not just its data, so a valid chunk
+// cannot be replayed at another index.
+func LeafHash(chunk Chunk) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write([]byte(chunk.Hash))
+	h.Write([]byte{0})
+	h.Write([]byte(chunk.Kind))
+	h.Write([]byte{0})
+	var pos [16]byte
+	binary.BigEndian.PutUint64(pos[:8], uint64(chunk.Index))
+	binary.BigEndian.PutUint64(pos[8:], uint64(chunk.Total))
+	h.Write(pos[:])
+	h.Write([]byte(chunk.Data))
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// BuildMerkleTree computes the root over the leaves and every leaf's
+// inclusion proof, listed from the bottom of the tree up
+func BuildMerkleTree(leaves [][]byte) ([]byte, [][][]byte) {
+	if len(leaves) == 0 {
+		return nil, nil
+	}
+	proofs := make([][][]byte, len(leaves))
+	var build func(lo, hi int) []byte
+	build = func(lo, hi int) []byte {
+		if hi-lo == 1 {
+			return leaves[lo]
+		}
+		k := splitPoint(hi - lo)
+		left := build(lo, lo+k)
+		right := build(lo+k, hi)
+		for i := lo; i < lo+k; i++ {
+			proofs[i] = append(proofs[i], right)
+		}
+		for i := lo + k; i < hi; i++ {
+			proofs[i] = append(proofs[i], left)
+		}
+		return nodeHash(left, right)
+	}
+	return build(0, len(leaves)), proofs
+}
+
+// splitPoint is the largest power of two smaller than n
+func splitPoint(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// MerkleDepth is the length of the longest proof in a tree of n leaves
+func MerkleDepth(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return bits.Len(uint(n - 1))
+}
+
+// AttachMerkleProofs builds the tree over the data and parity chunks, in
+// order, stores each chunk's leaf index and proof, and returns the root.
+// Manifest chunks are not part of the tree since the manifest holds the root.
+func AttachMerkleProofs(chunks []Chunk) (string, int) {
+	var leaves [][]byte
+	var positions []int
+	for i := range chunks {
+		if chunks[i].Kind == KindManifest {
+			continue
+		}
+		leaves = append(leaves, LeafHash(chunks[i]))
+		positions = append(positions, i)
+	}
+	root, proofs := BuildMerkleTree(leaves)
+	for leaf, i := range positions {
+		chunks[i].Leaf = leaf
+		chunks[i].Proof = encodeProof(proofs[leaf])
+	}
+	return hex.EncodeToString(root), len(leaves)
+}
+
+// VerifyMerkleProof checks that a chunk is leaf number chunk.Leaf of the
+// tree with the given hex root and size, using the proof the chunk carries
+func VerifyMerkleProof(chunk Chunk, root string, size int) error {
+	want, err := hex.DecodeString(root)
+	if err != nil {
+		return fmt.Errorf("invalid Merkle root: %w", err)
+	}
+	proof, err := decodeProof(chunk.Proof)
+	if err != nil {
+		return err
+	}
+	if chunk.Leaf < 0 || chunk.Leaf >= size {
+		return fmt.Errorf("leaf index %d outside tree of %d leaves", chunk.Leaf, size)
+	}
+
+	// RFC 9162 section 2.1.3.2
+	fn, sn := chunk.Leaf, size-1
+	r := LeafHash(chunk)
+	for _, p := range proof {
+		if sn == 0 {
+			return fmt.Errorf("Merkle proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, want) {
+		return fmt.Errorf("chunk is not part of the archive Merkle tree")
+	}
+	return nil
+}
+
+// ProofLength is the encoded size of a proof with the given depth, for
+// reserving room in a frame
+func ProofLength(depth int) int {
+	return base64.StdEncoding.EncodedLen(depth * sha256.Size)
+}
+
+func encodeProof(proof [][]byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Join(proof, nil))
+}
+
+func decodeProof(encoded string) ([][]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw)%sha256.Size != 0 {
+		return nil, fmt.Errorf("malformed Merkle proof")
+	}
+	proof := make([][]byte, 0, len(raw)/sha256.Size)
+	for i := 0; i < len(raw); i += sha256.Size {
+		proof = append(proof, raw[i:i+sha256.Size])
+	}
+	return proof, nil
+}
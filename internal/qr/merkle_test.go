@@ -0,0 +1,82 @@
+package qr
+
+import (
+	"fmt"
+	"testing"
+)
+
+func merkleTestChunks(n int) []Chunk {
+	chunks := []Chunk{{Kind: KindManifest, Index: 0, Total: 1, Data: "manifest"}}
+	for i := 0; i < n; i++ {
+		chunks = append(chunks, Chunk{Index: i, Total: n, Hash: "filehash", Data: fmt.Sprintf("data-%d", i)})
+	}
+	return chunks
+}
+
+func TestMerkleProofsVerifyForEveryTreeSize(t *testing.T) {
+	for n := 1; n <= 33; n++ {
+		chunks := merkleTestChunks(n)
+		root, leaves := AttachMerkleProofs(chunks)
+		if leaves != n {
+			t.Fatalf("n=%d: got %d leaves", n, leaves)
+		}
+		if chunks[0].Proof != "" {
+			t.Fatalf("n=%d: manifest chunk was given a proof", n)
+		}
+		for _, chunk := range chunks[1:] {
+			if err := VerifyMerkleProof(chunk, root, leaves); err != nil {
+				t.Fatalf("n=%d leaf %d: %v", n, chunk.Leaf, err)
+			}
+			if len(chunk.Proof) > ProofLength(MerkleDepth(n)) {
+				t.Fatalf("n=%d: proof longer than reserved", n)
+			}
+		}
+	}
+}
+
+func TestMerkleProofRejectsTampering(t *testing.T) {
+	chunks := merkleTestChunks(7)
+	root, leaves := AttachMerkleProofs(chunks)
+
+	tampered := chunks[3]
+	tampered.Data = "forged"
+	if VerifyMerkleProof(tampered, root, leaves) == nil {
+		t.Error("tampered data verified")
+	}
+
+	moved := chunks[3]
+	moved.Index = 5
+	if VerifyMerkleProof(moved, root, leaves) == nil {
+		t.Error("chunk replayed at another index verified")
+	}
+
+	swapped := chunks[3]
+	swapped.Proof = chunks[4].Proof
+	if VerifyMerkleProof(swapped, root, leaves) == nil {
+		t.Error("chunk with another leaf's proof verified")
+	}
+
+	other, _ := AttachMerkleProofs(merkleTestChunks(8))
+	if VerifyMerkleProof(chunks[3], other, leaves) == nil {
+		t.Error("proof verified against another archive's root")
+	}
+}
+
+func TestManifestCheckChunk(t *testing.T) {
+	chunks := merkleTestChunks(4)[1:]
+	for i := range chunks {
+		chunks[i].SourceFile = "notes.txt"
+	}
+	root, leaves := AttachMerkleProofs(chunks)
+	manifest := NewManifest(chunks, chunks[0].CreatedAt)
+	manifest.MerkleRoot, manifest.MerkleLeaves = root, leaves
+
+	if err := manifest.CheckChunk(chunks[2]); err != nil {
+		t.Fatalf("valid chunk rejected: %v", err)
+	}
+	forged := chunks[2]
+	forged.Data = "forged"
+	if manifest.CheckChunk(forged) == nil {
+		t.Error("forged chunk accepted")
+	}
+}
@@ -0,0 +1,133 @@
+package qr
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// KindParity marks a chunk carrying XOR parity over a group of data chunks
+const KindParity = "parity"
+
+// IsData reports whether the chunk carries file data rather than parity
+func (c *Chunk) IsData() bool {
+	return c.Kind == ""
+}
+
+// ParityGroups returns how many parity chunks protect total data chunks
+func ParityGroups(total, groupSize int) int {
+	if groupSize <= 1 || total <= 0 {
+		return 0
+	}
+	return (total + groupSize - 1) / groupSize
+}
+
+// ParityMembers lists the data chunk indices covered by a parity group.
+// Groups are interleaved (g, g+n, g+2n, ...) so a burst of up to n
+// consecutive lost frames costs each group at most one chunk.
+func ParityMembers(total, groupSize, group int) []int {
+	groups := ParityGroups(total, groupSize)
+	var members []int
+	for i := group; i < total && groups > 0; i += groups {
+		members = append(members, i)
+	}
+	return members
+}
+
+// BuildParity creates the parity chunks for one file's data chunks, which
+// must be complete and ordered by index
+func BuildParity(chunks []Chunk, groupSize int) []Chunk {
+	if len(chunks) == 0 {
+		return nil
+	}
+	total := len(chunks)
+	groups := ParityGroups(total, groupSize)
+
+	var parity []Chunk
+	for g := 0; g < groups; g++ {
+		var acc []byte
+		for _, idx := range ParityMembers(total, groupSize, g) {
+			acc = xorInto(acc, parityFrame(chunks[idx].Data))
+		}
+
+		first := chunks[0]
+		parity = append(parity, Chunk{
+			ID:          fmt.Sprintf("%s_p%d", first.ID, g),
+			Kind:        KindParity,
+			Index:       g,
+			Total:       total,
+			ParityGroup: groupSize,
+			Data:        base64.StdEncoding.EncodeToString(acc),
+			SourceFile:  first.SourceFile,
+			MimeType:    first.MimeType,
+			Hash:        first.Hash,
+			Encrypted:   first.Encrypted,
+			Cipher:      first.Cipher,
+			CreatedAt:   first.CreatedAt,
+		})
+	}
+	return parity
+}
+
+// RecoverFromParity rebuilds the single missing member of a parity group.
+// present maps data chunk index to chunk; it returns false when the group
+// is already complete or lost more than one member.
+func RecoverFromParity(parity Chunk, present map[int]Chunk) (Chunk, bool) {
+	acc, err := base64.StdEncoding.DecodeString(parity.Data)
+	if err != nil {
+		return Chunk{}, false
+	}
+
+	missing := -1
+	for _, idx := range ParityMembers(parity.Total, parity.ParityGroup, parity.Index) {
+		chunk, ok := present[idx]
+		if !ok {
+			if missing >= 0 {
+				return Chunk{}, false
+			}
+			missing = idx
+			continue
+		}
+		acc = xorInto(acc, parityFrame(chunk.Data))
+	}
+	if missing < 0 || len(acc) < 4 {
+		return Chunk{}, false
+	}
+
+	size := int(binary.BigEndian.Uint32(acc))
+	if size > len(acc)-4 {
+		return Chunk{}, false
+	}
+
+	recovered := Chunk{
+		ID:         fmt.Sprintf("%s_%d", parity.Hash[:min(8, len(parity.Hash))], missing),
+		Index:      missing,
+		Total:      parity.Total,
+		Data:       string(acc[4 : 4+size]),
+		SourceFile: parity.SourceFile,
+		MimeType:   parity.MimeType,
+		Hash:       parity.Hash,
+		Encrypted:  parity.Encrypted,
+		Cipher:     parity.Cipher,
+		CreatedAt:  parity.CreatedAt,
+	}
+	return recovered, true
+}
+
+// parityFrame prefixes data with its length so recovery knows where it ends
+func parityFrame(data string) []byte {
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	return frame
+}
+
+func xorInto(acc, data []byte) []byte {
+	if len(data) > len(acc) {
+		acc = append(acc, make([]byte, len(data)-len(acc))...)
+	}
+	for i, b := range data {
+		acc[i] ^= b
+	}
+	return acc
+}
@@ -0,0 +1,27 @@
+// Package qrtest builds chunks for the tests of packages that read them
+package qrtest
+
+import (
+	"fmt"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+// Split cuts data into chunks of size characters the way the converter
+// does. Each chunk copies template and gets its Index, Total and Data set,
+// and an ID of template.ID and its index if template.ID is set.
+func Split(data string, size int, template qr.Chunk) []qr.Chunk {
+	total := (len(data) + size - 1) / size
+	chunks := make([]qr.Chunk, total)
+	for i := range chunks {
+		chunk := template
+		chunk.Index = i
+		chunk.Total = total
+		chunk.Data = data[i*size : min((i+1)*size, len(data))]
+		if template.ID != "" {
+			chunk.ID = fmt.Sprintf("%s_%d", template.ID, i)
+		}
+		chunks[i] = chunk
+	}
+	return chunks
+}
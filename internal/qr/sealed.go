@@ -0,0 +1,71 @@
+package qr
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// KindSealed marks a frame whose whole chunk is encrypted, see SealChunks
+const KindSealed = "sealed"
+
+// Sealer encrypts and authenticates frame payloads, see crypto.Envelope
+type Sealer interface {
+	Seal(plaintext, aad []byte) ([]byte, error)
+	Open(sealed, aad []byte) ([]byte, error)
+}
+
+// SealChunks wraps every chunk, manifest included, in an encrypted frame.
+// A sealed frame shows only a random archive ID and its position; file
+// names, types, sizes, hashes and timestamps are inside the ciphertext.
+func SealChunks(chunks []Chunk, sealer Sealer) ([]Chunk, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate archive id: %w", err)
+	}
+	archiveID := hex.EncodeToString(id)
+
+	sealed := make([]Chunk, len(chunks))
+	for i, chunk := range chunks {
+		inner, err := json.Marshal(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize chunk %d: %w", i, err)
+		}
+
+		frame := Chunk{ID: archiveID, Kind: KindSealed, Index: i, Total: len(chunks), Encrypted: true}
+		ciphertext, err := sealer.Seal(inner, sealedAAD(frame))
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal chunk %d: %w", i, err)
+		}
+		frame.Data = base64.StdEncoding.EncodeToString(ciphertext)
+		sealed[i] = frame
+	}
+	return sealed, nil
+}
+
+// OpenChunk decrypts a sealed frame back into the chunk it carries
+func OpenChunk(frame Chunk, sealer Sealer) (Chunk, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(frame.Data)
+	if err != nil {
+		return Chunk{}, fmt.Errorf("failed to decode sealed frame: %w", err)
+	}
+
+	inner, err := sealer.Open(ciphertext, sealedAAD(frame))
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	var chunk Chunk
+	if err := json.Unmarshal(inner, &chunk); err != nil {
+		return Chunk{}, fmt.Errorf("failed to parse sealed chunk: %w", err)
+	}
+	return chunk, nil
+}
+
+// sealedAAD binds a sealed frame to its archive and position so frames
+// cannot be moved between archives or reordered
+func sealedAAD(frame Chunk) []byte {
+	return []byte(fmt.Sprintf("pixelog-sealed\x00%s\x00%d\x00%d", frame.ID, frame.Index, frame.Total))
+}
@@ -2,232 +2,319 @@ package search
 
 import (
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
-	"io"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 
-	"github.com/ArqonAi/Pixelog/pkg/config"
+	"github.com/ArqonAi/Pixelog/internal/index"
 )
 
+// SearchService searches the indexes of the .pixe archives in a directory.
+// They are the indexes pixe index builds and pixe search reads, so an
+// archive indexed through the server is found by the CLI and the other way
+// round.
 type SearchService struct {
-	vectorStore VectorStore
-	embeddings  EmbeddingProvider
-	extractor   *MultiExtractor
-	config      *config.Config
+	indexes    *index.Indexer
+	archiveDir string
 }
 
-type IndexRequest struct {
-	ID       string            `json:"id"`
-	Content  string            `json:"content,omitempty"`
-	Reader   io.Reader         `json:"-"`
-	Filename string            `json:"filename"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
+// Document is one indexed passage of an archive
+type Document struct {
+	ID             string `json:"id"`      // Memory ID, frame number and offset, see DocumentID
+	Content        string `json:"content"` // Start of the passage
+	MemoryID       string `json:"memory_id"`
+	SourceFile     string `json:"source_file"`
+	FrameNumber    int    `json:"frame_number"`
+	ChunkIndex     int    `json:"chunk_index"`
+	Offset         int    `json:"offset"` // Byte offset of the passage in the source file
+	EmbeddingModel string `json:"embedding_model,omitempty"`
 }
 
-type SearchRequest struct {
-	Query     string  `json:"query"`
-	Limit     int     `json:"limit,omitempty"`
-	Threshold float32 `json:"threshold,omitempty"`
-	Filters   map[string]interface{} `json:"filters,omitempty"`
+type SearchResult struct {
+	Document   *Document `json:"document"`
+	Similarity float32   `json:"similarity"` // Cosine similarity in semantic mode, the score otherwise
+	Score      float32   `json:"score"`
 }
 
-func NewSearchService(cfg *config.Config) (*SearchService, error) {
-	// Initialize embedding provider
-	embeddings, err := NewEmbeddingProvider(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding provider: %w", err)
-	}
-
-	// Initialize vector store (in-memory for now)
-	vectorStore := NewInMemoryVectorStore()
+type SearchRequest struct {
+	Query     string                 `json:"query"`
+	Limit     int                    `json:"limit,omitempty"`
+	Threshold float32                `json:"threshold,omitempty"` // Minimum similarity, semantic mode only
+	Filters   map[string]interface{} `json:"filters,omitempty"`   // Document fields by JSON name, see matchesFilters
+	Mode      string                 `json:"mode,omitempty"`      // hybrid, semantic or lexical, semantic if empty
+	MemoryID  string                 `json:"memory_id,omitempty"` // Search this archive only
+}
 
-	// Initialize text extractor
-	extractor := NewMultiExtractor()
+var (
+	// ErrInvalidRequest is wrapped by errors in what was asked for
+	ErrInvalidRequest = errors.New("invalid search request")
+	// ErrNotFound is wrapped by errors for documents that are not indexed
+	ErrNotFound = errors.New("document not found")
+)
 
-	return &SearchService{
-		vectorStore: vectorStore,
-		embeddings:  embeddings,
-		extractor:   extractor,
-		config:      cfg,
-	}, nil
+// NewSearchService searches the archives in archiveDir through indexes
+func NewSearchService(indexes *index.Indexer, archiveDir string) *SearchService {
+	return &SearchService{indexes: indexes, archiveDir: archiveDir}
 }
 
-func (s *SearchService) IndexFile(ctx context.Context, req *IndexRequest) error {
-	var content string
-	var err error
+// IndexArchive builds the index of a .pixe file, replacing any it had
+func (s *SearchService) IndexArchive(ctx context.Context, pixeFile string) (*index.MemoryIndex, error) {
+	return s.indexes.BuildIndex(ctx, index.MemoryID(pixeFile), pixeFile)
+}
 
-	if req.Content != "" {
-		content = req.Content
-	} else if req.Reader != nil {
-		content, err = s.extractor.Extract(req.Reader, req.Filename)
-		if err != nil {
-			return fmt.Errorf("failed to extract text from file: %w", err)
-		}
-	} else {
-		return fmt.Errorf("either Content or Reader must be provided")
+// Search searches the index of every archive, or of req.MemoryID only, and
+// returns the best matches overall with the archives that have no index
+// yet. Scores of different archives are compared as they are.
+func (s *SearchService) Search(ctx context.Context, req *SearchRequest) ([]*SearchResult, []string, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, nil, fmt.Errorf("%w: search query cannot be empty", ErrInvalidRequest)
 	}
-
-	// Clean and prepare content
-	content = s.preprocessText(content)
-	if len(content) == 0 {
-		return fmt.Errorf("no extractable text content found")
+	modeName := req.Mode
+	if modeName == "" {
+		modeName = index.SearchSemantic.String()
 	}
-
-	// Generate embedding
-	embedding, err := s.embeddings.GenerateEmbedding(ctx, content)
+	mode, err := index.ParseSearchMode(modeName)
 	if err != nil {
-		return fmt.Errorf("failed to generate embedding: %w", err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
 	}
-
-	// Create document
-	doc := &Document{
-		ID:        req.ID,
-		Content:   content,
-		Embedding: embedding,
-		Metadata:  req.Metadata,
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
 	}
 
-	// Ensure metadata exists
-	if doc.Metadata == nil {
-		doc.Metadata = make(map[string]interface{})
+	archives, err := s.archives()
+	if err != nil {
+		return nil, nil, err
 	}
+	var results []*SearchResult
+	unindexed := []string{}
+	for _, memoryID := range archives {
+		if req.MemoryID != "" && memoryID != req.MemoryID {
+			continue
+		}
+		idx, err := s.indexes.LoadIndex(memoryID)
+		if err != nil {
+			unindexed = append(unindexed, memoryID)
+			continue
+		}
 
-	// Add file metadata
-	doc.Metadata["filename"] = req.Filename
-	doc.Metadata["content_length"] = len(content)
-	doc.Metadata["embedding_model"] = "text-embedding-3-small" // TODO: Make dynamic
-
-	// Store document
-	if err := s.vectorStore.AddDocument(ctx, doc); err != nil {
-		return fmt.Errorf("failed to store document: %w", err)
+		// Filtered out passages would take places in the ranking
+		k := limit
+		if len(req.Filters) > 0 {
+			k = idx.Len()
+		}
+		matches, err := s.indexes.SearchWith(ctx, idx, req.Query, k, mode)
+		if err != nil {
+			idx.Close()
+			return nil, nil, fmt.Errorf("failed to search %s: %w", memoryID, err)
+		}
+		for _, match := range matches {
+			if mode == index.SearchSemantic && match.Score < req.Threshold {
+				continue
+			}
+			doc := matchDocument(idx, match)
+			if matchesFilters(doc, req.Filters) {
+				results = append(results, &SearchResult{Document: doc, Similarity: match.Score, Score: match.Score})
+			}
+		}
+		idx.Close()
 	}
 
-	return nil
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, unindexed, nil
 }
 
-func (s *SearchService) Search(ctx context.Context, req *SearchRequest) ([]*SearchResult, error) {
-	if strings.TrimSpace(req.Query) == "" {
-		return nil, fmt.Errorf("search query cannot be empty")
+// GetSimilarDocuments finds the passages of every archive indexed with the
+// same model that are most similar to the document with id
+func (s *SearchService) GetSimilarDocuments(ctx context.Context, id string, limit int) ([]*SearchResult, error) {
+	memoryID, frameNumber, offset, err := parseDocumentID(id)
+	if err != nil {
+		return nil, err
 	}
-
-	// Set defaults
-	if req.Limit <= 0 {
-		req.Limit = 10
+	source, err := s.indexes.LoadIndex(memoryID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	defer source.Close()
+	var vector []float32
+	for i := 0; i < source.Len(); i++ {
+		if frame := source.Frame(i); frame.FrameNumber == frameNumber && frame.Offset == offset {
+			vector = source.Vector(i)
+			break
+		}
 	}
-	if req.Threshold <= 0 {
-		req.Threshold = 0.7 // 70% similarity threshold
+	if vector == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
 	}
-
-	// Generate query embedding
-	queryEmbedding, err := s.embeddings.GenerateEmbedding(ctx, req.Query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	if limit <= 0 {
+		limit = 5
 	}
 
-	// Search vector store
-	results, err := s.vectorStore.Search(ctx, queryEmbedding, req.Limit, req.Threshold)
+	archives, err := s.archives()
 	if err != nil {
-		return nil, fmt.Errorf("failed to search vector store: %w", err)
+		return nil, err
+	}
+	var results []*SearchResult
+	for _, other := range archives {
+		idx := source
+		if other != memoryID {
+			if idx, err = s.indexes.LoadIndex(other); err != nil {
+				continue
+			}
+		}
+		// Vectors of different models cannot be compared
+		if idx.EmbeddingModel == source.EmbeddingModel && idx.VectorDim == source.VectorDim {
+			matches, err := s.indexes.SearchVector(idx, vector, limit+1) // +1 for the document itself
+			if err != nil {
+				return nil, fmt.Errorf("failed to search %s: %w", other, err)
+			}
+			for _, match := range matches {
+				if doc := matchDocument(idx, match); doc.ID != id {
+					results = append(results, &SearchResult{Document: doc, Similarity: match.Score, Score: match.Score})
+				}
+			}
+		}
+		if idx != source {
+			idx.Close()
+		}
 	}
 
-	// TODO: Apply additional filters if provided
-	results = s.applyFilters(results, req.Filters)
-
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
 	return results, nil
 }
 
-func (s *SearchService) GetSimilarDocuments(ctx context.Context, documentID string, limit int) ([]*SearchResult, error) {
-	// Get the source document
-	doc, err := s.vectorStore.GetDocument(ctx, documentID)
+// ListDocuments pages through the passages of every indexed archive, in
+// archive name and then index order
+func (s *SearchService) ListDocuments(ctx context.Context, limit, offset int) ([]*Document, error) {
+	archives, err := s.archives()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get source document: %w", err)
+		return nil, err
 	}
+	docs := []*Document{}
+	for _, memoryID := range archives {
+		if limit > 0 && len(docs) == limit {
+			break
+		}
+		idx, err := s.indexes.LoadIndex(memoryID)
+		if err != nil {
+			continue
+		}
+		if offset >= idx.Len() {
+			offset -= idx.Len()
+			idx.Close()
+			continue
+		}
+		for i := max(offset, 0); i < idx.Len(); i++ {
+			if limit > 0 && len(docs) == limit {
+				break
+			}
+			docs = append(docs, frameDocument(idx, idx.Frame(i)))
+		}
+		offset = 0
+		idx.Close()
+	}
+	return docs, nil
+}
 
-	// Search using the document's embedding
-	results, err := s.vectorStore.Search(ctx, doc.Embedding, limit+1, 0.5) // +1 to exclude self
+// archives lists the memory IDs of the .pixe files in the archive
+// directory, in name order
+func (s *SearchService) archives() ([]string, error) {
+	entries, err := os.ReadDir(s.archiveDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find similar documents: %w", err)
+		return nil, fmt.Errorf("failed to read archives: %w", err)
 	}
-
-	// Remove the source document from results
-	filtered := make([]*SearchResult, 0, len(results))
-	for _, result := range results {
-		if result.Document.ID != documentID {
-			filtered = append(filtered, result)
+	var archives []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".pixe") {
+			archives = append(archives, index.MemoryID(entry.Name()))
 		}
 	}
-
-	// Limit results
-	if limit > 0 && len(filtered) > limit {
-		filtered = filtered[:limit]
-	}
-
-	return filtered, nil
-}
-
-func (s *SearchService) ListDocuments(ctx context.Context, limit, offset int) ([]*Document, error) {
-	return s.vectorStore.ListDocuments(ctx, limit, offset)
-}
-
-func (s *SearchService) DeleteDocument(ctx context.Context, id string) error {
-	return s.vectorStore.DeleteDocument(ctx, id)
+	return archives, nil
 }
 
-func (s *SearchService) IsFileSupported(filename string) bool {
-	return s.extractor.IsSupported(filename)
+// DocumentID names a passage by its archive, frame and offset, which stay
+// the same when the archive is indexed again
+func DocumentID(memoryID string, frameNumber, offset int) string {
+	return fmt.Sprintf("%s:%d:%d", memoryID, frameNumber, offset)
 }
 
-// Helper functions
-func (s *SearchService) preprocessText(text string) string {
-	// Basic text cleaning
-	text = strings.TrimSpace(text)
-	
-	// Remove excessive whitespace
-	lines := strings.Split(text, "\n")
-	var cleanLines []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if len(line) > 0 {
-			cleanLines = append(cleanLines, line)
-		}
+// parseDocumentID splits an ID made by DocumentID. Memory IDs may contain
+// colons themselves, so the numbers are taken from the end.
+func parseDocumentID(id string) (string, int, int, error) {
+	rest, offsetText, ok1 := cutLast(id, ":")
+	memoryID, frameText, ok2 := cutLast(rest, ":")
+	frameNumber, err1 := strconv.Atoi(frameText)
+	offset, err2 := strconv.Atoi(offsetText)
+	if !ok1 || !ok2 || memoryID == "" || err1 != nil || err2 != nil {
+		return "", 0, 0, fmt.Errorf("%w: malformed document ID %q", ErrInvalidRequest, id)
 	}
-	
-	return strings.Join(cleanLines, "\n")
+	return memoryID, frameNumber, offset, nil
 }
 
-func (s *SearchService) applyFilters(results []*SearchResult, filters map[string]interface{}) []*SearchResult {
-	if len(filters) == 0 {
-		return results
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
 	}
+	return s[:i], s[i+len(sep):], true
+}
 
-	var filtered []*SearchResult
-	for _, result := range results {
-		if s.matchesFilters(result.Document, filters) {
-			filtered = append(filtered, result)
-		}
+// frameDocument describes an indexed passage
+func frameDocument(idx *index.MemoryIndex, frame index.FrameIndex) *Document {
+	return &Document{
+		ID:             DocumentID(idx.MemoryID, frame.FrameNumber, frame.Offset),
+		Content:        frame.Preview,
+		MemoryID:       idx.MemoryID,
+		SourceFile:     frame.SourceFile,
+		FrameNumber:    frame.FrameNumber,
+		ChunkIndex:     frame.ChunkIndex,
+		Offset:         frame.Offset,
+		EmbeddingModel: idx.EmbeddingModel,
 	}
+}
 
-	return filtered
+// matchDocument describes the passage a search matched
+func matchDocument(idx *index.MemoryIndex, match index.SearchResult) *Document {
+	return frameDocument(idx, index.FrameIndex{
+		FrameNumber: match.FrameNumber,
+		ChunkIndex:  match.ChunkIndex,
+		SourceFile:  match.SourceFile,
+		Offset:      match.Offset,
+		Preview:     match.Preview,
+	})
 }
 
-func (s *SearchService) matchesFilters(doc *Document, filters map[string]interface{}) bool {
-	// TODO: Implement sophisticated filtering logic
-	// For now, simple string matching on metadata
+// matchesFilters reports whether every filter names a document field, by
+// its JSON name, with an equal value. Values are compared as text, so a
+// filter of 3 matches frame_number 3 whether it was sent as 3 or 3.0.
+func matchesFilters(doc *Document, filters map[string]interface{}) bool {
+	fields := map[string]interface{}{
+		"id":              doc.ID,
+		"memory_id":       doc.MemoryID,
+		"source_file":     doc.SourceFile,
+		"frame_number":    doc.FrameNumber,
+		"chunk_index":     doc.ChunkIndex,
+		"offset":          doc.Offset,
+		"embedding_model": doc.EmbeddingModel,
+	}
 	for key, value := range filters {
-		if metaValue, exists := doc.Metadata[key]; exists {
-			if fmt.Sprintf("%v", metaValue) != fmt.Sprintf("%v", value) {
-				return false
-			}
-		} else {
+		field, exists := fields[key]
+		if !exists || fmt.Sprintf("%v", field) != fmt.Sprintf("%v", value) {
 			return false
 		}
 	}
 	return true
 }
-
-func generateDocumentID(content string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(content))
-	return fmt.Sprintf("%x", hasher.Sum(nil))[:16]
-}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/embedding"
+	"github.com/ArqonAi/Pixelog/internal/index"
+)
+
+// testService indexes each archive's passages with the hashing embedder and
+// creates its .pixe file, and adds an archive that was never indexed
+func testService(t *testing.T, archives map[string][]string) *SearchService {
+	t.Helper()
+	dir := t.TempDir()
+	local := embedding.NewHashingEmbedder(64)
+	indexes, err := index.NewIndexer(filepath.Join(dir, "indexes"), local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for memoryID, texts := range archives {
+		saved := &index.MemoryIndex{MemoryID: memoryID, VectorDim: 64, EmbeddingModel: local.Model(), Version: 1}
+		for i, text := range texts {
+			vector, err := local.Embed(context.Background(), text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved.Frames = append(saved.Frames, index.FrameIndex{FrameNumber: i, Offset: i * 100, SourceFile: memoryID + ".txt", Embedding: vector, Preview: text})
+		}
+		saved.TotalFrames = len(texts)
+		if err := indexes.SaveIndex(saved); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, memoryID+".pixe"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pending.pixe"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewSearchService(indexes, dir)
+}
+
+func TestSearchService(t *testing.T) {
+	ctx := context.Background()
+	svc := testService(t, map[string][]string{
+		"keys": {
+			"Rotate the encryption keys with pixe rekey",
+			"Frames are decoded from QR codes in the video",
+		},
+		"notes": {
+			"Meeting notes about the quarterly budget",
+			"Rotating encryption keys every quarter",
+		},
+	})
+
+	results, unindexed, err := svc.Search(ctx, &SearchRequest{Query: "rotate the encryption keys", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Document.ID != "keys:0:0" {
+		t.Fatalf("search returned %+v", results)
+	}
+	if len(unindexed) != 1 || unindexed[0] != "pending" {
+		t.Errorf("unindexed = %v", unindexed)
+	}
+
+	// Filters apply before the limit
+	results, _, err = svc.Search(ctx, &SearchRequest{Query: "rotate the encryption keys", Limit: 1, Filters: map[string]interface{}{"memory_id": "notes", "frame_number": 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Document.ID != "notes:1:100" {
+		t.Errorf("filtered search returned %+v", results)
+	}
+
+	if _, _, err := svc.Search(ctx, &SearchRequest{Query: "keys", Mode: "fuzzy"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("unknown mode returned %v", err)
+	}
+
+	similar, err := svc.GetSimilarDocuments(ctx, "keys:0:0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similar) != 1 || similar[0].Document.ID != "notes:1:100" {
+		t.Errorf("similar documents %+v", similar)
+	}
+	if _, err := svc.GetSimilarDocuments(ctx, "keys:7:0", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown document returned %v", err)
+	}
+
+	// Pages run across archives in name order
+	docs, err := svc.ListDocuments(ctx, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].ID != "keys:1:100" || docs[1].ID != "notes:0:0" {
+		t.Errorf("listed %+v", docs)
+	}
+}
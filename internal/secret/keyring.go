@@ -0,0 +1,261 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned when a keyring has no secret under a name
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// keyringService groups Pixelog's entries in the OS keyring
+const keyringService = "pixelog"
+
+// Keyring stores secrets under names, so commands and API requests can
+// refer to a password without carrying it
+type Keyring interface {
+	Get(name string) (string, error)
+	Set(name, secret string) error
+	Delete(name string) error
+	Backend() string
+}
+
+// OpenKeyring returns the OS keyring if its command line tool is installed:
+// the macOS Keychain through security, or the Secret Service through
+// secret-tool elsewhere. Otherwise, or when PIXELOG_KEYRING=file, secrets
+// are kept in a file readable only by the owner in the user config directory.
+func OpenKeyring() (Keyring, error) {
+	if os.Getenv("PIXELOG_KEYRING") != "file" {
+		switch runtime.GOOS {
+		case "darwin":
+			if _, err := exec.LookPath("security"); err == nil {
+				return keychain{}, nil
+			}
+		case "linux", "freebsd", "openbsd", "netbsd":
+			if _, err := exec.LookPath("secret-tool"); err == nil {
+				return secretService{}, nil
+			}
+		}
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate config directory for keyring: %w", err)
+	}
+	return NewFileKeyring(filepath.Join(dir, "pixelog", "secrets.json")), nil
+}
+
+// keychain stores secrets in the macOS Keychain. Secrets are passed to
+// security on stdin so they never appear in a process listing.
+type keychain struct{}
+
+func (keychain) Backend() string { return "macOS Keychain" }
+
+func (keychain) Get(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w").Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (keychain) Set(name, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quoteSecurityArg(keyringService), quoteSecurityArg(name), quoteSecurityArg(secret)))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store secret in keychain: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (keychain) Delete(name string) error {
+	if err := exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", name).Run(); err != nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return nil
+}
+
+// quoteSecurityArg quotes an argument for security's interactive mode
+func quoteSecurityArg(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// secretService stores secrets through the freedesktop Secret Service,
+// e.g. GNOME Keyring or KWallet, using secret-tool
+type secretService struct{}
+
+func (secretService) Backend() string { return "Secret Service" }
+
+func (secretService) Get(name string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", name).Output()
+	if err != nil || len(out) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (secretService) Set(name, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", "Pixelog "+name, "service", keyringService, "account", name)
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store secret with secret-tool: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (secretService) Delete(name string) error {
+	if _, err := (secretService{}).Get(name); err != nil {
+		return err
+	}
+	if err := exec.Command("secret-tool", "clear", "service", keyringService, "account", name).Run(); err != nil {
+		return fmt.Errorf("failed to delete secret with secret-tool: %w", err)
+	}
+	return nil
+}
+
+// FileKeyring keeps secrets in a JSON file with owner-only permissions. It
+// is a fallback for systems without a keyring service: the secrets are
+// protected by file permissions only, not encrypted.
+type FileKeyring struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileKeyring uses the file at path, created on the first Set
+func NewFileKeyring(path string) *FileKeyring {
+	return &FileKeyring{path: path}
+}
+
+func (k *FileKeyring) Backend() string { return "file " + k.path }
+
+func (k *FileKeyring) Get(name string) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secrets, err := k.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return secret, nil
+}
+
+func (k *FileKeyring) Set(name, secret string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secrets, err := k.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = secret
+	return k.save(secrets)
+}
+
+func (k *FileKeyring) Delete(name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secrets, err := k.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(secrets, name)
+	return k.save(secrets)
+}
+
+func (k *FileKeyring) load() (map[string]string, error) {
+	secrets := make(map[string]string)
+	info, err := os.Stat(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("keyring file %s is accessible by other users, run chmod 600 on it", k.path)
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring %s: %w", k.path, err)
+	}
+	return secrets, nil
+}
+
+// save replaces the file atomically so a crash never leaves it truncated
+func (k *FileKeyring) save(secrets map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %w", err)
+	}
+	data, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize keyring: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(k.path), ".secrets-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	if err := temp.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		temp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := os.Rename(temp.Name(), k.path); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
+
+// Scoped limits a keyring to the entries whose names start with prefix,
+// which it adds to the names it is given. A server that resolves names sent
+// by clients can then only reach the entries set aside for it.
+func Scoped(keyring Keyring, prefix string) Keyring {
+	return scopedKeyring{keyring: keyring, prefix: prefix}
+}
+
+type scopedKeyring struct {
+	keyring Keyring
+	prefix  string
+}
+
+func (k scopedKeyring) Backend() string { return k.keyring.Backend() }
+
+func (k scopedKeyring) Get(name string) (string, error) {
+	return k.keyring.Get(k.prefix + name)
+}
+
+func (k scopedKeyring) Set(name, secret string) error {
+	return k.keyring.Set(k.prefix+name, secret)
+}
+
+func (k scopedKeyring) Delete(name string) error {
+	return k.keyring.Delete(k.prefix + name)
+}
@@ -0,0 +1,54 @@
+package secret
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prompt asks for a password on the controlling terminal with echo turned
+// off. It reads the terminal directly, so it works while stdin is redirected.
+func Prompt(label string) (string, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return "", fmt.Errorf("no terminal to prompt for a password on, use --password-file or --password-fd: %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, label)
+	line, err := readNoEcho(tty)
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if line == "" {
+		return "", fmt.Errorf("password is empty")
+	}
+	return line, nil
+}
+
+// PromptNew asks for a new password twice and checks both entries match
+func PromptNew(label string) (string, error) {
+	password, err := Prompt(label)
+	if err != nil {
+		return "", err
+	}
+	again, err := Prompt("Confirm " + strings.ToLower(label[:1]) + label[1:])
+	if err != nil {
+		return "", err
+	}
+	if again != password {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return password, nil
+}
+
+// readLine reads one line from the terminal without its line ending
+func readLine(tty *os.File) (string, error) {
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
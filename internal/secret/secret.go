@@ -0,0 +1,53 @@
+// Package secret reads passwords without exposing them in argv, the
+// environment or request bodies: from a terminal prompt with echo off, a
+// file, an inherited file descriptor, or a named entry in a keyring.
+package secret
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxSecretSize bounds how much is read from a password file or descriptor
+const maxSecretSize = 64 * 1024
+
+// FromFile reads a password from the first line of a file
+func FromFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open password file: %w", err)
+	}
+	defer file.Close()
+	return readFirstLine(file)
+}
+
+// FromFD reads a password from an inherited file descriptor, such as a
+// pipe set up with 3<<<"$PASSWORD" in a shell
+func FromFD(fd int) (string, error) {
+	if fd < 0 {
+		return "", fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if file == nil {
+		return "", fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer file.Close()
+	return readFirstLine(file)
+}
+
+// readFirstLine returns the first line of r without its line ending.
+// Anything after it is ignored, so files may end with or without a newline.
+func readFirstLine(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSecretSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" {
+		return "", fmt.Errorf("password is empty")
+	}
+	return line, nil
+}
@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFromFile(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"hunter2":              "hunter2",
+		"hunter2\n":            "hunter2",
+		"hunter2\r\n":          "hunter2",
+		"pass word\nignored\n": "pass word",
+	}
+	for content, want := range cases {
+		path := filepath.Join(dir, "password")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := FromFile(path)
+		if err != nil {
+			t.Fatalf("FromFile(%q): %v", content, err)
+		}
+		if got != want {
+			t.Errorf("FromFile(%q) = %q, want %q", content, got, want)
+		}
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromFile(empty); err == nil {
+		t.Error("empty password file was accepted")
+	}
+}
+
+func TestFileKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pixelog", "secrets.json")
+	keyring := NewFileKeyring(path)
+
+	if _, err := keyring.Get("backup"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get on empty keyring = %v, want ErrNotFound", err)
+	}
+	if err := keyring.Set("backup", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Set("legal", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh instance reads what the first one wrote
+	got, err := NewFileKeyring(path).Get("backup")
+	if err != nil || got != "correct horse" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	if err := keyring.Delete("backup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.Get("backup"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted secret is still present: %v", err)
+	}
+	if got, _ := keyring.Get("legal"); got != "battery staple" {
+		t.Errorf("Delete removed another entry")
+	}
+
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Fatalf("keyring file mode = %v, %v", info.Mode().Perm(), err)
+		}
+		os.Chmod(path, 0644)
+		if _, err := keyring.Get("legal"); err == nil {
+			t.Error("keyring readable by others was accepted")
+		}
+	}
+}
+
+func TestScopedKeyring(t *testing.T) {
+	keyring := NewFileKeyring(filepath.Join(t.TempDir(), "secrets.json"))
+	if err := keyring.Set("backup", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	server := Scoped(keyring, "server/")
+	if err := server.Set("legal", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := keyring.Get("server/legal"); err != nil || got != "battery staple" {
+		t.Errorf("scoped entry stored as %q, %v", got, err)
+	}
+	if _, err := server.Get("backup"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get outside the scope = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || windows)
+
+package secret
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTerminal = errors.New("terminal prompts are not supported on this platform")
+
+func openTerminal() (*os.File, error) {
+	return nil, errNoTerminal
+}
+
+func readNoEcho(tty *os.File) (string, error) {
+	return "", errNoTerminal
+}
@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package secret
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// readNoEcho turns off terminal echo while reading a line and restores the
+// previous settings afterwards
+func readNoEcho(tty *os.File) (string, error) {
+	fd := int(tty.Fd())
+	old, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return "", err
+	}
+
+	silent := *old
+	silent.Lflag &^= unix.ECHO
+	silent.Lflag |= unix.ICANON | unix.ISIG
+	silent.Iflag |= unix.ICRNL
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &silent); err != nil {
+		return "", err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlWriteTermios, old)
+
+	return readLine(tty)
+}
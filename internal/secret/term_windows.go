@@ -0,0 +1,31 @@
+//go:build windows
+
+package secret
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("CONIN$", os.O_RDWR, 0)
+}
+
+// readNoEcho turns off console echo while reading a line and restores the
+// previous mode afterwards
+func readNoEcho(tty *os.File) (string, error) {
+	handle := windows.Handle(tty.Fd())
+	var old uint32
+	if err := windows.GetConsoleMode(handle, &old); err != nil {
+		return "", err
+	}
+
+	silent := old&^windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT
+	if err := windows.SetConsoleMode(handle, silent); err != nil {
+		return "", err
+	}
+	defer windows.SetConsoleMode(handle, old)
+
+	return readLine(tty)
+}
@@ -0,0 +1,143 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+// CaptureOptions controls decoding of a camera recording of a playing .pixe
+type CaptureOptions struct {
+	// SampleRate resamples the recording to this many frames per second
+	// before decoding. Zero decodes every recorded frame.
+	SampleRate float64
+	// Workers is the number of frames decoded in parallel, defaulting to
+	// the number of CPUs
+	Workers int
+	// Sealer opens archives converted with metadata encryption
+	Sealer qr.Sealer
+}
+
+// CaptureData rebuilds an archive from an arbitrary recording of a screen
+// playing it, such as a phone or webcam video. Symbols are searched for
+// anywhere in each frame, chunks seen in many frames are de-duplicated, and
+// missing chunks are rebuilt from parity where possible. Files that remain
+// incomplete are saved with zero-filled gaps, as in salvage extraction.
+func (m *Maker) CaptureData(inputPath, outputDir string, opts CaptureOptions) (*ExtractReport, error) {
+	scan, err := m.ScanCapture(inputPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := scan.Unseal(opts.Sealer); err != nil {
+		return nil, err
+	}
+
+	return RecoverScan(inputPath, scan, outputDir)
+}
+
+// RecoverScan reassembles the chunks of a scan and saves every file found,
+// keeping incomplete files with zero-filled gaps
+func RecoverScan(source string, scan *FrameScan, outputDir string) (*ExtractReport, error) {
+	report := &ExtractReport{
+		Source:        source,
+		TotalFrames:   scan.TotalFrames,
+		DecodedFrames: scan.TotalFrames - len(scan.FailedFrames),
+		FailedFrames:  scan.FailedFrames,
+	}
+
+	if len(scan.Chunks) == 0 {
+		return report, fmt.Errorf("no chunk QR codes found in %s", source)
+	}
+
+	reassembler := NewReassembler()
+	reassembler.SetFrames(scan.TotalFrames)
+	for _, decoded := range scan.Chunks {
+		reassembler.Add(decoded.Chunk)
+	}
+	report.Manifest, _ = reassembler.Manifest()
+
+	for _, file := range reassembler.Assemble() {
+		report.Files = append(report.Files, file.Save(outputDir))
+	}
+
+	return report, nil
+}
+
+// ScanCapture decodes every QR symbol in every frame of a recording. Unlike
+// DecodeChunks a frame may yield several chunks, and frames without any
+// symbol are listed in FailedFrames.
+func (m *Maker) ScanCapture(inputPath string, opts CaptureOptions) (*FrameScan, error) {
+	tempDir, frameFiles, err := extractFrames(inputPath, opts.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	return ScanImages(frameFiles, opts.Workers), nil
+}
+
+// ScanImages decodes every QR symbol in a set of images in parallel, such
+// as extracted frames or scanned pages. Images are numbered by position
+// unless their name carries an FFmpeg frame number. Workers defaults to
+// the number of CPUs.
+func ScanImages(paths []string, workers int) *FrameScan {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([][]qr.Chunk, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				chunks, err := decodeAllFromImage(paths[i])
+				if err == nil {
+					results[i] = chunks
+				}
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	scan := &FrameScan{TotalFrames: len(paths)}
+	for i, path := range paths {
+		frameNumber := frameNumberOf(path, i)
+		if len(results[i]) == 0 {
+			scan.FailedFrames = append(scan.FailedFrames, frameNumber)
+			continue
+		}
+		for _, chunk := range results[i] {
+			scan.Chunks = append(scan.Chunks, DecodedChunk{Frame: frameNumber, Chunk: chunk})
+		}
+	}
+
+	return scan
+}
+
+func decodeAllFromImage(path string) ([]qr.Chunk, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", path, err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %w", path, err)
+	}
+
+	return qr.DecodeAll(img)
+}
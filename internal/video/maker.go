@@ -1,10 +1,8 @@
 package video
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"image"
 	"image/png"
 	"os"
 	"os/exec"
@@ -12,11 +10,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ArqonAi/Pixelog/internal/qr"
 	"github.com/ArqonAi/Pixelog/pkg/config"
-	"github.com/makiuchi-d/gozxing"
-	qrReader "github.com/makiuchi-d/gozxing/qrcode"
 )
 
 type Maker struct{}
@@ -82,8 +79,11 @@ func (m *Maker) CreateVideo(framePaths []string, outputPath string, metadata int
 		"-metadata", "title=Pixelog Knowledge File",
 		"-metadata", "comment=Generated by Pixelog v1.0.0",
 		"-f", "mp4", // Force MP4 format for .pixe files
-		outputPath,
 	}
+	if cfg.Reproducible {
+		args = append(args, reproducibleArgs(cfg)...)
+	}
+	args = append(args, outputPath)
 
 	cmd := exec.Command("ffmpeg", args...)
 
@@ -102,138 +102,163 @@ func (m *Maker) CreateVideo(framePaths []string, outputPath string, metadata int
 	return nil
 }
 
+// reproducibleArgs makes ffmpeg's output depend only on its input: no
+// encoder version strings, a fixed creation time, and a single encoding
+// thread since x264's output varies with the thread count
+func reproducibleArgs(cfg *config.Config) []string {
+	return []string{
+		"-fflags", "+bitexact",
+		"-flags:v", "+bitexact",
+		"-flags:a", "+bitexact",
+		"-threads", "1",
+		"-map_metadata", "-1",
+		"-metadata", "creation_time=" + cfg.BuildTime().Format(time.RFC3339),
+	}
+}
+
+// ExtractOptions controls how damaged archives are handled during extraction
+type ExtractOptions struct {
+	// Salvage writes partial files with zero-filled gaps instead of failing
+	Salvage bool
+	// Sealer opens archives converted with metadata encryption
+	Sealer qr.Sealer
+}
+
+// DecodedChunk is a chunk together with the video frame it was read from
+type DecodedChunk struct {
+	Frame int
+	Chunk qr.Chunk
+}
+
+// FrameScan is the result of decoding every frame of a .pixe file
+type FrameScan struct {
+	TotalFrames  int
+	Chunks       []DecodedChunk
+	FailedFrames []int
+}
+
 func (m *Maker) ExtractData(inputPath, outputDir string) error {
-	// Create temporary directory for frames
-	tempDir, err := os.MkdirTemp("", "pixelog-extract-*")
+	_, err := m.ExtractDataWithReport(inputPath, outputDir, ExtractOptions{})
+	return err
+}
+
+// ExtractDataWithReport extracts all files and reports per-file status.
+// In salvage mode incomplete files are written with zero-filled gaps and a
+// .missing sidecar instead of aborting the extraction.
+func (m *Maker) ExtractDataWithReport(inputPath, outputDir string, opts ExtractOptions) (*ExtractReport, error) {
+	scan, err := m.DecodeChunks(inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, err
 	}
-	defer os.RemoveAll(tempDir)
-
-	// Extract frames from video using FFmpeg
-	framePattern := filepath.Join(tempDir, "frame_%05d.png")
-	cmd := exec.Command("ffmpeg", "-i", inputPath, "-vf", "fps=1", framePattern)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to extract frames: %w", err)
+	if err := scan.Unseal(opts.Sealer); err != nil {
+		return nil, err
 	}
 
-	// Find all extracted frames
-	frameFiles, err := filepath.Glob(filepath.Join(tempDir, "frame_*.png"))
-	if err != nil {
-		return fmt.Errorf("failed to find frames: %w", err)
+	report := &ExtractReport{
+		Source:        inputPath,
+		TotalFrames:   scan.TotalFrames,
+		DecodedFrames: len(scan.Chunks),
+		FailedFrames:  scan.FailedFrames,
 	}
 
-	if len(frameFiles) == 0 {
-		return fmt.Errorf("no frames extracted from video")
+	if len(scan.Chunks) == 0 {
+		return report, fmt.Errorf("no valid QR codes found in video frames")
 	}
 
-	// Sort frames by filename to ensure correct order
-	sort.Strings(frameFiles)
+	reassembler := NewReassembler()
+	reassembler.SetFrames(scan.TotalFrames)
+	for _, decoded := range scan.Chunks {
+		reassembler.Add(decoded.Chunk)
+	}
+	files := reassembler.Assemble()
+	report.Manifest, _ = reassembler.Manifest()
 
-	// Decode QR codes from each frame
-	var allChunks []qr.Chunk
-	for i, frameFile := range frameFiles {
-		chunk, err := m.decodeQRFromFrame(frameFile, i)
-		if err != nil {
-			// Skip frames that don't contain valid QR codes
-			continue
+	if !opts.Salvage {
+		for _, file := range files {
+			if file.Err != nil {
+				return report, fmt.Errorf("failed to reassemble %s: %w", file.Name, file.Err)
+			}
+			if len(file.Missing) > 0 {
+				return report, fmt.Errorf("missing chunk index %d for file %s", file.Missing[0], file.Name)
+			}
 		}
-		allChunks = append(allChunks, *chunk)
 	}
 
-	if len(allChunks) == 0 {
-		return fmt.Errorf("no valid QR codes found in video frames")
+	for _, file := range files {
+		report.Files = append(report.Files, file.Save(outputDir))
 	}
 
-	// Sort chunks by index to ensure correct reassembly
-	sort.Slice(allChunks, func(i, j int) bool {
-		return allChunks[i].Index < allChunks[j].Index
-	})
+	return report, nil
+}
 
-	// Group chunks by file (using Hash as file identifier)
-	fileChunks := make(map[string][]qr.Chunk)
-	for _, chunk := range allChunks {
-		fileChunks[chunk.Hash] = append(fileChunks[chunk.Hash], chunk)
+// DecodeChunks extracts every frame of the video and decodes its QR chunk.
+// Frames that cannot be decoded are listed in FailedFrames by frame number.
+func (m *Maker) DecodeChunks(inputPath string) (*FrameScan, error) {
+	tempDir, frameFiles, err := extractFrames(inputPath, 0)
+	if err != nil {
+		return nil, err
 	}
+	defer os.RemoveAll(tempDir)
 
-	// Reassemble each file
-	for _, chunks := range fileChunks {
-		if len(chunks) == 0 {
+	scan := &FrameScan{TotalFrames: len(frameFiles)}
+	for i, frameFile := range frameFiles {
+		frameNumber := frameNumberOf(frameFile, i)
+		chunk, err := m.decodeQRFromFrame(frameFile, frameNumber)
+		if err != nil {
+			scan.FailedFrames = append(scan.FailedFrames, frameNumber)
 			continue
 		}
+		scan.Chunks = append(scan.Chunks, DecodedChunk{Frame: frameNumber, Chunk: *chunk})
+	}
 
-		// Sort chunks by index
-		sort.Slice(chunks, func(i, j int) bool {
-			return chunks[i].Index < chunks[j].Index
-		})
+	return scan, nil
+}
 
-		// Verify we have all chunks and check for index consistency
-		if len(chunks) == 0 {
-			return fmt.Errorf("no chunks found")
-		}
-		
-		firstChunk := chunks[0]
-		expectedTotal := firstChunk.Total
-		actualTotal := len(chunks)
-		
-		fmt.Printf("DEBUG: Chunk validation - Expected: %d, Actual: %d\n", expectedTotal, actualTotal)
-		
-		// Check if all chunk indices are present (0-based indexing) and deduplicate
-		indexMap := make(map[int]bool)
-		uniqueChunks := make(map[int]qr.Chunk)
-		for _, chunk := range chunks {
-			fmt.Printf("DEBUG: Chunk %d/%d: Index=%d, Data length=%d\n", chunk.Index, chunk.Total, chunk.Index, len(chunk.Data))
-			indexMap[chunk.Index] = true
-			uniqueChunks[chunk.Index] = chunk // This automatically deduplicates by index
-		}
-		
-		// Replace chunks with deduplicated version
-		chunks = make([]qr.Chunk, 0, len(uniqueChunks))
-		for i := 0; i < expectedTotal; i++ {
-			if chunk, exists := uniqueChunks[i]; exists {
-				chunks = append(chunks, chunk)
-			}
-		}
-		
-		// Verify all indices from 0 to Total-1 are present
-		for i := 0; i < expectedTotal; i++ {
-			if !indexMap[i] {
-				return fmt.Errorf("missing chunk index %d for file %s", i, firstChunk.SourceFile)
-			}
-		}
-		
-		if actualTotal != expectedTotal {
-			fmt.Printf("DEBUG: Chunk count mismatch for %s - this might be OK if chunks are duplicated\n", firstChunk.SourceFile)
-			// Instead of failing, let's use only the unique chunks we need
-		}
+// extractFrames dumps the frames of a video into a temporary directory and
+// returns them sorted. A positive fps resamples the video first; otherwise
+// every frame is kept. The caller removes the directory.
+func extractFrames(inputPath string, fps float64) (string, []string, error) {
+	tempDir, err := os.MkdirTemp("", "pixelog-extract-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
 
-		// Reassemble file data
-		var reassembledData strings.Builder
-		for _, chunk := range chunks {
-			reassembledData.WriteString(chunk.Data)
-		}
+	args := []string{"-i", inputPath}
+	if fps > 0 {
+		args = append(args, "-vf", fmt.Sprintf("fps=%g", fps))
+	} else {
+		args = append(args, "-vsync", "0")
+	}
+	args = append(args, filepath.Join(tempDir, "frame_%05d.png"))
 
-		// Decode data based on MIME type
-		var finalData []byte
-		if strings.HasPrefix(firstChunk.MimeType, "text/") {
-			finalData = []byte(reassembledData.String())
-		} else {
-			// Decode base64 for binary files
-			decoded, err := base64.StdEncoding.DecodeString(reassembledData.String())
-			if err != nil {
-				return fmt.Errorf("failed to decode base64 data for %s: %w", firstChunk.SourceFile, err)
-			}
-			finalData = decoded
-		}
+	if err := exec.Command("ffmpeg", args...).Run(); err != nil {
+		os.RemoveAll(tempDir)
+		return "", nil, fmt.Errorf("failed to extract frames: %w", err)
+	}
 
-		// Write reassembled file
-		outputPath := filepath.Join(outputDir, firstChunk.SourceFile)
-		if err := os.WriteFile(outputPath, finalData, 0644); err != nil {
-			return fmt.Errorf("failed to write extracted file %s: %w", outputPath, err)
-		}
+	frameFiles, err := filepath.Glob(filepath.Join(tempDir, "frame_*.png"))
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", nil, fmt.Errorf("failed to find frames: %w", err)
+	}
+	if len(frameFiles) == 0 {
+		os.RemoveAll(tempDir)
+		return "", nil, fmt.Errorf("no frames extracted from video")
 	}
 
-	return nil
+	// Sort frames by filename to ensure correct order
+	sort.Strings(frameFiles)
+	return tempDir, frameFiles, nil
+}
+
+// frameNumberOf maps an extracted frame file to its zero-based frame number.
+// FFmpeg numbers output files from 1, video frames are numbered from 0.
+func frameNumberOf(frameFile string, fallback int) int {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(frameFile), "frame_"), ".png")
+	if n, err := strconv.Atoi(name); err == nil {
+		return n - 1
+	}
+	return fallback
 }
 
 func (m *Maker) decodeQRFromFrame(framePath string, frameIndex int) (*qr.Chunk, error) {
@@ -249,49 +274,13 @@ func (m *Maker) decodeQRFromFrame(framePath string, frameIndex int) (*qr.Chunk,
 		return nil, fmt.Errorf("failed to decode PNG frame %s: %w", framePath, err)
 	}
 
-	// Convert image to grayscale for QR decoding
-	bounds := img.Bounds()
-	gray := image.NewGray(bounds)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			gray.Set(x, y, img.At(x, y))
-		}
-	}
-
-	// Try to decode QR code from the image
-	// Note: This is a simplified approach. In production, you'd want to use a proper QR decoder library
-	// For now, we'll implement a basic pattern matching approach
-	qrData, err := m.extractQRData(gray)
+	// Decode the QR code, retrying with image enhancement for degraded frames
+	chunk, err := qr.DecodeImage(img)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode QR from frame %d: %w", frameIndex, err)
 	}
 
-	// Parse the QR data back into a chunk
-	var chunk qr.Chunk
-	if err := json.Unmarshal([]byte(qrData), &chunk); err != nil {
-		return nil, fmt.Errorf("failed to parse QR data from frame %d: %w", frameIndex, err)
-	}
-
-	return &chunk, nil
-}
-
-func (m *Maker) extractQRData(img image.Image) (string, error) {
-	// Convert image to gozxing BinaryBitmap
-	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
-	if err != nil {
-		return "", fmt.Errorf("failed to create bitmap: %w", err)
-	}
-
-	// Create QR code reader
-	reader := qrReader.NewQRCodeReader()
-	
-	// Decode the QR code
-	result, err := reader.Decode(bmp, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode QR code: %w", err)
-	}
-
-	return result.GetText(), nil
+	return chunk, nil
 }
 
 func (m *Maker) ExtractMetadata(inputPath string) (*Metadata, error) {
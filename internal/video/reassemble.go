@@ -0,0 +1,483 @@
+package video
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+// FileStatus describes how much of a file could be rebuilt from its chunks
+type FileStatus string
+
+const (
+	FileComplete FileStatus = "complete"
+	FilePartial  FileStatus = "partial"
+	FileFailed   FileStatus = "failed"
+)
+
+// ByteRange is a half-open [Start, End) range of bytes in a reassembled file
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// FileReport records the outcome of reassembling a single file
+type FileReport struct {
+	Name            string      `json:"name"`
+	Hash            string      `json:"hash"`
+	MimeType        string      `json:"mime_type"`
+	Encrypted       bool        `json:"encrypted,omitempty"`
+	Cipher          string      `json:"-"` // Chunked encryption header needed to decrypt the saved file
+	Status          FileStatus  `json:"status"`
+	TotalChunks     int         `json:"total_chunks"`
+	RecoveredChunks int         `json:"recovered_chunks"`
+	MissingIndices  []int       `json:"missing_indices,omitempty"`
+	RepairedIndices []int       `json:"repaired_indices,omitempty"`
+	MissingRanges   []ByteRange `json:"missing_ranges,omitempty"`
+	OutputPath      string      `json:"output_path,omitempty"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// ExtractReport is the structured result of an extraction run
+type ExtractReport struct {
+	Source        string       `json:"source"`
+	TotalFrames   int          `json:"total_frames"`
+	DecodedFrames int          `json:"decoded_frames"`
+	FailedFrames  []int        `json:"failed_frames,omitempty"`
+	Files         []FileReport `json:"files"`
+	Manifest      *qr.Manifest `json:"-"` // Nil if no manifest could be read
+}
+
+// Complete reports whether every file was rebuilt without gaps
+func (r *ExtractReport) Complete() bool {
+	for _, f := range r.Files {
+		if f.Status != FileComplete {
+			return false
+		}
+	}
+	return true
+}
+
+// AssembledFile is a file rebuilt from its chunks, possibly with zero-filled gaps
+type AssembledFile struct {
+	Name          string
+	Hash          string
+	MimeType      string
+	Encrypted     bool
+	Cipher        string
+	Total         int
+	Recovered     int
+	Data          []byte
+	Missing       []int
+	Repaired      []int // Recovered from parity chunks
+	MissingRanges []ByteRange
+	Duplicates    int   // Identical repeats of chunks already seen
+	Conflicts     []int // Indices seen with differing data
+	Totals        []int // Distinct chunk totals claimed, set only when they disagree
+	Err           error
+}
+
+// Complete reports whether all chunks of the file were present
+func (f *AssembledFile) Complete() bool {
+	return f.Err == nil && len(f.Missing) == 0
+}
+
+// Report converts the assembled file into a FileReport
+func (f *AssembledFile) Report() FileReport {
+	report := FileReport{
+		Name:            f.Name,
+		Hash:            f.Hash,
+		MimeType:        f.MimeType,
+		Encrypted:       f.Encrypted,
+		Cipher:          f.Cipher,
+		TotalChunks:     f.Total,
+		RecoveredChunks: f.Recovered,
+		MissingIndices:  f.Missing,
+		RepairedIndices: f.Repaired,
+		MissingRanges:   f.MissingRanges,
+	}
+	switch {
+	case f.Err != nil:
+		report.Status = FileFailed
+		report.Error = f.Err.Error()
+	case len(f.Missing) > 0:
+		report.Status = FilePartial
+	default:
+		report.Status = FileComplete
+	}
+	return report
+}
+
+// Save writes the file into outputDir and returns its report. Partial files
+// are written with zero-filled gaps next to a .missing sidecar listing them.
+func (f *AssembledFile) Save(outputDir string) FileReport {
+	report := f.Report()
+	if f.Err != nil {
+		return report
+	}
+
+	outputPath := filepath.Join(outputDir, filepath.Base(f.Name))
+	if err := os.WriteFile(outputPath, f.Data, 0644); err != nil {
+		report.Status = FileFailed
+		report.Error = fmt.Sprintf("failed to write extracted file %s: %v", outputPath, err)
+		return report
+	}
+	report.OutputPath = outputPath
+
+	if len(f.Missing) > 0 {
+		if err := os.WriteFile(outputPath+".missing", []byte(f.missingSidecar()), 0644); err != nil {
+			report.Error = fmt.Sprintf("failed to write sidecar for %s: %v", outputPath, err)
+		}
+	}
+
+	return report
+}
+
+func (f *AssembledFile) missingSidecar() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s: %d of %d chunks missing, gaps are zero-filled\n", f.Name, len(f.Missing), f.Total)
+	fmt.Fprintf(&b, "# missing chunk indices: %s\n", joinInts(f.Missing))
+	b.WriteString("# absent byte ranges [start, end):\n")
+	for _, r := range f.MissingRanges {
+		fmt.Fprintf(&b, "%d-%d\n", r.Start, r.End)
+	}
+	return b.String()
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Reassembler groups decoded chunks by file and rebuilds file contents.
+// Chunks may arrive in any order and more than once; parity chunks are
+// used to rebuild single missing chunks per group, and manifest chunks
+// are kept apart from the files.
+type Reassembler struct {
+	files     map[string]*chunkSet
+	manifests map[string]map[int]qr.Chunk
+	frames    int // Frames in the source, set by SetFrames
+	added     int // Distinct chunks added
+}
+
+type chunkSet struct {
+	first      qr.Chunk
+	chunks     map[int]qr.Chunk
+	parity     map[int]qr.Chunk
+	duplicates int
+	conflicts  map[int]bool
+	totals     map[int]bool
+}
+
+// NewReassembler creates an empty reassembler
+func NewReassembler() *Reassembler {
+	return &Reassembler{
+		files:     make(map[string]*chunkSet),
+		manifests: make(map[string]map[int]qr.Chunk),
+	}
+}
+
+// SetFrames tells the reassembler how many frames the source has, decoded
+// or not. No file can have more chunks than that, so a chunk claiming more
+// fails its file instead of making room for them.
+func (r *Reassembler) SetFrames(n int) {
+	r.frames = n
+}
+
+// chunkLimit is the most chunks a file may claim: one per frame of the
+// source, or per chunk decoded when that is more, as in captures holding
+// several symbols per frame
+func (r *Reassembler) chunkLimit() int {
+	return max(r.frames, r.added)
+}
+
+// validIndex reports whether a chunk's index fits the total it claims
+func validIndex(chunk qr.Chunk) bool {
+	if chunk.Index < 0 || chunk.Total <= 0 {
+		return false
+	}
+	if chunk.Kind == qr.KindParity {
+		return chunk.Index < qr.ParityGroups(chunk.Total, chunk.ParityGroup)
+	}
+	return chunk.Index < chunk.Total
+}
+
+// Add records a decoded chunk. The first copy of an index wins; later
+// copies are counted as duplicates, or as conflicts if their data differs.
+// Chunks whose index is outside the total they claim are dropped.
+func (r *Reassembler) Add(chunk qr.Chunk) {
+	if !validIndex(chunk) {
+		return
+	}
+	if chunk.Kind == qr.KindManifest {
+		parts, ok := r.manifests[chunk.Hash]
+		if !ok {
+			parts = make(map[int]qr.Chunk)
+			r.manifests[chunk.Hash] = parts
+		}
+		if _, seen := parts[chunk.Index]; !seen {
+			parts[chunk.Index] = chunk
+			r.added++
+		}
+		return
+	}
+
+	set, exists := r.files[chunk.Hash]
+	if !exists {
+		set = &chunkSet{
+			first:     chunk,
+			chunks:    make(map[int]qr.Chunk),
+			parity:    make(map[int]qr.Chunk),
+			conflicts: make(map[int]bool),
+			totals:    make(map[int]bool),
+		}
+		r.files[chunk.Hash] = set
+	}
+	set.totals[chunk.Total] = true
+
+	target := set.chunks
+	if chunk.Kind == qr.KindParity {
+		target = set.parity
+	}
+	existing, seen := target[chunk.Index]
+	switch {
+	case !seen:
+		target[chunk.Index] = chunk
+		r.added++
+	case existing.Data != chunk.Data && chunk.Kind != qr.KindParity:
+		set.conflicts[chunk.Index] = true
+	default:
+		set.duplicates++
+	}
+}
+
+// Manifest returns the archive manifest, or nil if the archive has none.
+// An error means manifest frames were found but could not be read.
+func (r *Reassembler) Manifest() (*qr.Manifest, error) {
+	if len(r.manifests) == 0 {
+		return nil, nil
+	}
+	if len(r.manifests) > 1 {
+		return nil, fmt.Errorf("found %d different manifests", len(r.manifests))
+	}
+	for _, parts := range r.manifests {
+		return qr.ParseManifest(parts)
+	}
+	return nil, nil
+}
+
+// Len returns the number of distinct files seen so far
+func (r *Reassembler) Len() int {
+	return len(r.files)
+}
+
+// Assemble rebuilds every file seen so far, sorted by name
+func (r *Reassembler) Assemble() []*AssembledFile {
+	manifest, _ := r.Manifest()
+	var files []*AssembledFile
+	for _, set := range r.files {
+		files = append(files, set.assemble(r.fileLimit(manifest, set.first.Hash)))
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Name != files[j].Name {
+			return files[i].Name < files[j].Name
+		}
+		return files[i].Hash < files[j].Hash
+	})
+	return files
+}
+
+// fileLimit is the most chunks a file may claim. A manifest entry fixes
+// the count, though only up to chunkLimit, since an unsigned manifest is no
+// more trustworthy than the frames.
+func (r *Reassembler) fileLimit(manifest *qr.Manifest, hash string) int {
+	limit := r.chunkLimit()
+	if manifest != nil {
+		if entry, ok := manifest.File(hash); ok {
+			limit = min(limit, entry.Chunks)
+		}
+	}
+	return limit
+}
+
+// assemble rebuilds the file, failing it if it claims more than limit chunks
+func (s *chunkSet) assemble(limit int) *AssembledFile {
+	first := s.first
+	file := &AssembledFile{
+		Name:      first.SourceFile,
+		Hash:      first.Hash,
+		MimeType:  first.MimeType,
+		Encrypted: first.Encrypted,
+		Cipher:    first.Cipher,
+		Total:     first.Total,
+	}
+
+	file.Duplicates = s.duplicates
+	for idx := range s.conflicts {
+		file.Conflicts = append(file.Conflicts, idx)
+	}
+	sort.Ints(file.Conflicts)
+	if len(s.totals) > 1 {
+		for total := range s.totals {
+			file.Totals = append(file.Totals, total)
+		}
+		sort.Ints(file.Totals)
+	}
+
+	if file.Total <= 0 {
+		file.Err = fmt.Errorf("invalid chunk total %d", file.Total)
+		return file
+	}
+	if file.Total > limit {
+		file.Err = fmt.Errorf("frames claim %d chunks, more than the %d the archive can hold", file.Total, limit)
+		return file
+	}
+
+	// Rebuild lost chunks from parity before looking for gaps. Chunks that
+	// claimed a larger total have nowhere to go.
+	chunks := maps.Clone(s.chunks)
+	maps.DeleteFunc(chunks, func(idx int, chunk qr.Chunk) bool { return idx >= file.Total })
+	for _, parity := range s.parity {
+		if parity.Total != file.Total {
+			continue
+		}
+		if recovered, ok := qr.RecoverFromParity(parity, chunks); ok {
+			chunks[recovered.Index] = recovered
+			file.Repaired = append(file.Repaired, recovered.Index)
+		}
+	}
+	sort.Ints(file.Repaired)
+	file.Recovered = len(chunks)
+
+	for i := 0; i < file.Total; i++ {
+		if _, ok := chunks[i]; !ok {
+			file.Missing = append(file.Missing, i)
+		}
+	}
+
+	// Fast path: everything is present, decode the whole stream at once
+	if len(file.Missing) == 0 {
+		var encoded strings.Builder
+		for i := 0; i < file.Total; i++ {
+			encoded.WriteString(chunks[i].Data)
+		}
+		data, err := decodePayload(encoded.String(), first.RawText())
+		if err != nil {
+			file.Err = fmt.Errorf("failed to decode data: %w", err)
+			return file
+		}
+		file.Data = data
+		return file
+	}
+
+	// Every chunk except the last carries the same number of encoded characters
+	stride := -1
+	for idx, chunk := range chunks {
+		if idx < file.Total-1 {
+			stride = len(chunk.Data)
+			break
+		}
+	}
+	if stride <= 0 {
+		file.Err = fmt.Errorf("cannot place chunks without a full-size chunk")
+		return file
+	}
+
+	textual := first.RawText()
+
+	// Decode each run of consecutive chunks and place it at its byte offset
+	var covered []ByteRange
+	var out []byte
+	for start := 0; start < file.Total; {
+		if _, ok := chunks[start]; !ok {
+			start++
+			continue
+		}
+		end := start
+		var run strings.Builder
+		for end < file.Total {
+			chunk, ok := chunks[end]
+			if !ok {
+				break
+			}
+			run.WriteString(chunk.Data)
+			end++
+		}
+
+		charOffset := int64(start) * int64(stride)
+		encoded := run.String()
+		var byteOffset int64
+		var data []byte
+		if textual {
+			byteOffset = charOffset
+			data = []byte(encoded)
+		} else {
+			// Align the run to base64 quantum boundaries so it decodes on its own
+			skip := (4 - int(charOffset%4)) % 4
+			if skip > len(encoded) {
+				skip = len(encoded)
+			}
+			encoded = encoded[skip:]
+			if end < file.Total {
+				encoded = encoded[:len(encoded)-len(encoded)%4]
+			}
+			byteOffset = (charOffset + int64(skip)) / 4 * 3
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				file.Err = fmt.Errorf("failed to decode chunks %d-%d: %w", start, end-1, err)
+				return file
+			}
+			data = decoded
+		}
+
+		if need := byteOffset + int64(len(data)); need > int64(len(out)) {
+			out = append(out, make([]byte, need-int64(len(out)))...)
+		}
+		copy(out[byteOffset:], data)
+		covered = append(covered, ByteRange{Start: byteOffset, End: byteOffset + int64(len(data))})
+		start = end
+	}
+
+	// When the last chunk is lost the true length is unknown, so assume a full chunk
+	size := int64(len(out))
+	if _, ok := chunks[file.Total-1]; !ok {
+		size = int64(file.Total) * int64(stride)
+		if !textual {
+			size = size / 4 * 3
+		}
+		if size > int64(len(out)) {
+			out = append(out, make([]byte, size-int64(len(out)))...)
+		}
+	}
+
+	var cursor int64
+	for _, r := range covered {
+		if r.Start > cursor {
+			file.MissingRanges = append(file.MissingRanges, ByteRange{Start: cursor, End: r.Start})
+		}
+		cursor = r.End
+	}
+	if cursor < size {
+		file.MissingRanges = append(file.MissingRanges, ByteRange{Start: cursor, End: size})
+	}
+
+	file.Data = out
+	return file
+}
+
+// decodePayload turns reassembled chunk data back into file bytes
+func decodePayload(data string, rawText bool) ([]byte, error) {
+	if rawText {
+		return []byte(data), nil
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
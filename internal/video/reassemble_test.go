@@ -0,0 +1,152 @@
+package video
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/internal/qr/qrtest"
+)
+
+func splitChunks(encoded, mimeType string, size int) []qr.Chunk {
+	return qrtest.Split(encoded, size, qr.Chunk{SourceFile: "file.bin", MimeType: mimeType, Hash: "hash"})
+}
+
+func TestReassemblerComplete(t *testing.T) {
+	data := bytes.Repeat([]byte("pixelog"), 100)
+	chunks := splitChunks(base64.StdEncoding.EncodeToString(data), "application/octet-stream", 64)
+
+	r := NewReassembler()
+	// Add in reverse with duplicates to exercise ordering and dedupe
+	for i := len(chunks) - 1; i >= 0; i-- {
+		r.Add(chunks[i])
+		r.Add(chunks[i])
+	}
+
+	files := r.Assemble()
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(files))
+	}
+	if !files[0].Complete() {
+		t.Fatalf("expected complete file, missing %v (err %v)", files[0].Missing, files[0].Err)
+	}
+	if !bytes.Equal(files[0].Data, data) {
+		t.Error("reassembled data does not match original")
+	}
+}
+
+func TestReassemblerSalvagesGaps(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i%250 + 1)
+	}
+	// 30 characters is not a multiple of 4, so runs need re-alignment
+	chunks := splitChunks(base64.StdEncoding.EncodeToString(data), "application/octet-stream", 30)
+
+	r := NewReassembler()
+	r.SetFrames(len(chunks)) // The lost chunks' frames failed to decode
+	for _, chunk := range chunks {
+		if chunk.Index == 5 || chunk.Index == 6 {
+			continue
+		}
+		r.Add(chunk)
+	}
+
+	file := r.Assemble()[0]
+	if file.Complete() || file.Err != nil {
+		t.Fatalf("expected partial file, got err=%v missing=%v", file.Err, file.Missing)
+	}
+	if len(file.Missing) != 2 || file.Missing[0] != 5 || file.Missing[1] != 6 {
+		t.Fatalf("unexpected missing indices %v", file.Missing)
+	}
+	if len(file.Data) != len(data) {
+		t.Fatalf("expected %d bytes, got %d", len(data), len(file.Data))
+	}
+
+	inGap := func(pos int) bool {
+		for _, r := range file.MissingRanges {
+			if int64(pos) >= r.Start && int64(pos) < r.End {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range data {
+		if inGap(i) {
+			if file.Data[i] != 0 {
+				t.Fatalf("byte %d inside a gap should be zero", i)
+			}
+		} else if file.Data[i] != data[i] {
+			t.Fatalf("byte %d outside gaps does not match", i)
+		}
+	}
+	// Chunks 5 and 6 cover characters 150-209, i.e. bytes 112-157
+	if len(file.MissingRanges) != 1 || file.MissingRanges[0].Start > 112 || file.MissingRanges[0].End < 157 {
+		t.Errorf("unexpected missing ranges %v", file.MissingRanges)
+	}
+}
+
+func TestReassemblerRepairsFromParity(t *testing.T) {
+	data := bytes.Repeat([]byte("parity groups are interleaved "), 40)
+	chunks := splitChunks(base64.StdEncoding.EncodeToString(data), "application/octet-stream", 48)
+	parity := qr.BuildParity(chunks, 4)
+
+	r := NewReassembler()
+	for _, chunk := range chunks {
+		// Lose a burst of consecutive frames
+		if chunk.Index >= 3 && chunk.Index <= 5 {
+			continue
+		}
+		r.Add(chunk)
+	}
+	for _, chunk := range parity {
+		r.Add(chunk)
+	}
+
+	file := r.Assemble()[0]
+	if !file.Complete() {
+		t.Fatalf("expected parity to fill the gap, still missing %v", file.Missing)
+	}
+	if len(file.Repaired) != 3 {
+		t.Errorf("expected 3 repaired chunks, got %v", file.Repaired)
+	}
+	if !bytes.Equal(file.Data, data) {
+		t.Error("repaired data does not match original")
+	}
+}
+
+func TestReassemblerBoundsClaimedTotals(t *testing.T) {
+	data := bytes.Repeat([]byte("bounded "), 50)
+	chunks := splitChunks(base64.StdEncoding.EncodeToString(data), "application/octet-stream", 64)
+
+	r := NewReassembler()
+	r.SetFrames(len(chunks) + 3)
+	for _, chunk := range chunks {
+		r.Add(chunk)
+	}
+	// One frame claiming a huge file, one placing a chunk far past the end
+	// of the real file, and one whose index is outside its own total
+	r.Add(qr.Chunk{Index: 0, Total: 2000000000, Data: "AAAA", SourceFile: "huge", Hash: "huge"})
+	r.Add(qr.Chunk{Index: 1000000000, Total: 2000000000, Data: "AAAA", SourceFile: "file.bin", Hash: "hash"})
+	r.Add(qr.Chunk{Index: 5, Total: 2, Data: "AAAA", SourceFile: "other", Hash: "other"})
+
+	files := r.Assemble()
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	var huge, real *AssembledFile
+	for _, f := range files {
+		if f.Hash == "huge" {
+			huge = f
+		} else {
+			real = f
+		}
+	}
+	if huge.Err == nil || len(huge.Missing) != 0 || huge.Data != nil {
+		t.Errorf("oversized file was not rejected: err=%v, %d missing", huge.Err, len(huge.Missing))
+	}
+	if !real.Complete() || !bytes.Equal(real.Data, data) {
+		t.Errorf("real file damaged by a stray chunk: err=%v, missing %v", real.Err, real.Missing)
+	}
+}
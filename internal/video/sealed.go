@@ -0,0 +1,63 @@
+package video
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+// ErrSealed is returned when an archive's frames are sealed and no password
+// was given to open them
+var ErrSealed = errors.New("archive frames are encrypted, a password is required")
+
+// Unseal replaces the sealed frames of a scan with the chunks inside them.
+// Frames that fail to open are moved to FailedFrames; if none open at all
+// the password is wrong. Scans without sealed frames are left untouched.
+//
+// Frames are opened from the lowest index, so the archive's first frame,
+// which starts the manifest, fixes the key derivation parameters and salt
+// for the rest; frames sealed with others fail to open.
+func (s *FrameScan) Unseal(sealer qr.Sealer) error {
+	order := make([]int, len(s.Chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return s.Chunks[order[a]].Chunk.Index < s.Chunks[order[b]].Chunk.Index
+	})
+
+	opened := make([]*DecodedChunk, len(s.Chunks))
+	sealed, failed := 0, 0
+	for _, i := range order {
+		decoded := s.Chunks[i]
+		if decoded.Chunk.Kind != qr.KindSealed {
+			opened[i] = &decoded
+			continue
+		}
+		sealed++
+		if sealer == nil {
+			return ErrSealed
+		}
+		chunk, err := qr.OpenChunk(decoded.Chunk, sealer)
+		if err != nil {
+			failed++
+			s.FailedFrames = append(s.FailedFrames, decoded.Frame)
+			continue
+		}
+		opened[i] = &DecodedChunk{Frame: decoded.Frame, Chunk: chunk}
+	}
+
+	if sealed > 0 && failed == sealed {
+		return fmt.Errorf("failed to open sealed frames: wrong password or corrupted archive")
+	}
+	s.Chunks = s.Chunks[:0]
+	for _, decoded := range opened {
+		if decoded != nil {
+			s.Chunks = append(s.Chunks, *decoded)
+		}
+	}
+	sort.Ints(s.FailedFrames)
+	return nil
+}
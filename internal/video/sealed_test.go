@@ -0,0 +1,63 @@
+package video
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ArqonAi/Pixelog/internal/crypto"
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+// testKDF keeps key derivation cheap in tests
+var testKDF = crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Iterations: 1, Memory: 64, Threads: 1}
+
+func TestSealedScanRoundTrip(t *testing.T) {
+	chunks, manifest := verifyFixture(t)
+	for i := range chunks {
+		chunks[i].SourceFile = "merger-agreement.pdf"
+	}
+	manifest, _ = qr.NewManifest(chunks, chunks[0].CreatedAt).Chunks(100)
+
+	envelope, err := crypto.NewEnvelope("correct horse", testKDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := qr.SealChunks(append(manifest, chunks...), envelope)
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	for _, frame := range sealed {
+		raw, _ := json.Marshal(frame)
+		if strings.Contains(string(raw), "merger") || frame.Hash != "" || frame.MimeType != "" {
+			t.Fatalf("sealed frame leaks metadata: %s", raw)
+		}
+	}
+
+	if err := scanOf(sealed).Unseal(nil); !errors.Is(err, ErrSealed) {
+		t.Errorf("expected ErrSealed without a password, got %v", err)
+	}
+
+	wrong, _ := crypto.NewEnvelope("wrong horse", testKDF)
+	if err := scanOf(sealed).Unseal(wrong); err == nil {
+		t.Error("expected a wrong password to fail")
+	}
+
+	// A frame moved to another position no longer authenticates
+	moved := append([]qr.Chunk(nil), sealed...)
+	moved[2].Index, moved[3].Index = moved[3].Index, moved[2].Index
+	scan := scanOf(moved)
+	if err := scan.Unseal(envelope); err != nil || len(scan.FailedFrames) != 2 {
+		t.Errorf("expected 2 reordered frames to fail, got %v %v", err, scan.FailedFrames)
+	}
+
+	scan = scanOf(sealed)
+	if err := scan.Unseal(envelope); err != nil {
+		t.Fatalf("failed to unseal: %v", err)
+	}
+	report := VerifyScan("test", scan, VerifyOptions{})
+	if report.Status != VerifyOK || !report.HasManifest || report.Files[0].Name != "merger-agreement.pdf" {
+		t.Errorf("unexpected report after unsealing: %s %+v", report.Status, report.Files)
+	}
+}
@@ -0,0 +1,229 @@
+package video
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+	"github.com/ArqonAi/Pixelog/pkg/config"
+)
+
+// FrameImage is a frame extracted from a video, with its chunk if the QR
+// code could be read
+type FrameImage struct {
+	Frame int
+	Path  string
+	Chunk *qr.Chunk
+}
+
+// Keyframe is where a copy of a video can start without re-encoding
+type Keyframe struct {
+	Frame int    // Frame number, the frame count if there is no keyframe left
+	Time  string // Presentation time in seconds as ffprobe prints it, empty if there is no keyframe left
+}
+
+// NextKeyframe finds the first keyframe at or after frame. Pixelog videos
+// are encoded with closed GOPs, so no frame after a keyframe refers to one
+// before it and the packet count before the keyframe is its frame number.
+func (m *Maker) NextKeyframe(videoPath string, frame int) (Keyframe, error) {
+	output, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		videoPath,
+	).Output()
+	if err != nil {
+		return Keyframe{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return nextKeyframe(string(output), frame), nil
+}
+
+// nextKeyframe reads ffprobe's pts_time,flags lines, one per packet in
+// decoding order
+func nextKeyframe(packets string, frame int) Keyframe {
+	lines := strings.Split(strings.TrimSpace(packets), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return Keyframe{}
+	}
+	for i := frame; i < len(lines); i++ {
+		fields := strings.Split(lines[i], ",")
+		if len(fields) >= 2 && strings.Contains(fields[len(fields)-1], "K") {
+			return Keyframe{Frame: i, Time: fields[0]}
+		}
+	}
+	return Keyframe{Frame: len(lines)}
+}
+
+// FrameRate returns the frame rate a video was encoded with
+func (m *Maker) FrameRate(videoPath string) (float64, error) {
+	output, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=r_frame_rate",
+		"-of", "csv=p=0",
+		videoPath,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseFrameRate(strings.TrimSpace(string(output)))
+}
+
+// parseFrameRate parses a rate such as 2/1 or 30000/1001
+func parseFrameRate(rate string) (float64, error) {
+	num, den, found := strings.Cut(rate, "/")
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := 1.0, error(nil)
+	if found {
+		d, err2 = strconv.ParseFloat(den, 64)
+	}
+	if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+		return 0, fmt.Errorf("unexpected frame rate %q", rate)
+	}
+	return n / d, nil
+}
+
+// EncodedQuality returns the CRF x264 recorded in a video's encoder
+// settings, which are written into the first frame, and false if it cannot
+// be found
+func (m *Maker) EncodedQuality(videoPath string) (int, bool) {
+	file, err := os.Open(videoPath)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	// The settings come after the header boxes, which are small for videos
+	// of QR frames
+	head := make([]byte, 4<<20)
+	n, _ := io.ReadFull(file, head)
+	return encodedQuality(head[:n])
+}
+
+func encodedQuality(data []byte) (int, bool) {
+	_, settings, found := bytes.Cut(data, []byte("x264 - core"))
+	if !found {
+		return 0, false
+	}
+	_, settings, found = bytes.Cut(settings, []byte(" crf="))
+	if !found {
+		return 0, false
+	}
+	end := bytes.IndexAny(settings, " \x00")
+	if end < 0 {
+		return 0, false
+	}
+	crf, err := strconv.ParseFloat(string(settings[:end]), 64)
+	if err != nil || crf < 0 || crf > 51 {
+		return 0, false
+	}
+	return int(crf + 0.5), true
+}
+
+// ExtractFrameImages extracts frames from up to but not including to into a
+// temporary directory, which the caller removes, and decodes the QR code of
+// each. Frames that cannot be decoded are returned without a chunk.
+func (m *Maker) ExtractFrameImages(videoPath string, from, to int) (string, []FrameImage, error) {
+	tempDir, err := os.MkdirTemp("", "pixelog-frames-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	if to <= from {
+		return tempDir, nil, nil
+	}
+
+	cmd := exec.Command("ffmpeg",
+		"-i", videoPath,
+		"-vf", fmt.Sprintf("select=between(n\\,%d\\,%d)", from, to-1),
+		"-vsync", "0",
+		filepath.Join(tempDir, "frame_%05d.png"),
+	)
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(tempDir)
+		return "", nil, fmt.Errorf("failed to extract frames: %w", err)
+	}
+
+	var frames []FrameImage
+	for i := 0; i < to-from; i++ {
+		// FFmpeg numbers output files from 1
+		path := filepath.Join(tempDir, fmt.Sprintf("frame_%05d.png", i+1))
+		if _, err := os.Stat(path); err != nil {
+			os.RemoveAll(tempDir)
+			return "", nil, fmt.Errorf("frame %d could not be extracted", from+i)
+		}
+		frame := FrameImage{Frame: from + i, Path: path}
+		frame.Chunk, _ = m.decodeQRFromFrame(path, from+i)
+		frames = append(frames, frame)
+	}
+	return tempDir, frames, nil
+}
+
+// SpliceVideo writes a copy of a video whose frames before keyframe are
+// replaced by the frames at framePaths, numbered as CreateVideo expects.
+// Only the new frames are encoded, with the frame rate and quality of cfg,
+// which must be those of the video for the two parts to play as one. The
+// rest is copied from the keyframe on as it is.
+func (m *Maker) SpliceVideo(inputPath, outputPath string, framePaths []string, keyframe Keyframe, metadata interface{}, cfg *config.Config) error {
+	if keyframe.Time == "" {
+		return m.CreateVideo(framePaths, outputPath, metadata, cfg)
+	}
+
+	tempDir := filepath.Dir(framePaths[0])
+	headPath := filepath.Join(tempDir, "head.mp4")
+	if err := m.CreateVideo(framePaths, headPath, metadata, cfg); err != nil {
+		return err
+	}
+	defer os.Remove(headPath)
+
+	absInput, err := filepath.Abs(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", inputPath, err)
+	}
+	absHead, err := filepath.Abs(headPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", headPath, err)
+	}
+	listPath := filepath.Join(tempDir, "splice.txt")
+	list := fmt.Sprintf("file %s\nfile %s\ninpoint %s\n", concatQuote(absHead), concatQuote(absInput), keyframe.Time)
+	if err := os.WriteFile(listPath, []byte(list), 0644); err != nil {
+		return fmt.Errorf("failed to write splice list: %w", err)
+	}
+	defer os.Remove(listPath)
+
+	args := []string{
+		"-y",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-map", "0",
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+	}
+	if cfg.Reproducible {
+		args = append(args, reproducibleArgs(cfg)...)
+	}
+	args = append(args, outputPath)
+
+	cmd := exec.Command("ffmpeg", args...)
+	if cfg.Verbose {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg splice failed: %w", err)
+	}
+	return nil
+}
+
+// concatQuote quotes a path for an ffmpeg concat list
+func concatQuote(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
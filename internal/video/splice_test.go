@@ -0,0 +1,40 @@
+package video
+
+import "testing"
+
+func TestNextKeyframe(t *testing.T) {
+	// Packets in decoding order, as ffprobe prints pts_time,flags
+	packets := "0.000000,K__\n1.500000,___\n0.500000,___\n1.000000,___\n2.000000,K__\n2.500000,___\n"
+	cases := []struct {
+		frame int
+		want  Keyframe
+	}{
+		{0, Keyframe{Frame: 0, Time: "0.000000"}},
+		{2, Keyframe{Frame: 4, Time: "2.000000"}},
+		{5, Keyframe{Frame: 6}},
+	}
+	for _, c := range cases {
+		if got := nextKeyframe(packets, c.frame); got != c.want {
+			t.Errorf("nextKeyframe(%d) = %+v, want %+v", c.frame, got, c.want)
+		}
+	}
+}
+
+func TestParseFrameRate(t *testing.T) {
+	if rate, err := parseFrameRate("2/1"); err != nil || rate != 2 {
+		t.Errorf("2/1 = %v, %v", rate, err)
+	}
+	if _, err := parseFrameRate("0/0"); err == nil {
+		t.Error("0/0 was accepted")
+	}
+}
+
+func TestEncodedQuality(t *testing.T) {
+	sei := []byte("\x00\x05x264 - core 164 r3095 - H.264/MPEG-4 AVC codec - options: cabac=1 ref=3 rc=crf mbtree=1 crf=28.0 qcomp=0.60\x00")
+	if crf, ok := encodedQuality(sei); !ok || crf != 28 {
+		t.Errorf("encodedQuality = %d, %v", crf, ok)
+	}
+	if _, ok := encodedQuality([]byte("no encoder settings")); ok {
+		t.Error("quality found without encoder settings")
+	}
+}
@@ -0,0 +1,287 @@
+package video
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+// VerifyStatus is the integrity verdict for a file or a whole archive
+type VerifyStatus string
+
+const (
+	VerifyOK         VerifyStatus = "OK"
+	VerifyCorrupt    VerifyStatus = "CORRUPT"
+	VerifyIncomplete VerifyStatus = "INCOMPLETE"
+)
+
+// FileVerification records the integrity checks run on one file
+type FileVerification struct {
+	Name            string       `json:"name"`
+	Hash            string       `json:"hash"`
+	Status          VerifyStatus `json:"status"`
+	ComputedHash    string       `json:"computed_hash,omitempty"`
+	Size            int64        `json:"size"`
+	TotalChunks     int          `json:"total_chunks"`
+	PresentChunks   int          `json:"present_chunks"`
+	MissingIndices  []int        `json:"missing_indices,omitempty"`
+	RepairedIndices []int        `json:"repaired_indices,omitempty"`
+	Duplicates      int          `json:"duplicates"`
+	Conflicts       []int        `json:"conflicting_indices,omitempty"`
+	Rejected        []int        `json:"rejected_frames,omitempty"` // Frames failing the manifest's chunk hashes or Merkle proofs
+	InManifest      bool         `json:"in_manifest"`
+	Problems        []string     `json:"problems,omitempty"`
+}
+
+// VerifyReport is the structured result of verifying an archive
+type VerifyReport struct {
+	Source        string             `json:"source"`
+	Status        VerifyStatus       `json:"status"`
+	TotalFrames   int                `json:"total_frames"`
+	DecodedFrames int                `json:"decoded_frames"`
+	FailedFrames  []int              `json:"failed_frames,omitempty"`
+	ArchiveID     string             `json:"archive_id,omitempty"`
+	HasManifest   bool               `json:"has_manifest"`
+	ManifestError string             `json:"manifest_error,omitempty"`
+	Signature     *SignatureCheck    `json:"signature,omitempty"`
+	Files         []FileVerification `json:"files"`
+}
+
+// SignatureCheck records the outcome of checking the manifest signature.
+// Valid means the manifest is unaltered since signing; Trusted additionally
+// means it was signed by the public key the caller asked for.
+type SignatureCheck struct {
+	KeyID   string `json:"key_id,omitempty"`
+	Valid   bool   `json:"valid"`
+	Trusted bool   `json:"trusted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// VerifyOptions controls archive verification
+type VerifyOptions struct {
+	// PublicKey, when set, requires a manifest signed by this key
+	PublicKey ed25519.PublicKey
+	// Sealer opens archives converted with metadata encryption
+	Sealer qr.Sealer
+}
+
+// Verify decodes every frame of a .pixe file once and checks each file's
+// integrity in memory without writing anything to disk
+func (m *Maker) Verify(inputPath string, opts VerifyOptions) (*VerifyReport, error) {
+	scan, err := m.DecodeChunks(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := scan.Unseal(opts.Sealer); err != nil {
+		return nil, err
+	}
+	return VerifyScan(inputPath, scan, opts), nil
+}
+
+// VerifyScan reassembles the chunks of a scan and checks every file: the
+// SHA-256 of the rebuilt bytes against Chunk.Hash and the manifest, that all
+// chunks agree on the chunk total, and that repeated chunks carry the same
+// data. Files are CORRUPT when any check fails, INCOMPLETE when chunks are
+// missing and OK otherwise; the archive takes the worst file status.
+// Frames whose data does not match the manifest's chunk hashes are left out
+// of reassembly, and a signed manifest is checked against opts.PublicKey.
+func VerifyScan(source string, scan *FrameScan, opts VerifyOptions) *VerifyReport {
+	report := &VerifyReport{
+		Source:        source,
+		Status:        VerifyOK,
+		TotalFrames:   scan.TotalFrames,
+		DecodedFrames: scan.TotalFrames - len(scan.FailedFrames),
+		FailedFrames:  scan.FailedFrames,
+	}
+
+	// Read the manifest first so every frame can be checked against it
+	manifestParts := NewReassembler()
+	for _, decoded := range scan.Chunks {
+		if decoded.Chunk.Kind == qr.KindManifest {
+			manifestParts.Add(decoded.Chunk)
+		}
+	}
+	manifest, err := manifestParts.Manifest()
+	if err != nil {
+		report.ManifestError = err.Error()
+	}
+	if manifest != nil {
+		report.HasManifest = true
+		report.ArchiveID = manifest.ArchiveID
+	}
+	report.Signature = checkSignature(manifest, opts)
+
+	reassembler := NewReassembler()
+	reassembler.SetFrames(scan.TotalFrames)
+	rejected := make(map[string][]int)
+	for _, decoded := range scan.Chunks {
+		chunk := decoded.Chunk
+		if chunk.Kind == qr.KindManifest {
+			continue
+		}
+		if manifest != nil {
+			if _, listed := manifest.File(chunk.Hash); listed && manifest.CheckChunk(chunk) != nil {
+				rejected[chunk.Hash] = append(rejected[chunk.Hash], decoded.Frame)
+				continue
+			}
+		}
+		reassembler.Add(chunk)
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range reassembler.Assemble() {
+		v := verifyFile(file)
+		seen[file.Hash] = true
+		if frames := rejected[file.Hash]; len(frames) > 0 {
+			v.Rejected = frames
+			v.Problems = append(v.Problems, fmt.Sprintf("frames %v fail the manifest chunk hash or Merkle proof", frames))
+			v.Status = VerifyCorrupt
+		}
+
+		if manifest != nil {
+			entry, ok := manifest.File(file.Hash)
+			v.InManifest = ok
+			switch {
+			case !ok:
+				v.Problems = append(v.Problems, "file is not listed in the manifest")
+			case entry.Chunks != file.Total:
+				v.Problems = append(v.Problems, fmt.Sprintf("manifest lists %d chunks, frames claim %d", entry.Chunks, file.Total))
+			case v.Status == VerifyOK && entry.Size != v.Size:
+				v.Problems = append(v.Problems, fmt.Sprintf("manifest lists %d bytes, rebuilt %d", entry.Size, v.Size))
+			}
+			if len(v.Problems) > 0 {
+				v.Status = VerifyCorrupt
+			}
+		}
+
+		report.Files = append(report.Files, v)
+	}
+
+	// Files the manifest promises but no frame carried at all
+	if manifest != nil {
+		for _, entry := range manifest.Files {
+			if seen[entry.Hash] {
+				continue
+			}
+			// An unsigned manifest is as untrusted as the frames, so its
+			// count gets the same bound as theirs
+			if limit := reassembler.chunkLimit(); entry.Chunks <= 0 || entry.Chunks > limit {
+				report.Files = append(report.Files, FileVerification{
+					Name:        entry.Name,
+					Hash:        entry.Hash,
+					Status:      VerifyCorrupt,
+					TotalChunks: entry.Chunks,
+					InManifest:  true,
+					Problems:    []string{fmt.Sprintf("manifest lists %d chunks, but the archive can hold at most %d", entry.Chunks, limit)},
+				})
+				continue
+			}
+			missing := make([]int, entry.Chunks)
+			for i := range missing {
+				missing[i] = i
+			}
+			report.Files = append(report.Files, FileVerification{
+				Name:           entry.Name,
+				Hash:           entry.Hash,
+				Status:         VerifyIncomplete,
+				TotalChunks:    entry.Chunks,
+				MissingIndices: missing,
+				InManifest:     true,
+				Problems:       []string{"no frames found for this file"},
+			})
+		}
+		sort.SliceStable(report.Files, func(i, j int) bool {
+			return report.Files[i].Name < report.Files[j].Name
+		})
+	}
+
+	if report.ManifestError != "" {
+		report.Status = VerifyCorrupt
+	}
+	if report.Signature != nil && !report.Signature.Valid {
+		report.Status = VerifyCorrupt
+	}
+	for _, f := range report.Files {
+		report.Status = worseStatus(report.Status, f.Status)
+	}
+	if len(report.Files) == 0 && report.Status == VerifyOK {
+		report.Status = VerifyIncomplete
+	}
+
+	return report
+}
+
+// checkSignature verifies the manifest signature. It returns nil for an
+// unsigned archive unless a public key was required.
+func checkSignature(manifest *qr.Manifest, opts VerifyOptions) *SignatureCheck {
+	if manifest == nil || manifest.Signature == nil {
+		if opts.PublicKey == nil {
+			return nil
+		}
+		return &SignatureCheck{Error: "archive is not signed"}
+	}
+
+	check := &SignatureCheck{KeyID: manifest.Signature.KeyID}
+	if err := manifest.VerifySignature(opts.PublicKey); err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Valid = true
+	check.Trusted = opts.PublicKey != nil
+	return check
+}
+
+// verifyFile runs the per-file checks that need no manifest
+func verifyFile(file *AssembledFile) FileVerification {
+	v := FileVerification{
+		Name:            file.Name,
+		Hash:            file.Hash,
+		TotalChunks:     file.Total,
+		PresentChunks:   file.Recovered,
+		MissingIndices:  file.Missing,
+		RepairedIndices: file.Repaired,
+		Duplicates:      file.Duplicates,
+		Conflicts:       file.Conflicts,
+		Size:            int64(len(file.Data)),
+	}
+
+	if len(file.Totals) > 0 {
+		v.Problems = append(v.Problems, fmt.Sprintf("chunks disagree on total: %v", file.Totals))
+	}
+	if len(file.Conflicts) > 0 {
+		v.Problems = append(v.Problems, fmt.Sprintf("conflicting data for chunks %v", file.Conflicts))
+	}
+	if file.Err != nil {
+		v.Problems = append(v.Problems, file.Err.Error())
+	}
+
+	if file.Complete() {
+		v.ComputedHash = fmt.Sprintf("%x", sha256.Sum256(file.Data))
+		if v.ComputedHash != file.Hash {
+			v.Problems = append(v.Problems, "SHA-256 does not match the chunk hash")
+		}
+	} else {
+		v.Size = 0 // Unknown until every chunk is present
+	}
+
+	switch {
+	case len(v.Problems) > 0:
+		v.Status = VerifyCorrupt
+	case len(file.Missing) > 0:
+		v.Status = VerifyIncomplete
+	default:
+		v.Status = VerifyOK
+	}
+	return v
+}
+
+func worseStatus(a, b VerifyStatus) VerifyStatus {
+	rank := map[VerifyStatus]int{VerifyOK: 0, VerifyIncomplete: 1, VerifyCorrupt: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
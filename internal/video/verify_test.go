@@ -0,0 +1,148 @@
+package video
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ArqonAi/Pixelog/internal/qr"
+)
+
+func verifyFixture(t *testing.T) ([]qr.Chunk, []qr.Chunk) {
+	t.Helper()
+	data := bytes.Repeat([]byte("verify me "), 50)
+	chunks := splitChunks(base64.StdEncoding.EncodeToString(data), "application/octet-stream", 40)
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	for i := range chunks {
+		chunks[i].Hash = hash
+	}
+
+	manifest, err := qr.NewManifest(chunks, time.Unix(0, 0)).Chunks(100)
+	if err != nil {
+		t.Fatalf("failed to build manifest: %v", err)
+	}
+	if got := qr.NewManifest(chunks, time.Unix(0, 0)).Files[0].Size; got != int64(len(data)) {
+		t.Fatalf("manifest size %d, want %d", got, len(data))
+	}
+	return chunks, manifest
+}
+
+func scanOf(chunks ...[]qr.Chunk) *FrameScan {
+	scan := &FrameScan{}
+	for _, list := range chunks {
+		for _, chunk := range list {
+			scan.Chunks = append(scan.Chunks, DecodedChunk{Frame: scan.TotalFrames, Chunk: chunk})
+			scan.TotalFrames++
+		}
+	}
+	return scan
+}
+
+// lose adds n frames that failed to decode to a scan
+func lose(scan *FrameScan, n int) *FrameScan {
+	for range n {
+		scan.FailedFrames = append(scan.FailedFrames, scan.TotalFrames)
+		scan.TotalFrames++
+	}
+	return scan
+}
+
+func TestVerifyScanOK(t *testing.T) {
+	chunks, manifest := verifyFixture(t)
+	report := VerifyScan("test", scanOf(manifest, chunks, chunks[:2]), VerifyOptions{})
+
+	if report.Status != VerifyOK || !report.HasManifest {
+		t.Fatalf("expected OK with manifest, got %s (%s)", report.Status, report.ManifestError)
+	}
+	if len(report.Files) != 1 || report.Files[0].Duplicates != 2 || !report.Files[0].InManifest {
+		t.Errorf("unexpected file report %+v", report.Files)
+	}
+}
+
+func TestVerifyScanDetectsCorruption(t *testing.T) {
+	chunks, manifest := verifyFixture(t)
+
+	tampered := append([]qr.Chunk(nil), chunks...)
+	tampered[3].Data = "AAAA" + tampered[3].Data[4:]
+	if report := VerifyScan("test", scanOf(manifest, tampered), VerifyOptions{}); report.Files[0].Status != VerifyCorrupt {
+		t.Errorf("expected hash mismatch to be CORRUPT, got %s", report.Files[0].Status)
+	}
+
+	// Without a manifest to reject it, a differing copy shows up as a conflict
+	conflicting := append(append([]qr.Chunk(nil), chunks...), tampered[3])
+	report := VerifyScan("test", scanOf(conflicting), VerifyOptions{})
+	if report.Status != VerifyCorrupt || len(report.Files[0].Conflicts) != 1 {
+		t.Errorf("expected conflicting chunk to be CORRUPT, got %+v", report.Files[0])
+	}
+
+	badTotal := append([]qr.Chunk(nil), chunks...)
+	badTotal[1].Total++
+	if report := VerifyScan("test", scanOf(badTotal), VerifyOptions{}); report.Status != VerifyCorrupt {
+		t.Errorf("expected inconsistent totals to be CORRUPT, got %s", report.Status)
+	}
+}
+
+func TestVerifyScanIncomplete(t *testing.T) {
+	chunks, manifest := verifyFixture(t)
+	report := VerifyScan("test", lose(scanOf(manifest, chunks[:len(chunks)-2]), 2), VerifyOptions{})
+	if report.Status != VerifyIncomplete {
+		t.Fatalf("expected INCOMPLETE, got %s", report.Status)
+	}
+
+	// A file listed in the manifest with no frames at all is also incomplete
+	report = VerifyScan("test", lose(scanOf(manifest), len(chunks)), VerifyOptions{})
+	if report.Status != VerifyIncomplete || len(report.Files) != 1 || report.Files[0].PresentChunks != 0 {
+		t.Errorf("expected manifest-only file to be INCOMPLETE, got %+v", report.Files)
+	}
+
+	// unless it lists more chunks than the video has frames
+	crafted := qr.NewManifest(chunks, time.Unix(0, 0))
+	crafted.Files[0].Chunks = 2000000000
+	craftedChunks, err := crafted.Chunks(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report = VerifyScan("test", scanOf(craftedChunks), VerifyOptions{})
+	if report.Status != VerifyCorrupt || len(report.Files) != 1 || report.Files[0].MissingIndices != nil {
+		t.Errorf("expected oversized manifest entry to be CORRUPT, got %+v", report.Files)
+	}
+}
+
+func TestVerifyScanSignedManifest(t *testing.T) {
+	chunks, _ := verifyFixture(t)
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := qr.NewManifest(chunks, time.Unix(0, 0))
+	if err := manifest.Sign(priv, "test"); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	signed, err := manifest.Chunks(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := VerifyScan("test", scanOf(signed, chunks), VerifyOptions{PublicKey: pub})
+	if report.Status != VerifyOK || report.Signature == nil || !report.Signature.Trusted {
+		t.Fatalf("expected trusted OK archive, got %s %+v", report.Status, report.Signature)
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if report := VerifyScan("test", scanOf(signed, chunks), VerifyOptions{PublicKey: other}); report.Status != VerifyCorrupt {
+		t.Errorf("expected wrong signer to be CORRUPT, got %s", report.Status)
+	}
+
+	// A forged frame is rejected while an intact copy still rebuilds the file
+	forged := chunks[2]
+	forged.Data = "AAAA" + forged.Data[4:]
+	report = VerifyScan("test", scanOf(signed, []qr.Chunk{forged}, chunks), VerifyOptions{PublicKey: pub})
+	file := report.Files[0]
+	if file.Status != VerifyCorrupt || len(file.Rejected) != 1 || file.ComputedHash != file.Hash {
+		t.Errorf("expected forged frame to be rejected, got %+v", file)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds the application configuration
@@ -15,6 +17,9 @@ type Config struct {
 	Verbose             bool    `json:"verbose"`
 	TempDir             string  `json:"temp_dir"`
 	OutputDir           string  `json:"output_dir"`
+	ParityGroupSize     int     `json:"parity_group_size"` // Data chunks per XOR parity chunk, 0 disables parity
+	SigningKeyPath      string  `json:"signing_key_path"`  // Ed25519 PKCS#8 key used to sign the manifest
+	Reproducible        bool    `json:"reproducible"`      // Fixed timestamps and encoder settings, so identical input gives identical output
 	
 	// AI Provider Configuration
 	EmbeddingProvider   string  `json:"embedding_provider"`
@@ -26,10 +31,21 @@ type Config struct {
 	OllamaBaseURL       string  `json:"ollama_base_url"`
 	OllamaModel         string  `json:"ollama_model"`
 	SearchEnabled       bool    `json:"search_enabled"`
+	EmbeddingCacheDir   string  `json:"embedding_cache_dir"`    // Cached embeddings by model and text hash, "off" to disable, the user cache directory if empty
+	EmbeddingCacheMaxMB int     `json:"embedding_cache_max_mb"` // Least recently used embeddings are evicted past this size, 0 for 1024
 	
 	// Encryption Configuration
 	EncryptionEnabled   bool    `json:"encryption_enabled"`
-	DefaultPassword     string  `json:"default_password"`
+	EncryptMetadata     bool    `json:"encrypt_metadata"` // Seal whole frames so file names and sizes are hidden too
+	KDF                 string  `json:"kdf"`              // Password key derivation, "argon2id" (default) or "pbkdf2"
+	KDFIterations       int     `json:"kdf_iterations"`   // PBKDF2 iterations or Argon2id passes, 0 for the default
+	KDFMemoryMiB        int     `json:"kdf_memory_mib"`   // Argon2id memory, 0 for the default
+	KDFThreads          int     `json:"kdf_threads"`      // Argon2id parallelism, 0 for the default
+	AllowCostlyKDF      bool    `json:"allow_costly_kdf"` // Create and open archives with key derivation costs past the default bounds; only for trusted archives
+	Recipients          []string `json:"recipients"`      // X25519 public keys (files or base64) to encrypt to instead of a password
+	IdentityPath        string  `json:"identity_path"`    // X25519 private key used to open archives encrypted to recipients
+	DataKeyPath         string  `json:"data_key_path"`    // Archive data key recovered from shares with pixe keycombine
+	KeyRefPrefix        string  `json:"key_ref_prefix"`   // Only keyring entries named with this prefix can be used by API requests, which leave it out
 	
 	// Cloud Storage Configuration
 	CloudEnabled        bool    `json:"cloud_enabled"`
@@ -77,10 +93,13 @@ func Default() *Config {
 		OllamaBaseURL:     getEnvOrDefault("OLLAMA_BASE_URL", "http://localhost:11434"),
 		OllamaModel:       getEnvOrDefault("OLLAMA_MODEL", "nomic-embed-text"),
 		SearchEnabled:     hasAnyEmbeddingProvider(),
+		EmbeddingCacheDir: os.Getenv("EMBEDDING_CACHE_DIR"),
+		EmbeddingCacheMaxMB: getIntEnv("EMBEDDING_CACHE_MAX_MB"),
 		
 		// Encryption Configuration
 		EncryptionEnabled: getBoolEnv("ENCRYPTION_ENABLED"),
-		DefaultPassword:   os.Getenv("DEFAULT_PASSWORD"),
+		AllowCostlyKDF:    getBoolEnv("PIXELOG_ALLOW_COSTLY_KDF"),
+		KeyRefPrefix:      getEnvOrDefault("KEY_REF_PREFIX", "server/"),
 		
 		// Cloud Storage Configuration
 		CloudEnabled:      hasCloudProvider(),
@@ -119,6 +138,31 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("frame rate must be between 0.1 and 60 FPS")
 	}
 
+	if c.ParityGroupSize < 0 || c.ParityGroupSize == 1 {
+		return fmt.Errorf("parity group size must be 0 (disabled) or at least 2")
+	}
+
+	if c.KDFIterations < 0 || c.KDFMemoryMiB < 0 || c.KDFThreads < 0 || c.KDFThreads > 255 {
+		return fmt.Errorf("key derivation parameters must be positive")
+	}
+
+	if c.EncryptMetadata && !c.EncryptionEnabled {
+		return fmt.Errorf("metadata encryption requires encryption to be enabled")
+	}
+
+	if len(c.Recipients) > 0 && (!c.EncryptionEnabled || c.EncryptMetadata) {
+		return fmt.Errorf("recipients require encryption to be enabled and cannot be combined with metadata encryption")
+	}
+
+	if c.Reproducible {
+		if c.EncryptionEnabled {
+			return fmt.Errorf("reproducible output cannot be encrypted, since keys, salts and nonces are random")
+		}
+		if _, err := sourceDateEpoch(); err != nil {
+			return err
+		}
+	}
+
 	if c.TempDir == "" {
 		tempDir, err := os.MkdirTemp("", "pixelog-*")
 		if err != nil {
@@ -143,6 +187,31 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// BuildTime returns the timestamp recorded in new archives: the current
+// time, or for reproducible output SOURCE_DATE_EPOCH if set and the Unix
+// epoch otherwise
+func (c *Config) BuildTime() time.Time {
+	if !c.Reproducible {
+		return time.Now()
+	}
+	epoch, _ := sourceDateEpoch()
+	return epoch
+}
+
+// sourceDateEpoch parses SOURCE_DATE_EPOCH as defined by
+// reproducible-builds.org, in seconds since the Unix epoch
+func sourceDateEpoch() (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: must be a non-negative number of seconds", value)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
 // Cleanup removes temporary directories
 func (c *Config) Cleanup() {
 	if c.TempDir != "" {
@@ -176,6 +245,11 @@ func getBoolEnv(key string) bool {
 	return value == "true" || value == "1" || value == "yes"
 }
 
+func getIntEnv(key string) int {
+	value, _ := strconv.Atoi(os.Getenv(key))
+	return value
+}
+
 func hasCloudProvider() bool {
 	return os.Getenv("S3_BUCKET") != "" ||
 		os.Getenv("GCS_BUCKET") != "" ||
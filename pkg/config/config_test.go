@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestConfigValidation(t *testing.T) {
@@ -18,3 +19,29 @@ func TestInvalidChunkSize(t *testing.T) {
 		t.Error("Should reject chunk size > 4000")
 	}
 }
+
+func TestReproducibleBuildTime(t *testing.T) {
+	cfg := Default()
+	cfg.Reproducible = true
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if got := cfg.BuildTime(); !got.Equal(time.Unix(0, 0)) {
+		t.Errorf("BuildTime without SOURCE_DATE_EPOCH = %v, want the Unix epoch", got)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if got := cfg.BuildTime(); !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("BuildTime = %v, want SOURCE_DATE_EPOCH", got)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if err := cfg.Validate(); err == nil {
+		t.Error("Should reject an invalid SOURCE_DATE_EPOCH")
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	cfg.EncryptionEnabled = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("Should reject reproducible encrypted output")
+	}
+}